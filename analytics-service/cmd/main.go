@@ -7,21 +7,30 @@ import (
 	"analytics-service/internal/metrics"
 	"analytics-service/internal/repository"
 	"analytics-service/internal/service/analytics"
-	"analytics-service/shared"
 	"context"
 	"errors"
-	"github.com/rabbitmq/amqp091-go"
+	"github.com/ArsiHien/pastebin-ms/events"
+	"github.com/ArsiHien/pastebin-ms/pkg/auth"
+	"github.com/ArsiHien/pastebin-ms/pkg/dedup"
+	"github.com/ArsiHien/pastebin-ms/pkg/dlq"
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"github.com/ArsiHien/pastebin-ms/pkg/lifecycle"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"github.com/ArsiHien/pastebin-ms/pkg/settings"
+	"github.com/ArsiHien/pastebin-ms/pkg/tracing"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.uber.org/zap"
 )
 
 func main() {
@@ -32,63 +41,150 @@ func main() {
 	}
 
 	// Initialize logger
-	logger := shared.NewLogger()
+	logger, logLevel, err := logging.New(logging.Config{
+		Service: "analytics-service",
+		Level:   cfg.LogLevel,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Sync()
+
+	// LOG_LEVEL can be changed by editing CONFIG_FILE and sending SIGHUP
+	cfgStore := settings.NewStore(cfg, config.Load)
+	cfgStore.OnReload(func(old, cur *config.Config) {
+		if cur.LogLevel != old.LogLevel {
+			_ = logLevel.UnmarshalText([]byte(cur.LogLevel))
+		}
+	})
+	go cfgStore.WatchSignals(context.Background(), logger)
+
+	// Admin API credentials can be rotated by reloading the configuration
+	tokens, keys := cfg.AdminCredentials()
+	authenticator := auth.NewAuthenticator(tokens, keys, cfg.AdminHMACMaxSkew)
+	if authenticator.Empty() {
+		logger.Warn("Neither ADMIN_TOKENS nor ADMIN_HMAC_KEYS is set; every admin request will be rejected")
+	}
+	cfgStore.OnReload(func(old, cur *config.Config) {
+		if cur.AdminTokens != old.AdminTokens || cur.AdminHMACKeys != old.AdminHMACKeys {
+			authenticator.SetCredentials(cur.AdminCredentials())
+			logger.Info("Reloaded admin credentials")
+		}
+	})
+	auditLogger, closeAuditLog, err := auth.NewAuditLogger(logger, cfg.AuditLogFile)
+	if err != nil {
+		logger.Fatal("Failed to open audit log", zap.Error(err))
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "analytics-service",
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", zap.Error(err))
+		}
+	}()
 
 	// Connect to MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI).
+		SetMonitor(otelmongo.NewMonitor()))
 	if err != nil {
-		logger.Fatalf("Failed to connect to MongoDB: %v", err)
+		logger.Fatal("Failed to connect to MongoDB", zap.Error(err))
 	}
-	defer func(mongoClient *mongo.Client, ctx context.Context) {
-		err := mongoClient.Disconnect(ctx)
-		if err != nil {
-			logger.Fatalf("Failed to disconnect from MongoDB: %v", err)
-		}
-	}(mongoClient, ctx)
 
 	// Connect to RabbitMQ
-	rabbitConn, err := shared.NewRabbitMQConn(cfg.RabbitMQURI)
+	rabbitConn, err := eventbus.NewRabbitMQConn(cfg.RabbitMQURI, logger)
 	if err != nil {
-		logger.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		logger.Fatal("Failed to connect to RabbitMQ", zap.Error(err))
 	}
-	defer func(rabbitConn *amqp091.Connection) {
-		err := rabbitConn.Close()
-		if err != nil {
-			logger.Fatalf("Failed to close RabbitMQ connection: %v", err)
-		}
-	}(rabbitConn)
 
 	metrics.ExposeMetrics()
 
 	// Initialize dependencies
 	viewRepo := repository.NewMongoAnalyticsRepository(mongoClient, cfg.MongoDBName)
-	consumer, err := eventbus.NewRabbitMQConsumer(rabbitConn, cfg.RabbitMQQueue)
+	indexCtx, cancelIndex := context.WithTimeout(context.Background(), 10*time.Second)
+	err = viewRepo.EnsureIndexes(indexCtx)
+	cancelIndex()
+	if err != nil {
+		logger.Fatal("Failed to create analytics indexes", zap.Error(err))
+	}
+	dedupCtx, cancelDedup := context.WithTimeout(context.Background(), 10*time.Second)
+	dedupStore, err := dedup.NewStore(dedupCtx, mongoClient.Database(cfg.MongoDBName), cfg.RabbitMQQueue, cfg.DedupTTL)
+	cancelDedup()
+	if err != nil {
+		logger.Fatal("Failed to create dedup store", zap.Error(err))
+	}
+	consumer, err := eventbus.NewRabbitMQConsumer(rabbitConn, cfg.RabbitMQQueue, rabbitmq.RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    cfg.RetryMaxDelay,
+	}, events.Decoder{AcceptBareJSON: cfg.EventsAcceptBareJSON}, dedupStore, logger)
+	if err != nil {
+		logger.Fatal("Failed to create RabbitMQ consumer", zap.Error(err))
+	}
+	dlqAdmin, err := dlq.NewAdmin(rabbitConn, consumer.QueueName())
 	if err != nil {
-		logger.Fatalf("Failed to create RabbitMQ consumer: %v", err)
+		logger.Fatal("Failed to create dead-letter admin", zap.Error(err))
 	}
 	analyticsService := analytics.NewAnalyticsService(viewRepo, consumer, logger)
 	handler := handlers.NewAnalyticsHandler(analyticsService, logger)
 
-	consumerCtx, consumerCancel := context.WithCancel(context.Background())
-	defer consumerCancel()
-	// Start event consumer
+	// Start event consumer; it runs until StopConsumer during shutdown
 	go func() {
-		if err := analyticsService.StartConsumer(consumerCtx); err != nil {
-			logger.Fatalf("Event consumer failed: %v", err)
+		if err := analyticsService.StartConsumer(context.Background()); err != nil {
+			logger.Fatal("Event consumer failed", zap.Error(err))
 		}
 	}()
 
+	spec, err := openapi.ForService(openapi.ServiceAnalytics)
+	if err != nil {
+		logger.Fatal("Failed to load OpenAPI spec", zap.Error(err))
+	}
+	validate, err := openapi.Middleware(spec)
+	if err != nil {
+		logger.Fatal("Failed to create request validator", zap.Error(err))
+	}
+
+	probe := health.NewProbe(map[string]health.Check{
+		"mongodb":  health.Mongo(mongoClient),
+		"rabbitmq": rabbitConn.Check,
+	})
+
 	// Set up router
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware("analytics-service"))
+	r.Use(requestid.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	// In cmd/main.go, update the router setup
-	r.Get("/api/analytics/hourly/{pasteUrl}", handler.GetHourlyAnalytics)
-	r.Get("/api/analytics/weekly/{pasteUrl}", handler.GetWeeklyAnalytics)
-	r.Get("/api/analytics/monthly/{pasteUrl}", handler.GetMonthlyAnalytics)
-	r.Get("/api/pastes/{url}/stats", handler.GetPasteStats) // Add this line
+	r.Group(func(r chi.Router) {
+		r.Use(validate)
+		r.Get("/openapi.json", openapi.Handler(spec))
+		// In cmd/main.go, update the router setup
+		r.Get("/api/analytics/hourly/{pasteUrl}", handler.GetHourlyAnalytics)
+		r.Get("/api/analytics/weekly/{pasteUrl}", handler.GetWeeklyAnalytics)
+		r.Get("/api/analytics/monthly/{pasteUrl}", handler.GetMonthlyAnalytics)
+		r.Get("/api/pastes/{url}/stats", handler.GetPasteStats) // Add this line
+		r.Get("/healthz", health.LiveHandler())
+		r.Get("/readyz", probe.ReadyHandler())
+	})
+	// The admin API; callers are authenticated before their request is
+	// validated so anonymous callers learn nothing about it
+	r.Group(func(r chi.Router) {
+		r.Use(authenticator.Middleware("analytics-service", auditLogger))
+		r.Use(validate)
+		r.Handle("/admin/log-level", logging.LevelHandler(logLevel))
+		r.Get("/admin/config", cfgStore.Handler())
+		r.Post("/admin/config/reload", cfgStore.ReloadHandler())
+		r.Mount("/admin/dlq", dlq.NewRouter(dlqAdmin))
+	})
 
 	// Start server
 	server := &http.Server{
@@ -97,22 +193,30 @@ func main() {
 	}
 
 	go func() {
-		logger.Infof("Starting server on :%s", cfg.Port)
+		logger.Info("Starting server", zap.String("port", cfg.Port))
 		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Fatalf("Server failed: %v", err)
+			logger.Fatal("Server failed", zap.Error(err))
 		}
 	}()
 
-	// Graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
-
-	logger.Infof("Shutting down server...")
-	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	// Graceful shutdown: leave the load balancer, finish the events and
+	// requests in flight, then disconnect
+	sig := lifecycle.WaitForSignal()
+	logger.Info("Shutting down", zap.Stringer("signal", sig))
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Errorf("Server shutdown failed: %v", err)
+	err = lifecycle.Shutdown(ctx, logger,
+		lifecycle.Drain(probe, cfg.ShutdownDelay),
+		lifecycle.Close("consumer", analyticsService.StopConsumer),
+		lifecycle.Step{Name: "http", Stop: server.Shutdown},
+		lifecycle.Close("dead-letter admin", dlqAdmin.Close),
+		lifecycle.Step{Name: "mongodb", Stop: mongoClient.Disconnect},
+		lifecycle.Close("rabbitmq", rabbitConn.Close),
+		lifecycle.Close("audit log", closeAuditLog),
+	)
+	if err != nil {
+		logger.Error("Shutdown did not complete", zap.Error(err))
+		return
 	}
-	logger.Infof("Server stopped")
+	logger.Info("Server stopped")
 }
@@ -6,6 +6,7 @@ import (
 )
 
 type View struct {
+	EventID  string    `bson:"event_id,omitempty"`
 	PasteURL string    `bson:"paste_url"`
 	ViewedAt time.Time `bson:"viewed_at"`
 }
@@ -20,6 +21,10 @@ type TimeSeriesPoint struct {
 	ViewCount int       `json:"viewCount"`
 }
 
+type PasteStatsResponse struct {
+	ViewCount int `json:"viewCount"`
+}
+
 type PasteTimeSeriesResponse struct {
 	PasteURL   string            `json:"pasteUrl"`
 	TotalViews int               `json:"totalViews"`
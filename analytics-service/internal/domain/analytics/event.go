@@ -5,6 +5,8 @@ import (
 )
 
 type PasteViewedEvent struct {
+	// ID is the event's message ID, empty for events sent before IDs existed
+	ID       string    `json:"id,omitempty"`
 	URL      string    `json:"url"`
 	ViewedAt time.Time `json:"viewed_at"`
 }
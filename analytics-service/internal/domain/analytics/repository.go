@@ -3,7 +3,8 @@ package analytics
 import "context"
 
 type Repository interface {
-	SaveView(ctx context.Context, view *View) error
+	// SaveView reports whether the view was new rather than a redelivery
+	SaveView(ctx context.Context, view *View) (bool, error)
 	IncrementViewCount(ctx context.Context, pasteURL string) error
 	GetAnalytics(ctx context.Context, pasteURL string,
 		period string) ([]View, error)
@@ -3,110 +3,220 @@ package eventbus
 import (
 	"analytics-service/internal/metrics"
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"sync/atomic"
 	"time"
 
 	"analytics-service/internal/domain/analytics"
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/ArsiHien/pastebin-ms/pkg/dedup"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
 	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
 )
 
 type EventConsumer interface {
-	Consume(ctx context.Context, handler func(analytics.PasteViewedEvent) error) error
+	Consume(ctx context.Context, handler func(context.Context, analytics.PasteViewedEvent) error) error
 	Close() error
 }
 
 type RabbitMQConsumer struct {
-	conn    *amqp091.Connection
-	channel *amqp091.Channel
-	queue   string
+	consumer *rabbitmq.Consumer
+	retrier  *rabbitmq.Retrier
+	retry    rabbitmq.RetryPolicy
+	decoder  events.Decoder
+	dedup    *dedup.Store
+	queue    string
+	logger   *zap.Logger
+
+	// done is closed when Consume returns, so Close can wait for the
+	// deliveries in flight to be handled
+	consuming atomic.Bool
+	done      chan struct{}
 }
 
-func NewRabbitMQConsumer(conn *amqp091.Connection, queue string) (*RabbitMQConsumer, error) {
-	ch, err := conn.Channel()
+// NewRabbitMQConn dials RabbitMQ and keeps the connection alive, re-declaring
+// the pastebin_events exchange after every reconnect.
+func NewRabbitMQConn(uri string, logger *zap.Logger) (*rabbitmq.Connection, error) {
+	reconnecting := false
+	return rabbitmq.Dial(uri,
+		rabbitmq.WithTopology(func(ch *amqp091.Channel) error {
+			return events.DeclareExchange(ch)
+		}),
+		rabbitmq.WithStateHandler(func(connected bool, err error) {
+			if connected {
+				metrics.RabbitMQConnected.Set(1)
+				if reconnecting {
+					metrics.RabbitMQReconnects.Inc()
+					logger.Info("Reconnected to RabbitMQ")
+				}
+				reconnecting = false
+				return
+			}
+			metrics.RabbitMQConnected.Set(0)
+			reconnecting = true
+			logger.Error("RabbitMQ connection unavailable", zap.Error(err))
+		}),
+	)
+}
+
+func NewRabbitMQConsumer(conn *rabbitmq.Connection, queue string, retry rabbitmq.RetryPolicy,
+	decoder events.Decoder, dedup *dedup.Store, logger *zap.Logger) (*RabbitMQConsumer, error) {
+	retrier, err := rabbitmq.NewRetrier(conn, queue, retry)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+		return nil, fmt.Errorf("failed to create retrier: %w", err)
+	}
+
+	c := &RabbitMQConsumer{retrier: retrier, retry: retry, decoder: decoder, dedup: dedup, queue: queue,
+		logger: logger, done: make(chan struct{})}
+	c.consumer = conn.NewConsumer(rabbitmq.ConsumerOptions{
+		Queue: queue,
+		Setup: c.declare,
+		OnError: func(err error) {
+			logger.Error("Failed to subscribe", zap.String("queue", queue), zap.Error(err))
+		},
+	})
+	return c, nil
+}
+
+// QueueName returns the queue this consumer reads from.
+func (c *RabbitMQConsumer) QueueName() string {
+	return c.queue
+}
+
+// declare sets up the queue, its binding and the retry and dead-letter
+// queues; it runs on every new channel.
+func (c *RabbitMQConsumer) declare(ch *amqp091.Channel) error {
+	if err := events.DeclareExchange(ch); err != nil {
+		return err
+	}
+	if err := rabbitmq.DeclareRetryTopology(ch, c.queue, c.retry); err != nil {
+		return err
 	}
 
 	if _, err := ch.QueueDeclare(
-		queue,
+		c.queue,
 		true,  // durable
 		false, // autoDelete
 		false, // exclusive
 		false, // noWait
 		nil,
 	); err != nil {
-		ch.Close()
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
 	if err := ch.QueueBind(
-		queue,
-		"paste.viewed",    // routing key
-		"pastebin_events", // exchange
+		c.queue,
+		events.RoutingKeyPasteViewed,
+		events.Exchange,
 		false,
 		nil,
 	); err != nil {
-		ch.Close()
-		return nil, fmt.Errorf("failed to bind queue: %w", err)
+		return fmt.Errorf("failed to bind queue: %w", err)
 	}
-
-	return &RabbitMQConsumer{
-		conn:    conn,
-		channel: ch,
-		queue:   queue,
-	}, nil
+	return nil
 }
 
-func (c *RabbitMQConsumer) Consume(ctx context.Context, handler func(analytics.PasteViewedEvent) error) error {
-	msgs, err := c.channel.Consume(
-		c.queue,
-		"",    // consumer tag
-		false, // autoAck
-		false, // exclusive
-		false, // noLocal
-		false, // noWait
-		nil,
-	)
+// Consume blocks until ctx is done or Close is called, resubscribing
+// whenever the channel or connection is lost. Cancelling ctx only stops the
+// subscription; deliveries already received are still handled to the end.
+func (c *RabbitMQConsumer) Consume(ctx context.Context, handler func(context.Context, analytics.PasteViewedEvent) error) error {
+	c.consuming.Store(true)
+	defer close(c.done)
+
+	handleCtx := context.WithoutCancel(ctx)
+	err := c.consumer.Run(ctx, func(msgs <-chan amqp091.Delivery) {
+		for msg := range msgs {
+			c.handle(handleCtx, msg, handler)
+		}
+	})
 	if err != nil {
-		return fmt.Errorf("failed to consume messages: %w", err)
+		return err
 	}
+	return ctx.Err()
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
+func (c *RabbitMQConsumer) handle(ctx context.Context, msg amqp091.Delivery,
+	handler func(context.Context, analytics.PasteViewedEvent) error) {
+	// The span continues the trace of the view that published the event
+	ctx, span := rabbitmq.StartConsumeSpan(ctx, c.queue, msg)
+	defer span.End()
+	logger := c.logger.With(logging.RequestID(rabbitmq.RequestID(msg)))
+
+	if key := rabbitmq.RoutingKey(msg); key != events.RoutingKeyPasteViewed {
+		logger.Info("Skipping unrelated event", logging.RoutingKey(key))
+		_ = msg.Ack(false)
+		return
+	}
 
-		case msg := <-msgs:
-			if msg.RoutingKey != "paste.viewed" {
-				log.Printf("Skipping unrelated event: %s", msg.RoutingKey)
-				_ = msg.Ack(false)
-				continue
-			}
+	event, err := c.decode(msg)
+	if err != nil {
+		logger.Error("Failed to unmarshal event, dead-lettering", zap.Error(err))
+		if err := c.retrier.DeadLetter(ctx, msg, err); err != nil {
+			logger.Error("Failed to dead-letter message", zap.Error(err))
+		}
+		return
+	}
 
-			var event analytics.PasteViewedEvent
-			if err := json.Unmarshal(msg.Body, &event); err != nil {
-				log.Printf("Failed to unmarshal event: %v", err)
-				_ = msg.Nack(false, true)
-				continue
+	if event.ID != "" {
+		seen, err := c.dedup.Seen(ctx, event.ID)
+		if err != nil {
+			logger.Error("Failed to check processed messages, scheduling retry", zap.Error(err))
+			if err := c.retrier.Retry(ctx, msg, err); err != nil {
+				logger.Error("Failed to schedule retry", zap.Error(err))
 			}
+			return
+		}
+		if seen {
+			logger.Info("Skipping duplicate event", zap.String("eventID", event.ID))
+			metrics.DuplicateMessages.WithLabelValues(c.queue).Inc()
+			_ = msg.Ack(false)
+			return
+		}
+	}
 
-			if err := handler(event); err != nil {
-				log.Printf("Handler error: %v", err)
-				_ = msg.Nack(false, true)
-				continue
-			}
+	if err := handler(ctx, event); err != nil {
+		logger.Error("Handler error, scheduling retry", zap.Int("attempt", rabbitmq.Attempts(msg)+1),
+			zap.Error(err))
+		if err := c.retrier.Retry(ctx, msg, err); err != nil {
+			logger.Error("Failed to schedule retry", zap.Error(err))
+		}
+		return
+	}
 
-			metrics.PasteEventDuration.Observe(float64(time.Since(event.ViewedAt)))
+	metrics.PasteEventDuration.Observe(float64(time.Since(event.ViewedAt)))
 
-			if err := msg.Ack(false); err != nil {
-				return fmt.Errorf("failed to ack message: %w", err)
-			}
+	if event.ID != "" {
+		if err := c.dedup.MarkProcessed(ctx, event.ID); err != nil {
+			logger.Error("Failed to record processed event", zap.Error(err))
 		}
 	}
+
+	if err := msg.Ack(false); err != nil {
+		logger.Error("Failed to ack message", zap.Error(err))
+	}
+}
+
+// decode reads a paste.viewed event in either JSON or protobuf encoding.
+func (c *RabbitMQConsumer) decode(msg amqp091.Delivery) (analytics.PasteViewedEvent, error) {
+	var viewed v1.PasteViewed
+	env, err := c.decoder.Decode(msg, &viewed)
+	if err != nil {
+		return analytics.PasteViewedEvent{}, err
+	}
+	return analytics.PasteViewedEvent{ID: env.ID, URL: viewed.URL, ViewedAt: viewed.ViewedAt}, nil
 }
 
+// Close cancels the subscription, waits for Consume to finish the
+// deliveries already received and closes the retry publisher.
 func (c *RabbitMQConsumer) Close() error {
-	return c.channel.Close()
+	if err := c.consumer.Stop(); err != nil {
+		return err
+	}
+	if c.consuming.Load() {
+		<-c.done
+	}
+	return c.retrier.Close()
 }
@@ -0,0 +1,38 @@
+package eventbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// BenchmarkDecodePasteViewed measures the consumer-side cost of each
+// encoding. Run with: go test -run=^$ -bench=. ./internal/eventbus
+func BenchmarkDecodePasteViewed(b *testing.B) {
+	event := v1.PasteViewed{URL: "aB3dE5gH", ViewedAt: time.Now()}
+	c := &RabbitMQConsumer{}
+
+	for name, contentType := range map[string]string{
+		"json":     events.ContentTypeJSON,
+		"protobuf": events.ContentTypeProtobuf,
+	} {
+		msg, err := events.Encoder{Source: "/bench", ContentType: contentType}.Encode(event)
+		if err != nil {
+			b.Fatal(err)
+		}
+		d := amqp091.Delivery{Headers: msg.Headers, ContentType: msg.ContentType, Body: msg.Body}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(d.Body)), "bytes/msg")
+			for i := 0; i < b.N; i++ {
+				if _, err := c.decode(d); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,21 +1,24 @@
 package handlers
 
 import (
-	"analytics-service/shared"
 	"encoding/json"
 	"net/http"
 
+	domain "analytics-service/internal/domain/analytics"
 	"analytics-service/internal/service/analytics"
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 )
 
 type AnalyticsHandler struct {
 	service *analytics.Service
-	logger  *shared.Logger
+	logger  *zap.Logger
 }
 
 func NewAnalyticsHandler(service *analytics.Service,
-	logger *shared.Logger) *AnalyticsHandler {
+	logger *zap.Logger) *AnalyticsHandler {
 	return &AnalyticsHandler{
 		service: service,
 		logger:  logger,
@@ -25,14 +28,14 @@ func NewAnalyticsHandler(service *analytics.Service,
 func (h *AnalyticsHandler) GetHourlyAnalytics(w http.ResponseWriter, r *http.Request) {
 	pasteURL := chi.URLParam(r, "pasteUrl")
 	if pasteURL == "" {
-		http.Error(w, "pasteUrl is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "pasteUrl is required")
 		return
 	}
 
 	resp, err := h.service.GetAnalytics(r.Context(), pasteURL, analytics.Hourly)
 	if err != nil {
-		h.logger.Errorf("Failed to get hourly analytics for %s: %v", pasteURL, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.log(r).Error("Failed to get hourly analytics", logging.URL(pasteURL), zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -43,14 +46,14 @@ func (h *AnalyticsHandler) GetHourlyAnalytics(w http.ResponseWriter, r *http.Req
 func (h *AnalyticsHandler) GetWeeklyAnalytics(w http.ResponseWriter, r *http.Request) {
 	pasteURL := chi.URLParam(r, "pasteUrl")
 	if pasteURL == "" {
-		http.Error(w, "pasteUrl is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "pasteUrl is required")
 		return
 	}
 
 	resp, err := h.service.GetAnalytics(r.Context(), pasteURL, analytics.Weekly)
 	if err != nil {
-		h.logger.Errorf("Failed to get weekly analytics for %s: %v", pasteURL, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.log(r).Error("Failed to get weekly analytics", logging.URL(pasteURL), zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -61,14 +64,14 @@ func (h *AnalyticsHandler) GetWeeklyAnalytics(w http.ResponseWriter, r *http.Req
 func (h *AnalyticsHandler) GetMonthlyAnalytics(w http.ResponseWriter, r *http.Request) {
 	pasteURL := chi.URLParam(r, "pasteUrl")
 	if pasteURL == "" {
-		http.Error(w, "pasteUrl is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "pasteUrl is required")
 		return
 	}
 
 	resp, err := h.service.GetAnalytics(r.Context(), pasteURL, analytics.Monthly)
 	if err != nil {
-		h.logger.Errorf("Failed to get monthly analytics for %s: %v", pasteURL, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.log(r).Error("Failed to get monthly analytics", logging.URL(pasteURL), zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -79,20 +82,25 @@ func (h *AnalyticsHandler) GetMonthlyAnalytics(w http.ResponseWriter, r *http.Re
 func (h *AnalyticsHandler) GetPasteStats(w http.ResponseWriter, r *http.Request) {
 	pasteURL := chi.URLParam(r, "url")
 	if pasteURL == "" {
-		http.Error(w, "url is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "url is required")
 		return
 	}
 
 	count, err := h.service.GetPasteStats(r.Context(), pasteURL)
 	if err != nil {
-		h.logger.Errorf("Failed to get stats for paste %s: %v", pasteURL, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.log(r).Error("Failed to get stats", logging.URL(pasteURL), zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string]int{"viewCount": count})
+	err = json.NewEncoder(w).Encode(domain.PasteStatsResponse{ViewCount: count})
 	if err != nil {
 		return
 	}
 }
+
+// log returns the handler's logger tagged with the request's ID.
+func (h *AnalyticsHandler) log(r *http.Request) *zap.Logger {
+	return logging.FromContext(r.Context(), h.logger)
+}
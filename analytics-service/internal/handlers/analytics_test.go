@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	domain "analytics-service/internal/domain/analytics"
+	"analytics-service/internal/service/analytics"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi/openapitest"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type fakeRepo struct {
+	views []domain.View
+	err   error
+}
+
+func (r fakeRepo) SaveView(ctx context.Context, view *domain.View) (bool, error) {
+	return r.err == nil, r.err
+}
+func (r fakeRepo) IncrementViewCount(ctx context.Context, pasteURL string) error { return r.err }
+func (r fakeRepo) GetPastesStats(ctx context.Context) (map[string]int, error)    { return nil, r.err }
+func (r fakeRepo) GetViewCount(ctx context.Context, pasteURL string) (int, error) {
+	return len(r.views), r.err
+}
+func (r fakeRepo) GetAnalytics(ctx context.Context, pasteURL string, period string) ([]domain.View, error) {
+	return r.views, r.err
+}
+
+func newTestRouter(repo domain.Repository) http.Handler {
+	logger := zap.NewNop()
+	handler := NewAnalyticsHandler(analytics.NewAnalyticsService(repo, nil, logger), logger)
+
+	r := chi.NewRouter()
+	r.Get("/api/analytics/hourly/{pasteUrl}", handler.GetHourlyAnalytics)
+	r.Get("/api/analytics/weekly/{pasteUrl}", handler.GetWeeklyAnalytics)
+	r.Get("/api/analytics/monthly/{pasteUrl}", handler.GetMonthlyAnalytics)
+	r.Get("/api/pastes/{url}/stats", handler.GetPasteStats)
+	return r
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	now := time.Now()
+	repos := map[string]fakeRepo{
+		"views":    {views: []domain.View{{PasteURL: "abc", ViewedAt: now}, {PasteURL: "abc", ViewedAt: now.Add(-time.Hour)}}},
+		"no views": {},
+		"error":    {err: errors.New("mongo down")},
+	}
+	paths := []string{
+		"/api/pastes/abc/stats",
+		"/api/analytics/hourly/abc",
+		"/api/analytics/weekly/abc",
+		"/api/analytics/monthly/abc",
+	}
+
+	for name, repo := range repos {
+		check := openapitest.New(t, openapi.ServiceAnalytics, newTestRouter(repo))
+		want := http.StatusOK
+		if repo.err != nil {
+			want = http.StatusInternalServerError
+		}
+		for _, path := range paths {
+			t.Run(name+path, func(t *testing.T) {
+				rec := check.Do(httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != want {
+					t.Errorf("status = %d, want %d", rec.Code, want)
+				}
+			})
+		}
+	}
+}
@@ -15,10 +15,32 @@ var (
 			Buckets: prometheus.DefBuckets,
 		},
 	)
+
+	RabbitMQConnected = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "analytics_service_rabbitmq_connected",
+			Help: "Whether the RabbitMQ connection is currently up (1) or reconnecting (0).",
+		},
+	)
+
+	RabbitMQReconnects = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "analytics_service_rabbitmq_reconnects_total",
+			Help: "Number of successful RabbitMQ reconnects.",
+		},
+	)
+
+	DuplicateMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_service_duplicate_messages_total",
+			Help: "Number of redelivered messages skipped because they were already processed.",
+		},
+		[]string{"queue"},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(PasteEventDuration)
+	prometheus.MustRegister(PasteEventDuration, RabbitMQConnected, RabbitMQReconnects, DuplicateMessages)
 }
 
 func ExposeMetrics() {
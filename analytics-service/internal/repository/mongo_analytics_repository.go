@@ -3,7 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
 	"time"
 
 	"analytics-service/internal/domain/analytics"
@@ -24,9 +24,42 @@ func NewMongoAnalyticsRepository(client *mongo.Client, dbName string) *MongoAnal
 	}
 }
 
-func (r *MongoAnalyticsRepository) SaveView(ctx context.Context, view *analytics.View) error {
-	_, err := r.viewsCollection.InsertOne(ctx, view)
-	return err
+// EnsureIndexes creates the unique index on the event ID of views. Views
+// stored before events carried an ID have none and are left out of it.
+func (r *MongoAnalyticsRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.viewsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "event_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"event_id": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create event_id index on %s: %w", r.viewsCollection.Name(), err)
+	}
+	return nil
+}
+
+// SaveView stores a view and reports whether it was new. Views carrying an
+// event ID are upserted on it, so a redelivered event does not record the
+// view twice.
+func (r *MongoAnalyticsRepository) SaveView(ctx context.Context, view *analytics.View) (bool, error) {
+	if view.EventID == "" {
+		_, err := r.viewsCollection.InsertOne(ctx, view)
+		return err == nil, err
+	}
+	result, err := r.viewsCollection.UpdateOne(ctx,
+		bson.M{"event_id": view.EventID},
+		bson.M{"$setOnInsert": view},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent delivery of the same event inserted it first
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount == 1, nil
 }
 
 func (r *MongoAnalyticsRepository) IncrementViewCount(ctx context.Context, pasteURL string) error {
@@ -71,8 +104,6 @@ func (r *MongoAnalyticsRepository) GetAnalytics(ctx context.Context, pasteURL st
 		return nil, analytics.ErrInvalidPeriod
 	}
 
-	log.Println("Start time:", startTime)
-
 	// Find all views in the time range
 	filter := bson.M{
 		"paste_url": pasteURL,
@@ -3,9 +3,10 @@ package analytics
 import (
 	"analytics-service/internal/domain/analytics"
 	"analytics-service/internal/eventbus"
-	"analytics-service/shared"
 	"context"
 	"fmt"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"go.uber.org/zap"
 	"time"
 )
 
@@ -18,35 +19,50 @@ const (
 type Service struct {
 	repo     analytics.Repository
 	consumer eventbus.EventConsumer
-	logger   *shared.Logger
+	logger   *zap.Logger
 }
 
-func NewAnalyticsService(repo analytics.Repository, consumer eventbus.EventConsumer, logger *shared.Logger) *Service {
+func NewAnalyticsService(repo analytics.Repository, consumer eventbus.EventConsumer, logger *zap.Logger) *Service {
 	return &Service{repo: repo, consumer: consumer, logger: logger}
 }
 
 func (s *Service) StartConsumer(ctx context.Context) error {
-	return s.consumer.Consume(ctx, func(event analytics.PasteViewedEvent) error {
+	return s.consumer.Consume(ctx, func(ctx context.Context, event analytics.PasteViewedEvent) error {
+		logger := logging.FromContext(ctx, s.logger).With(logging.URL(event.URL))
 		view := &analytics.View{
+			EventID:  event.ID,
 			PasteURL: event.URL,
 			ViewedAt: event.ViewedAt,
 		}
 
-		if err := s.repo.SaveView(ctx, view); err != nil {
-			s.logger.Errorf("Failed to save view for %s: %v", event.URL, err)
+		inserted, err := s.repo.SaveView(ctx, view)
+		if err != nil {
+			logger.Error("Failed to save view", zap.Error(err))
 			return err
 		}
+		// The count follows the views: a redelivered event whose view was
+		// already stored is not counted again. A crash between the two
+		// writes loses that view's increment rather than counting it twice
+		if !inserted {
+			logger.Info("View already recorded; not counting it again")
+			return nil
+		}
 
 		if err := s.repo.IncrementViewCount(ctx, event.URL); err != nil {
-			s.logger.Errorf("Failed to increment view count for %s: %v", event.URL, err)
+			logger.Error("Failed to increment view count", zap.Error(err))
 			return err
 		}
 
-		s.logger.Infof("Processed view event for paste: %s", event.URL)
+		logger.Info("Processed view event")
 		return nil
 	})
 }
 
+// StopConsumer stops taking new events and waits for the ones in flight.
+func (s *Service) StopConsumer() error {
+	return s.consumer.Close()
+}
+
 func (s *Service) GetAnalytics(ctx context.Context, pasteURL string, period string) (*analytics.PasteTimeSeriesResponse, error) {
 	views, err := s.repo.GetAnalytics(ctx, pasteURL, period)
 	if err != nil {
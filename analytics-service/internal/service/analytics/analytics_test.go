@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	domain "analytics-service/internal/domain/analytics"
+	"go.uber.org/zap"
+)
+
+// memoryRepo stores views by event ID, like the upsert on event_id.
+type memoryRepo struct {
+	domain.Repository
+	views  map[string]bool
+	counts map[string]int
+}
+
+func (r *memoryRepo) SaveView(ctx context.Context, view *domain.View) (bool, error) {
+	if r.views[view.EventID] {
+		return false, nil
+	}
+	r.views[view.EventID] = true
+	return true, nil
+}
+
+func (r *memoryRepo) IncrementViewCount(ctx context.Context, pasteURL string) error {
+	r.counts[pasteURL]++
+	return nil
+}
+
+// replayConsumer hands every event to the handler as if it was delivered.
+type replayConsumer struct{ events []domain.PasteViewedEvent }
+
+func (c replayConsumer) Consume(ctx context.Context, handler func(context.Context, domain.PasteViewedEvent) error) error {
+	for _, e := range c.events {
+		if err := handler(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (replayConsumer) Close() error { return nil }
+
+func TestRedeliveredViewIsCountedOnce(t *testing.T) {
+	repo := &memoryRepo{views: map[string]bool{}, counts: map[string]int{}}
+	first := domain.PasteViewedEvent{ID: "evt-1", URL: "abc", ViewedAt: time.Now()}
+	second := domain.PasteViewedEvent{ID: "evt-2", URL: "abc", ViewedAt: time.Now()}
+	consumer := replayConsumer{events: []domain.PasteViewedEvent{first, first, second}}
+
+	if err := NewAnalyticsService(repo, consumer, zap.NewNop()).StartConsumer(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.counts["abc"]; got != 2 {
+		t.Errorf("view_count = %d, want 2", got)
+	}
+}
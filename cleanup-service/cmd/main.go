@@ -5,10 +5,6 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
 	"cleanup-service/config"
 	"cleanup-service/internal/eventbus"
@@ -16,12 +12,28 @@ import (
 	"cleanup-service/internal/repository"
 	"cleanup-service/internal/scheduler"
 	"cleanup-service/internal/service/cleanup"
-	"cleanup-service/shared"
+	"cleanup-service/internal/service/reconcile"
+	"github.com/ArsiHien/pastebin-ms/events"
+	"github.com/ArsiHien/pastebin-ms/pkg/auth"
+	"github.com/ArsiHien/pastebin-ms/pkg/dedup"
+	"github.com/ArsiHien/pastebin-ms/pkg/dlq"
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"github.com/ArsiHien/pastebin-ms/pkg/lifecycle"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"github.com/ArsiHien/pastebin-ms/pkg/settings"
+	"github.com/ArsiHien/pastebin-ms/pkg/tracing"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.uber.org/zap"
 )
 
 func main() {
@@ -32,44 +44,81 @@ func main() {
 	}
 
 	// Initialize logger
-	logger := shared.NewLogger()
+	logger, logLevel, err := logging.New(logging.Config{
+		Service: "cleanup-service",
+		Level:   cfg.LogLevel,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Sync()
+
+	// LOG_LEVEL and the RECONCILE_REPAIR and RECONCILE_PAGE_SIZE of scheduled
+	// runs can be changed by editing CONFIG_FILE and sending SIGHUP
+	cfgStore := settings.NewStore(cfg, config.Load)
+	cfgStore.OnReload(func(old, cur *config.Config) {
+		if cur.LogLevel != old.LogLevel {
+			_ = logLevel.UnmarshalText([]byte(cur.LogLevel))
+		}
+	})
+	go cfgStore.WatchSignals(context.Background(), logger)
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "cleanup-service",
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", zap.Error(err))
+		}
+	}()
 
 	// Connect to MySQL
 	mysqlDB, err := sql.Open("mysql", cfg.MySQLDSN)
 	if err != nil {
-		logger.Fatalf("Failed to connect to MySQL: %v", err)
+		logger.Fatal("Failed to connect to MySQL", zap.Error(err))
 	}
-	defer mysqlDB.Close()
 
 	// Connect to MongoDB (cleanup)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI).
+		SetMonitor(otelmongo.NewMonitor()))
 	if err != nil {
-		logger.Fatalf("Failed to connect to MongoDB: %v", err)
+		logger.Fatal("Failed to connect to MongoDB", zap.Error(err))
 	}
-	defer mongoClient.Disconnect(ctx)
 
 	// Connect to MongoDB (retrieval)
-	retrieveMongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.RetrieveMongoURI))
+	retrieveMongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.RetrieveMongoURI).
+		SetMonitor(otelmongo.NewMonitor()))
 	if err != nil {
-		logger.Fatalf("Failed to connect to Retrieval MongoDB: %v", err)
+		logger.Fatal("Failed to connect to Retrieval MongoDB", zap.Error(err))
 	}
-	defer retrieveMongoClient.Disconnect(ctx)
 
 	// Connect to MongoDB (analytics)
-	analyticsMongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.AnalyticsMongoURI))
+	analyticsMongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.AnalyticsMongoURI).
+		SetMonitor(otelmongo.NewMonitor()))
+	if err != nil {
+		logger.Fatal("Failed to connect to Analytics MongoDB", zap.Error(err))
+	}
+
+	// Connect to Redis (retrieval cache)
+	redisOpt, err := redis.ParseURL(cfg.RetrieveRedisURI)
 	if err != nil {
-		logger.Fatalf("Failed to connect to Analytics MongoDB: %v", err)
+		logger.Fatal("Failed to parse Retrieval Redis URI", zap.Error(err))
 	}
-	defer analyticsMongoClient.Disconnect(ctx)
+	redisClient := redis.NewClient(redisOpt)
 
 	// Connect to RabbitMQ
-	rabbitConn, err := shared.NewRabbitMQConn(cfg.RabbitMQURI)
+	rabbitConn, err := eventbus.NewRabbitMQConn(cfg.RabbitMQURI, logger)
 	if err != nil {
-		logger.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		logger.Fatal("Failed to connect to RabbitMQ", zap.Error(err))
 	}
-	defer rabbitConn.Close()
 
 	// Initialize dependencies
 	mysqlRepo := repository.NewMySQLPasteRepository(mysqlDB)
@@ -77,40 +126,137 @@ func main() {
 	analyticsRepo := repository.NewMongoAnalyticsRepository(analyticsMongoClient, cfg.AnalyticsMongoDBName)
 	cleanupRepo := repository.NewMongoCleanupRepository(mongoClient, cfg.MongoDBName)
 
-	consumer, err := eventbus.NewRabbitMQConsumer(rabbitConn)
+	dedupStore, err := dedup.NewStore(ctx, mongoClient.Database(cfg.MongoDBName), "cleanup.events", cfg.DedupTTL)
+	if err != nil {
+		logger.Fatal("Failed to create dedup store", zap.Error(err))
+	}
+
+	consumer, err := eventbus.NewRabbitMQConsumer(rabbitConn, rabbitmq.RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    cfg.RetryMaxDelay,
+	}, events.Decoder{AcceptBareJSON: cfg.EventsAcceptBareJSON}, dedupStore, logger)
 	if err != nil {
-		logger.Fatalf("Failed to create RabbitMQ consumer: %v", err)
+		logger.Fatal("Failed to create RabbitMQ consumer", zap.Error(err))
+	}
+
+	dlqAdmin, err := dlq.NewAdmin(rabbitConn, consumer.QueueName())
+	if err != nil {
+		logger.Fatal("Failed to create dead-letter admin", zap.Error(err))
 	}
-	defer consumer.Close()
 
 	cleanupService := cleanup.NewCleanupService(
 		mysqlRepo,
 		retrievalRepo,
 		analyticsRepo,
 		cleanupRepo,
+		repository.NewRedisRetrievalCache(redisClient),
 		consumer, // Changed from publisher to consumer to match service constructor
 		logger,
 	)
 
+	publisher, err := eventbus.NewRabbitMQPublisher(rabbitConn, cfg.PublishConfirmTimeout,
+		cfg.EventsContentType, logger)
+	if err != nil {
+		logger.Fatal("Failed to create RabbitMQ publisher", zap.Error(err))
+	}
+
+	reconcileService := reconcile.NewService(
+		mysqlRepo,
+		retrievalRepo,
+		analyticsRepo,
+		cleanupRepo,
+		publisher,
+		cfg.ReconcileGrace,
+		logger,
+	)
+
+	// Admin API credentials can be rotated by reloading the configuration
+	tokens, keys := cfg.AdminCredentials()
+	authenticator := auth.NewAuthenticator(tokens, keys, cfg.AdminHMACMaxSkew)
+	if authenticator.Empty() {
+		logger.Warn("Neither ADMIN_TOKENS nor ADMIN_HMAC_KEYS is set; every admin request will be rejected")
+	}
+	cfgStore.OnReload(func(old, cur *config.Config) {
+		if cur.AdminTokens != old.AdminTokens || cur.AdminHMACKeys != old.AdminHMACKeys {
+			authenticator.SetCredentials(cur.AdminCredentials())
+			logger.Info("Reloaded admin credentials")
+		}
+	})
+	auditLogger, closeAuditLog, err := auth.NewAuditLogger(logger, cfg.AuditLogFile)
+	if err != nil {
+		logger.Fatal("Failed to open audit log", zap.Error(err))
+	}
+
 	cleanupScheduler := scheduler.NewCleanupScheduler(cleanupService, logger)
 	handler := handlers.NewCleanupHandler(cleanupService, logger)
+	reconcileHandler := handlers.NewReconcileHandler(reconcileService, logger)
 
-	// Start event consumer
+	// Start event consumer; it runs until StopEventConsumer during shutdown
 	go func() {
 		if err := cleanupService.StartEventConsumer(ctx); err != nil {
-			logger.Fatalf("Event consumer failed: %v", err)
+			logger.Fatal("Event consumer failed", zap.Error(err))
 		}
 	}()
 
 	// Start scheduler
 	go cleanupScheduler.Start(ctx)
+	if cfg.ReconcileInterval > 0 {
+		go scheduler.NewReconcileScheduler(reconcileService, cfg.ReconcileInterval, func() reconcile.Options {
+			cur := cfgStore.Current()
+			return reconcile.Options{PageSize: cur.ReconcilePageSize, Repair: cur.ReconcileRepair}
+		}, logger).Start(ctx)
+	}
+
+	spec, err := openapi.ForService(openapi.ServiceCleanup)
+	if err != nil {
+		logger.Fatal("Failed to load OpenAPI spec", zap.Error(err))
+	}
+	validate, err := openapi.Middleware(spec)
+	if err != nil {
+		logger.Fatal("Failed to create request validator", zap.Error(err))
+	}
+
+	probe := health.NewProbe(map[string]health.Check{
+		"mysql":             mysqlDB.PingContext,
+		"mongodb":           health.Mongo(mongoClient),
+		"retrieval-mongodb": health.Mongo(retrieveMongoClient),
+		"analytics-mongodb": health.Mongo(analyticsMongoClient),
+		"retrieval-redis": func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		},
+		"rabbitmq": rabbitConn.Check,
+	})
 
 	// Set up router
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware("cleanup-service"))
+	r.Use(requestid.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Post("/api/cleanup/run", handler.RunCleanup)
-	r.Get("/api/cleanup/status", handler.GetStatus)
+	r.Group(func(r chi.Router) {
+		r.Use(validate)
+		r.Get("/openapi.json", openapi.Handler(spec))
+		r.Handle("/metrics", promhttp.Handler())
+		r.Get("/healthz", health.LiveHandler())
+		r.Get("/readyz", probe.ReadyHandler())
+	})
+	// Everything else is the admin API; callers are authenticated before
+	// their request is validated so anonymous callers learn nothing about it
+	r.Group(func(r chi.Router) {
+		r.Use(authenticator.Middleware("cleanup-service", auditLogger))
+		r.Use(validate)
+		r.Post("/api/cleanup/run", handler.RunCleanup)
+		r.Get("/api/cleanup/status", handler.GetStatus)
+		r.Mount("/admin/dlq", dlq.NewRouter(dlqAdmin))
+		r.Get("/admin/reconcile", reconcileHandler.Report)
+		r.Post("/admin/pastes/{url}/expire", handler.ExpirePaste)
+		r.Delete("/admin/pastes/{url}", handler.DeletePaste)
+		r.Post("/admin/reconcile", reconcileHandler.Start)
+		r.Handle("/admin/log-level", logging.LevelHandler(logLevel))
+		r.Get("/admin/config", cfgStore.Handler())
+		r.Post("/admin/config/reload", cfgStore.ReloadHandler())
+	})
 
 	// Start server
 	server := &http.Server{
@@ -119,22 +265,36 @@ func main() {
 	}
 
 	go func() {
-		logger.Infof("Starting server on :%s", cfg.Port)
+		logger.Info("Starting server", zap.String("port", cfg.Port))
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Server failed: %v", err)
+			logger.Fatal("Server failed", zap.Error(err))
 		}
 	}()
 
-	// Graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
-
-	logger.Info("Shutting down server...")
-	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Errorf("Server shutdown failed: %v", err)
+	// Graceful shutdown: leave the load balancer, finish the events in
+	// flight, stop the schedulers and requests, then disconnect
+	sig := lifecycle.WaitForSignal()
+	logger.Info("Shutting down", zap.Stringer("signal", sig))
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	err = lifecycle.Shutdown(shutdownCtx, logger,
+		lifecycle.Drain(probe, cfg.ShutdownDelay),
+		lifecycle.Close("consumer", cleanupService.StopEventConsumer),
+		lifecycle.Close("schedulers", func() error { cancel(); return nil }),
+		lifecycle.Step{Name: "http", Stop: server.Shutdown},
+		lifecycle.Close("dead-letter admin", dlqAdmin.Close),
+		lifecycle.Close("publisher", publisher.Close),
+		lifecycle.Step{Name: "mongodb", Stop: mongoClient.Disconnect},
+		lifecycle.Step{Name: "retrieval mongodb", Stop: retrieveMongoClient.Disconnect},
+		lifecycle.Step{Name: "analytics mongodb", Stop: analyticsMongoClient.Disconnect},
+		lifecycle.Close("mysql", mysqlDB.Close),
+		lifecycle.Close("retrieval redis", redisClient.Close),
+		lifecycle.Close("rabbitmq", rabbitConn.Close),
+		lifecycle.Close("audit log", closeAuditLog),
+	)
+	if err != nil {
+		logger.Error("Shutdown did not complete", zap.Error(err))
+		return
 	}
 	logger.Info("Server stopped")
 }
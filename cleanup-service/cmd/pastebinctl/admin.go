@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/dlq"
+)
+
+func (c *cli) cleanup(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("cleanup: expected run or status")
+	}
+	switch args[0] {
+	case "run":
+		fs := flag.NewFlagSet("cleanup run", flag.ContinueOnError)
+		dryRun := fs.Bool("dry-run", false, "list the pastes that would be deleted without deleting them")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		path := "/api/cleanup/run"
+		if *dryRun {
+			path += "?dry_run=true"
+		}
+		var out map[string]interface{}
+		if err := c.call("cleanup", http.MethodPost, path, nil, &out); err != nil {
+			return err
+		}
+		return c.print(out)
+	case "status":
+		var out map[string]interface{}
+		if err := c.call("cleanup", http.MethodGet, "/api/cleanup/status", nil, &out); err != nil {
+			return err
+		}
+		return c.print(out)
+	default:
+		return fmt.Errorf("cleanup: unknown command %q", args[0])
+	}
+}
+
+func (c *cli) dlq(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("dlq: expected list or replay")
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("dlq list", flag.ContinueOnError)
+		queue := fs.String("queue", "", "list the dead letters of this work queue")
+		limit := fs.Int("limit", 50, "maximum number of messages to list")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *queue == "" {
+			return c.dlqStats()
+		}
+		return c.dlqMessages(*queue, *limit)
+	case "replay":
+		fs := flag.NewFlagSet("dlq replay", flag.ContinueOnError)
+		queue := fs.String("queue", "", "work queue whose dead letters to replay")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *queue == "" {
+			return fmt.Errorf("dlq replay: -queue is required")
+		}
+		service, err := c.queueOwner(*queue)
+		if err != nil {
+			return err
+		}
+		var out map[string]interface{}
+		path := "/admin/dlq/" + url.PathEscape(*queue) + "/replay"
+		if err := c.call(service, http.MethodPost, path, map[string][]string{"ids": fs.Args()}, &out); err != nil {
+			return err
+		}
+		return c.print(out)
+	default:
+		return fmt.Errorf("dlq: unknown command %q", args[0])
+	}
+}
+
+type serviceStats struct {
+	Service string `json:"service"`
+	dlq.QueueStats
+}
+
+// dlqStats lists dead-letter counts of every service. Unreachable services
+// are reported on stderr and skipped.
+func (c *cli) dlqStats() error {
+	var all []serviceStats
+	for _, service := range c.serviceNames() {
+		var stats []dlq.QueueStats
+		if err := c.call(service, http.MethodGet, "/admin/dlq/", nil, &stats); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "warning: %v\n", err)
+			continue
+		}
+		for _, s := range stats {
+			all = append(all, serviceStats{Service: service, QueueStats: s})
+		}
+	}
+
+	rows := make([][]string, len(all))
+	for i, s := range all {
+		rows[i] = []string{s.Service, s.Queue, s.DeadLetterQueue, strconv.Itoa(s.Messages)}
+	}
+	return c.table(all, []string{"SERVICE", "QUEUE", "DEAD LETTER QUEUE", "MESSAGES"}, rows)
+}
+
+func (c *cli) dlqMessages(queue string, limit int) error {
+	service, err := c.queueOwner(queue)
+	if err != nil {
+		return err
+	}
+	var msgs []dlq.Message
+	path := fmt.Sprintf("/admin/dlq/%s/messages?limit=%d", url.PathEscape(queue), limit)
+	if err := c.call(service, http.MethodGet, path, nil, &msgs); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(msgs))
+	for i, m := range msgs {
+		rows[i] = []string{m.ID, m.RoutingKey, strconv.Itoa(m.Attempts),
+			m.DeadLetteredAt.Format("2006-01-02 15:04:05"), m.Error}
+	}
+	return c.table(msgs, []string{"ID", "ROUTING KEY", "ATTEMPTS", "DEAD LETTERED", "ERROR"}, rows)
+}
+
+// queueOwner finds the service whose DLQ admin manages queue.
+func (c *cli) queueOwner(queue string) (string, error) {
+	for _, service := range c.serviceNames() {
+		var stats []dlq.QueueStats
+		if err := c.call(service, http.MethodGet, "/admin/dlq/", nil, &stats); err != nil {
+			continue
+		}
+		for _, s := range stats {
+			if s.Queue == queue {
+				return service, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no reachable service manages queue %q", queue)
+}
+
+func (c *cli) serviceNames() []string {
+	names := make([]string, 0, len(c.services))
+	for name := range c.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/auth"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// call sends a request to an admin API and decodes the JSON response into out.
+func (c *cli) call(service, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	url := strings.TrimRight(c.services[service], "/") + path
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := c.authenticate(req); err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: failed to read response: %w", service, err)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s: %s %s: %s", service, method, path, apiErr.Message)
+		}
+		return fmt.Errorf("%s: %s %s: %s: %s", service, method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", service, err)
+	}
+	return nil
+}
+
+// authenticate adds the configured admin credentials to req, preferring an
+// HMAC signature over a bearer token.
+func (c *cli) authenticate(req *http.Request) error {
+	if c.adminKey != "" {
+		name, secret, ok := strings.Cut(c.adminKey, ":")
+		if !ok {
+			return fmt.Errorf("PASTEBINCTL_ADMIN_HMAC_KEY must be name:secret")
+		}
+		return auth.Sign(req, name, secret, time.Now())
+	}
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Command pastebinctl is the operator CLI for pastebin-ms.
+//
+// Store lookups read MySQL, the retrieval and analytics Mongo databases, the
+// cleanup tasks and Redis directly, configured through the same environment
+// (or .env file) as cleanup-service. Everything else goes through the
+// services' admin APIs, which require credentials, read from
+// PASTEBINCTL_ADMIN_TOKEN (a bearer token) or PASTEBINCTL_ADMIN_HMAC_KEY
+// (name:secret of an HMAC key); they are not flags so they stay out of the
+// process list. The former names PASTEBINCTL_CLEANUP_TOKEN and
+// PASTEBINCTL_CLEANUP_HMAC_KEY are still read.
+//
+//	pastebinctl [-o text|json] <command> [flags] [args]
+//
+//	lookup <url>             show a paste in every store
+//	expire <url>             force-expire a paste and delete it now
+//	delete <url>             delete a paste from every store now
+//	cleanup run [-dry-run]   run cleanup, or list what it would delete
+//	cleanup status           show the last cleanup run
+//	dlq list [-queue q]      dead-letter counts, or the messages of one queue
+//	dlq replay -queue q [id...]
+//	                         replay the given dead letters, or all of them
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type cli struct {
+	json     bool
+	services map[string]string
+	// adminToken and adminKey authenticate calls to the admin APIs
+	adminToken string
+	adminKey   string
+}
+
+func main() {
+	output := flag.String("o", "text", "output format: text or json")
+	services := map[string]*string{
+		"create":    flag.String("create-url", envOr("PASTEBINCTL_CREATE_URL", "http://localhost:8081"), "create-service base URL"),
+		"retrieval": flag.String("retrieval-url", envOr("PASTEBINCTL_RETRIEVAL_URL", "http://localhost:8082"), "retrieval-service base URL"),
+		"analytics": flag.String("analytics-url", envOr("PASTEBINCTL_ANALYTICS_URL", "http://localhost:8085"), "analytics-service base URL"),
+		"cleanup":   flag.String("cleanup-url", envOr("PASTEBINCTL_CLEANUP_URL", "http://localhost:8084"), "cleanup-service base URL"),
+	}
+	flag.Usage = usage
+	flag.Parse()
+
+	if *output != "text" && *output != "json" {
+		fatalf("unknown output format %q", *output)
+	}
+	c := &cli{
+		json:       *output == "json",
+		services:   map[string]string{},
+		adminToken: envOr("PASTEBINCTL_ADMIN_TOKEN", os.Getenv("PASTEBINCTL_CLEANUP_TOKEN")),
+		adminKey:   envOr("PASTEBINCTL_ADMIN_HMAC_KEY", os.Getenv("PASTEBINCTL_CLEANUP_HMAC_KEY")),
+	}
+	for name, url := range services {
+		c.services[name] = *url
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "lookup":
+		err = c.lookup(args[1:])
+	case "expire":
+		err = c.expire(args[1:])
+	case "delete":
+		err = c.delete(args[1:])
+	case "cleanup":
+		err = c.cleanup(args[1:])
+	case "dlq":
+		err = c.dlq(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: pastebinctl [flags] <command> [args]
+
+commands:
+  lookup <url>               show a paste in every store
+  expire <url>               force-expire a paste
+  delete <url>               delete a paste from every store
+  cleanup run [-dry-run]     run cleanup, or list what it would delete
+  cleanup status             show the last cleanup run
+  dlq list [-queue q]        dead-letter counts, or the messages of one queue
+  dlq replay -queue q [id...]  replay dead letters
+
+flags:`)
+	flag.PrintDefaults()
+}
+
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "pastebinctl: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// oneArg parses fs and returns its single positional argument.
+func oneArg(fs *flag.FlagSet, args []string, name string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("%s: expected exactly one %s", fs.Name(), name)
+	}
+	return fs.Arg(0), nil
+}
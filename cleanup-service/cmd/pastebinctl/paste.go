@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"time"
+
+	"cleanup-service/config"
+	"cleanup-service/internal/domain/paste"
+	"cleanup-service/internal/repository"
+	"github.com/go-redis/redis/v8"
+	_ "github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lookupResult shows one paste as each store sees it. A nil entry means the
+// store has no record; failures to reach a store are listed in Errors.
+type lookupResult struct {
+	URL         string                  `json:"url"`
+	MySQL       *paste.Paste            `json:"mysql"`
+	Retrieval   *paste.Paste            `json:"retrieval"`
+	Redis       json.RawMessage         `json:"redis"`
+	RedisTTL    string                  `json:"redis_ttl,omitempty"`
+	CleanupTask *repository.CleanupTask `json:"cleanup_task"`
+	Analytics   *repository.PasteStats  `json:"analytics"`
+	Errors      map[string]string       `json:"errors,omitempty"`
+}
+
+func (c *cli) lookup(args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	pasteURL, err := oneArg(fs, args, "paste url")
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res := lookupResult{URL: pasteURL, Errors: map[string]string{}}
+	fail := func(store string, err error) {
+		res.Errors[store] = err.Error()
+	}
+
+	if db, err := sql.Open("mysql", cfg.MySQLDSN); err != nil {
+		fail("mysql", err)
+	} else {
+		defer db.Close()
+		res.MySQL, err = repository.NewMySQLPasteRepository(db).FindByURL(ctx, pasteURL)
+		if err != nil {
+			fail("mysql", err)
+		}
+	}
+
+	if client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.RetrieveMongoURI)); err != nil {
+		fail("retrieval", err)
+	} else {
+		defer client.Disconnect(context.Background())
+		res.Retrieval, err = repository.NewMongoRetrievalRepository(client, cfg.RetrieveMongoDBName).FindByURL(ctx, pasteURL)
+		if err != nil {
+			fail("retrieval", err)
+		}
+	}
+
+	if client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI)); err != nil {
+		fail("cleanup", err)
+	} else {
+		defer client.Disconnect(context.Background())
+		res.CleanupTask, err = repository.NewMongoCleanupRepository(client, cfg.MongoDBName).FindTask(ctx, pasteURL)
+		if err != nil {
+			fail("cleanup", err)
+		}
+	}
+
+	if client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.AnalyticsMongoURI)); err != nil {
+		fail("analytics", err)
+	} else {
+		defer client.Disconnect(context.Background())
+		res.Analytics, err = repository.NewMongoAnalyticsRepository(client, cfg.AnalyticsMongoDBName).FindStats(ctx, pasteURL)
+		if err != nil {
+			fail("analytics", err)
+		}
+	}
+
+	if client, err := redisClient(cfg.RetrieveRedisURI); err != nil {
+		fail("redis", err)
+	} else {
+		defer client.Close()
+		val, err := client.Get(ctx, repository.CacheKey(pasteURL)).Bytes()
+		switch {
+		case errors.Is(err, redis.Nil):
+		case err != nil:
+			fail("redis", err)
+		default:
+			res.Redis = val
+			if ttl, err := client.TTL(ctx, repository.CacheKey(pasteURL)).Result(); err == nil && ttl > 0 {
+				res.RedisTTL = ttl.Round(time.Second).String()
+			}
+		}
+	}
+
+	if len(res.Errors) == 0 {
+		res.Errors = nil
+	}
+	if c.json {
+		return c.print(res)
+	}
+	return c.print(map[string]interface{}{
+		"url":          res.URL,
+		"mysql":        summary(res.MySQL),
+		"retrieval":    summary(res.Retrieval),
+		"redis":        presence(res.Redis != nil, res.RedisTTL),
+		"cleanup_task": res.CleanupTask,
+		"analytics":    res.Analytics,
+		"errors":       nilIfEmpty(res.Errors),
+	})
+}
+
+func (c *cli) expire(args []string) error {
+	fs := flag.NewFlagSet("expire", flag.ContinueOnError)
+	pasteURL, err := oneArg(fs, args, "paste url")
+	if err != nil {
+		return err
+	}
+	var out map[string]interface{}
+	if err := c.call("cleanup", http.MethodPost, "/admin/pastes/"+url.PathEscape(pasteURL)+"/expire", nil, &out); err != nil {
+		return err
+	}
+	return c.print(out)
+}
+
+// delete removes the paste through cleanup-service, which also evicts it
+// from the retrieval cache.
+func (c *cli) delete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	pasteURL, err := oneArg(fs, args, "paste url")
+	if err != nil {
+		return err
+	}
+	var out map[string]interface{}
+	if err := c.call("cleanup", http.MethodDelete, "/admin/pastes/"+url.PathEscape(pasteURL), nil, &out); err != nil {
+		return err
+	}
+	return c.print(out)
+}
+
+func redisClient(uri string) (*redis.Client, error) {
+	opt, err := redis.ParseURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opt), nil
+}
+
+func summary(p *paste.Paste) interface{} {
+	if p == nil {
+		return nil
+	}
+	policy := p.ExpirationPolicy.Type
+	if p.ExpirationPolicy.Duration != "" {
+		policy += " " + p.ExpirationPolicy.Duration
+	}
+	if p.ExpirationPolicy.IsRead {
+		policy += " (read)"
+	}
+	return "created " + p.CreatedAt.Format(time.RFC3339) + ", " + policy
+}
+
+func presence(found bool, ttl string) interface{} {
+	if !found {
+		return nil
+	}
+	if ttl == "" {
+		return "cached"
+	}
+	return "cached, expires in " + ttl
+}
+
+func nilIfEmpty(m map[string]string) interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
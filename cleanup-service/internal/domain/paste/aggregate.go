@@ -1,22 +1,24 @@
 package paste
 
 import (
+	"fmt"
 	"time"
 )
 
 // Paste represents a paste entity
 type Paste struct {
-	URL              string
-	Content          string
-	CreatedAt        time.Time
-	ExpirationPolicy ExpirationPolicy
+	ID               string           `bson:"-" json:"id,omitempty"`
+	URL              string           `bson:"url" json:"url"`
+	Content          string           `bson:"content" json:"content"`
+	CreatedAt        time.Time        `bson:"created_at" json:"created_at"`
+	ExpirationPolicy ExpirationPolicy `bson:"expiration_policy" json:"expiration_policy"`
 }
 
 // ExpirationPolicy defines the expiration rules for a paste
 type ExpirationPolicy struct {
-	Type     string
-	Duration string
-	IsRead   bool
+	Type     string `bson:"type" json:"type"`
+	Duration string `bson:"duration,omitempty" json:"duration,omitempty"`
+	IsRead   bool   `bson:"is_read,omitempty" json:"is_read,omitempty"`
 }
 
 // DurationMap maps expiration durations to time.Duration
@@ -31,9 +33,23 @@ var DurationMap = map[string]time.Duration{
 	"1year":     365 * 24 * time.Hour,
 }
 
-// Expiration types
+// Expiration types, as published by create-service
 const (
-	TimedExpiration = "Timed"
-	BurnAfterRead   = "BurnAfterRead"
-	NeverExpires    = "Never"
+	TimedExpiration = "TIMED"
+	BurnAfterRead   = "BURN_AFTER_READ"
+	NeverExpires    = "NEVER"
 )
+
+// ExpiresAt returns when a paste created at createdAt expires under p. ok is
+// false for pastes with no expiry time: NEVER pastes, and burn-after-read
+// pastes until they are read.
+func (p ExpirationPolicy) ExpiresAt(createdAt time.Time) (at time.Time, ok bool, err error) {
+	if p.Type != TimedExpiration {
+		return time.Time{}, false, nil
+	}
+	duration, found := DurationMap[p.Duration]
+	if !found {
+		return time.Time{}, false, fmt.Errorf("invalid duration: %s", p.Duration)
+	}
+	return createdAt.Add(duration), true, nil
+}
@@ -4,19 +4,21 @@ import (
 	"time"
 )
 
+// Domain events decoded from the v1 wire contract by the event bus.
+
 type CreatedEvent struct {
-	ID               string           `json:"id"`
-	URL              string           `json:"url"`
-	Content          string           `json:"content"`
-	CreatedAt        time.Time        `json:"created_at"`
-	ExpirationPolicy ExpirationPolicy `json:"expiration_policy"`
+	ID               string
+	URL              string
+	Content          string
+	CreatedAt        time.Time
+	ExpirationPolicy ExpirationPolicy
 }
 
 type ViewedEvent struct {
-	URL      string    `json:"url"`
-	ViewedAt time.Time `json:"viewed_at"`
+	URL      string
+	ViewedAt time.Time
 }
 
 type BurnAfterReadPasteViewedEvent struct {
-	URL string `json:"url"`
+	URL string
 }
@@ -0,0 +1,63 @@
+package eventbus
+
+import (
+	"cleanup-service/internal/domain/paste"
+	"context"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
+	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// eventSource is the CloudEvents source of events published by this service.
+const eventSource = "/cleanup-service"
+
+// RabbitMQPublisher republishes events on pastebin_events, for example when
+// the reconciler repairs a paste that never reached the read model.
+type RabbitMQPublisher struct {
+	publisher *rabbitmq.Publisher
+	encoder   events.Encoder
+}
+
+func NewRabbitMQPublisher(conn *rabbitmq.Connection, confirmTimeout time.Duration, contentType string,
+	logger *zap.Logger) (*RabbitMQPublisher, error) {
+	publisher, err := rabbitmq.NewPublisher(conn, events.Exchange,
+		rabbitmq.WithConfirmTimeout(confirmTimeout),
+		rabbitmq.WithReturnHandler(func(ret amqp091.Return) {
+			logger.Error("Message returned by broker", logging.RoutingKey(ret.RoutingKey),
+				zap.Uint16("replyCode", ret.ReplyCode), zap.String("replyText", ret.ReplyText))
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &RabbitMQPublisher{
+		publisher: publisher,
+		encoder:   events.Encoder{Source: eventSource, ContentType: contentType},
+	}, nil
+}
+
+// PublishPasteCreated publishes p as a new paste.created event. Consumers
+// upsert on it, so republishing an existing paste is harmless.
+func (p *RabbitMQPublisher) PublishPasteCreated(ctx context.Context, pst paste.Paste) error {
+	msg, err := p.encoder.Encode(v1.PasteCreated{
+		ID:         pst.ID,
+		URL:        pst.URL,
+		Content:    pst.Content,
+		CreatedAt:  pst.CreatedAt,
+		PolicyType: v1.PolicyType(pst.ExpirationPolicy.Type),
+		Duration:   pst.ExpirationPolicy.Duration,
+	})
+	if err != nil {
+		return err
+	}
+	return p.publisher.Publish(ctx, events.RoutingKeyPasteCreated, msg)
+}
+
+func (p *RabbitMQPublisher) Close() error {
+	return p.publisher.Close()
+}
@@ -2,49 +2,103 @@ package eventbus
 
 import (
 	"cleanup-service/internal/domain/paste"
+	"cleanup-service/internal/metrics"
 	"context"
-	"encoding/json"
 	"fmt"
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/ArsiHien/pastebin-ms/pkg/dedup"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
 	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"sync/atomic"
 )
 
 // EventConsumer defines operations for consuming events
 type EventConsumer interface {
-	Consume(ctx context.Context, handler func(event interface{}) error) error
+	Consume(ctx context.Context, handler func(ctx context.Context, event interface{}) error) error
 	Close() error
 }
 
 // RabbitMQConsumer implements EventConsumer with RabbitMQ
 type RabbitMQConsumer struct {
-	conn    *amqp091.Connection
-	channel *amqp091.Channel
+	consumer *rabbitmq.Consumer
+	retrier  *rabbitmq.Retrier
+	retry    rabbitmq.RetryPolicy
+	decoder  events.Decoder
+	dedup    *dedup.Store
+	logger   *zap.Logger
+
+	// done is closed when Consume returns, so Close can wait for the
+	// deliveries in flight to be handled
+	consuming atomic.Bool
+	done      chan struct{}
 }
 
-func NewRabbitMQConsumer(conn *amqp091.Connection) (*RabbitMQConsumer, error) {
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open channel: %w", err)
-	}
+const cleanupQueue = "cleanup.events"
 
-	err = ch.ExchangeDeclare(
-		"pastebin_events", // Update exchange name
-		"topic",
-		true,  // durable
-		false, // autoDelete
-		false, // internal
-		false, // noWait
-		nil,
+// NewRabbitMQConn dials RabbitMQ and keeps the connection alive, re-declaring
+// the pastebin_events exchange after every reconnect.
+func NewRabbitMQConn(uri string, logger *zap.Logger) (*rabbitmq.Connection, error) {
+	reconnecting := false
+	return rabbitmq.Dial(uri,
+		rabbitmq.WithTopology(func(ch *amqp091.Channel) error {
+			return events.DeclareExchange(ch)
+		}),
+		rabbitmq.WithStateHandler(func(connected bool, err error) {
+			if connected {
+				metrics.RabbitMQConnected.Set(1)
+				if reconnecting {
+					metrics.RabbitMQReconnects.Inc()
+					logger.Info("Reconnected to RabbitMQ")
+				}
+				reconnecting = false
+				return
+			}
+			metrics.RabbitMQConnected.Set(0)
+			reconnecting = true
+			logger.Error("RabbitMQ connection unavailable", zap.Error(err))
+		}),
 	)
+}
+
+func NewRabbitMQConsumer(conn *rabbitmq.Connection, retry rabbitmq.RetryPolicy, decoder events.Decoder,
+	dedup *dedup.Store, logger *zap.Logger) (*RabbitMQConsumer, error) {
+	retrier, err := rabbitmq.NewRetrier(conn, cleanupQueue, retry)
 	if err != nil {
-		err := ch.Close()
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+		return nil, fmt.Errorf("failed to create retrier: %w", err)
+	}
+
+	c := &RabbitMQConsumer{retrier: retrier, retry: retry, decoder: decoder, dedup: dedup, logger: logger,
+		done: make(chan struct{})}
+	c.consumer = conn.NewConsumer(rabbitmq.ConsumerOptions{
+		Queue: cleanupQueue,
+		Setup: c.declare,
+		OnError: func(err error) {
+			logger.Error("Failed to subscribe", zap.String("queue", cleanupQueue), zap.Error(err))
+		},
+	})
+	return c, nil
+}
+
+// QueueName returns the queue this consumer reads from.
+func (c *RabbitMQConsumer) QueueName() string {
+	return cleanupQueue
+}
+
+// declare sets up the exchange, queue, bindings and the retry and dead-letter
+// queues; it runs on every new channel.
+func (c *RabbitMQConsumer) declare(ch *amqp091.Channel) error {
+	if err := events.DeclareExchange(ch); err != nil {
+		return err
+	}
+	if err := rabbitmq.DeclareRetryTopology(ch, cleanupQueue, c.retry); err != nil {
+		return err
 	}
 
 	q, err := ch.QueueDeclare(
-		"cleanup.events",
+		cleanupQueue,
 		true,  // durable
 		false, // autoDelete
 		false, // exclusive
@@ -52,115 +106,143 @@ func NewRabbitMQConsumer(conn *amqp091.Connection) (*RabbitMQConsumer, error) {
 		nil,
 	)
 	if err != nil {
-		err := ch.Close()
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
-	// Update routing keys to match the new publisher's routing keys
-	for _, key := range []string{"paste.created", "paste.burn_after_read_paste_viewed"} {
+	for _, key := range []string{events.RoutingKeyPasteCreated, events.RoutingKeyBurnAfterReadPasteViewed} {
 		err = ch.QueueBind(
 			q.Name,
 			key,
-			"pastebin_events", // Update exchange name
+			events.Exchange,
 			false,
 			nil,
 		)
 		if err != nil {
-			err := ch.Close()
-			if err != nil {
-				return nil, err
-			}
-			return nil, fmt.Errorf("failed to bind queue: %w", err)
+			return fmt.Errorf("failed to bind queue: %w", err)
 		}
 	}
+	return nil
+}
 
-	return &RabbitMQConsumer{
-		conn:    conn,
-		channel: ch,
-	}, nil
+// Consume blocks until ctx is done or Close is called, resubscribing
+// whenever the channel or connection is lost. Cancelling ctx only stops the
+// subscription; deliveries already received are still handled to the end.
+func (c *RabbitMQConsumer) Consume(ctx context.Context, handler func(ctx context.Context, event interface{}) error) error {
+	c.consuming.Store(true)
+	defer close(c.done)
+
+	handleCtx := context.WithoutCancel(ctx)
+	err := c.consumer.Run(ctx, func(msgs <-chan amqp091.Delivery) {
+		for msg := range msgs {
+			c.handle(handleCtx, msg, handler)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
 }
 
-func (c *RabbitMQConsumer) Consume(ctx context.Context, handler func(event interface{}) error) error {
-	msgs, err := c.channel.Consume(
-		"cleanup.events",
-		"",    // consumer
-		false, // autoAck
-		false, // exclusive
-		false, // noLocal
-		false, // noWait
-		nil,
-	)
+func (c *RabbitMQConsumer) handle(ctx context.Context, msg amqp091.Delivery,
+	handler func(ctx context.Context, event interface{}) error) {
+	// The span continues the trace of the request that published the event
+	ctx, span := rabbitmq.StartConsumeSpan(ctx, cleanupQueue, msg)
+	defer span.End()
+	logger := c.logger.With(logging.RequestID(rabbitmq.RequestID(msg)))
+
+	event, id, err := c.decode(msg)
 	if err != nil {
-		return fmt.Errorf("failed to consume messages: %w", err)
+		logger.Error("Dead-lettering undecodable message", zap.Error(err))
+		if err := c.retrier.DeadLetter(ctx, msg, err); err != nil {
+			logger.Error("Failed to dead-letter message", zap.Error(err))
+		}
+		return
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case msg := <-msgs:
-			var event interface{}
-			switch msg.RoutingKey {
-			case "paste.created":
-				var e paste.CreatedEvent
-				if err := json.Unmarshal(msg.Body, &e); err != nil {
-					err := msg.Nack(false, true)
-					if err != nil {
-						return err
-					}
-					continue
-				}
-				event = e
-			case "paste.viewed":
-				var e paste.ViewedEvent
-				if err := json.Unmarshal(msg.Body, &e); err != nil {
-					err := msg.Nack(false, true)
-					if err != nil {
-						return err
-					}
-					continue
-				}
-				event = e
-			case "paste.burn_after_read_paste_viewed":
-				var e paste.BurnAfterReadPasteViewedEvent
-				if err := json.Unmarshal(msg.Body, &e); err != nil {
-					err := msg.Nack(false, true)
-					if err != nil {
-						return err
-					}
-					continue
-				}
-				event = e
-			default:
-				err := msg.Nack(false, true)
-				if err != nil {
-					return err
-				}
-				continue
+	if id != "" {
+		seen, err := c.dedup.Seen(ctx, id)
+		if err != nil {
+			logger.Error("Failed to check processed messages, scheduling retry", zap.Error(err))
+			if err := c.retrier.Retry(ctx, msg, err); err != nil {
+				logger.Error("Failed to schedule retry", zap.Error(err))
 			}
+			return
+		}
+		if seen {
+			logger.Info("Skipping duplicate event", zap.String("eventID", id))
+			metrics.DuplicateMessages.WithLabelValues(cleanupQueue).Inc()
+			_ = msg.Ack(false)
+			return
+		}
+	}
 
-			if err := handler(event); err != nil {
-				err := msg.Nack(false, true)
-				if err != nil {
-					return err
-				}
-				continue
-			}
+	if err := handler(ctx, event); err != nil {
+		logger.Error("Handler error, scheduling retry", zap.Int("attempt", rabbitmq.Attempts(msg)+1),
+			zap.Error(err))
+		if err := c.retrier.Retry(ctx, msg, err); err != nil {
+			logger.Error("Failed to schedule retry", zap.Error(err))
+		}
+		return
+	}
 
-			err := msg.Ack(false)
-			if err != nil {
-				return err
-			}
+	if id != "" {
+		if err := c.dedup.MarkProcessed(ctx, id); err != nil {
+			logger.Error("Failed to record processed event", zap.String("eventID", id), zap.Error(err))
+		}
+	}
+	_ = msg.Ack(false)
+}
+
+// decode maps a message onto the domain event for its routing key and
+// returns the event's message ID alongside it.
+func (c *RabbitMQConsumer) decode(msg amqp091.Delivery) (interface{}, string, error) {
+	switch key := rabbitmq.RoutingKey(msg); key {
+	case events.RoutingKeyPasteCreated:
+		var e v1.PasteCreated
+		env, err := c.decoder.Decode(msg, &e)
+		if err != nil {
+			return nil, "", err
+		}
+		return paste.CreatedEvent{
+			ID:        e.ID,
+			URL:       e.URL,
+			Content:   e.Content,
+			CreatedAt: e.CreatedAt,
+			ExpirationPolicy: paste.ExpirationPolicy{
+				Type:     string(e.PolicyType),
+				Duration: e.Duration,
+			},
+		}, env.ID, nil
+	case events.RoutingKeyPasteViewed:
+		var e v1.PasteViewed
+		env, err := c.decoder.Decode(msg, &e)
+		if err != nil {
+			return nil, "", err
 		}
+		return paste.ViewedEvent{URL: e.URL, ViewedAt: e.ViewedAt}, env.ID, nil
+	case events.RoutingKeyBurnAfterReadPasteViewed:
+		var e v1.BurnAfterReadPasteViewed
+		env, err := c.decoder.Decode(msg, &e)
+		if err != nil {
+			return nil, "", err
+		}
+		return paste.BurnAfterReadPasteViewedEvent{URL: e.URL}, env.ID, nil
+	default:
+		return nil, "", fmt.Errorf("unknown routing key %q", key)
 	}
 }
 
+// Close cancels the subscription, waits for Consume to finish the
+// deliveries already received and closes the retry publisher.
 func (c *RabbitMQConsumer) Close() error {
-	if err := c.channel.Close(); err != nil {
-		return fmt.Errorf("failed to close channel: %w", err)
+	if err := c.consumer.Stop(); err != nil {
+		return fmt.Errorf("failed to stop consumer: %w", err)
+	}
+	if c.consuming.Load() {
+		<-c.done
+	}
+	if err := c.retrier.Close(); err != nil {
+		return fmt.Errorf("failed to close retry publisher: %w", err)
 	}
 	return nil
 }
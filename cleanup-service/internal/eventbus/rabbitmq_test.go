@@ -0,0 +1,110 @@
+package eventbus
+
+import (
+	"cleanup-service/internal/domain/paste"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// fixture wraps a payload from the shared contract module in a v1
+// CloudEvent so that this consumer is tested against exactly what the
+// producers emit.
+func fixture(t *testing.T, routingKey string) amqp091.Delivery {
+	t.Helper()
+	return fixtureFile(t, routingKey, routingKey)
+}
+
+// fixtureFile is fixture for one of several fixtures of a routing key.
+func fixtureFile(t *testing.T, name, routingKey string) amqp091.Delivery {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("..", "..", "..", "events", "testdata", "v1", name+".json"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	msg := events.NewEnvelope("/test", routingKey, v1.Version).Publishing(body)
+	return amqp091.Delivery{
+		RoutingKey:  routingKey,
+		Headers:     msg.Headers,
+		ContentType: msg.ContentType,
+		MessageId:   msg.MessageId,
+		Body:        body,
+	}
+}
+
+func newTestConsumer(acceptBare bool) *RabbitMQConsumer {
+	return &RabbitMQConsumer{decoder: events.Decoder{AcceptBareJSON: acceptBare}}
+}
+
+func TestDecodeCreatedEvent(t *testing.T) {
+	for _, tt := range []struct {
+		file    string
+		policy  string
+		expires bool
+	}{
+		{"paste.created", paste.TimedExpiration, true},
+		{"paste.created.never", paste.NeverExpires, false},
+		{"paste.created.burn_after_read", paste.BurnAfterRead, false},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			event, _, err := newTestConsumer(false).decode(fixtureFile(t, tt.file, events.RoutingKeyPasteCreated))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			e, ok := event.(paste.CreatedEvent)
+			if !ok {
+				t.Fatalf("got %T, want paste.CreatedEvent", event)
+			}
+			if e.URL == "" || e.CreatedAt.IsZero() {
+				t.Errorf("missing fields: %+v", e)
+			}
+			if e.ExpirationPolicy.Type != tt.policy {
+				t.Errorf("policy type = %q, want %q", e.ExpirationPolicy.Type, tt.policy)
+			}
+			// A cleanup task without expiry is never picked up by FindExpired
+			at, expires, err := e.ExpirationPolicy.ExpiresAt(e.CreatedAt)
+			if err != nil {
+				t.Fatalf("ExpiresAt: %v", err)
+			}
+			if expires != tt.expires || at.IsZero() == tt.expires {
+				t.Errorf("ExpiresAt = %v, %v; want expiry %v", at, expires, tt.expires)
+			}
+		})
+	}
+}
+
+func TestDecodeBurnAfterReadPasteViewedEvent(t *testing.T) {
+	event, _, err := newTestConsumer(false).decode(fixture(t, events.RoutingKeyBurnAfterReadPasteViewed))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e, ok := event.(paste.BurnAfterReadPasteViewedEvent); !ok || e.URL == "" {
+		t.Errorf("got %#v", event)
+	}
+}
+
+func TestDecodeRetriedMessageUsesOriginalRoutingKey(t *testing.T) {
+	d := fixture(t, events.RoutingKeyBurnAfterReadPasteViewed)
+	d.RoutingKey = cleanupQueue
+	d.Headers["x-original-routing-key"] = events.RoutingKeyBurnAfterReadPasteViewed
+	if _, _, err := newTestConsumer(false).decode(d); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+}
+
+func TestDecodeBareJSON(t *testing.T) {
+	d := fixture(t, events.RoutingKeyPasteCreated)
+	d.Headers = nil
+
+	if _, _, err := newTestConsumer(true).decode(d); err != nil {
+		t.Fatalf("compatibility mode should accept bare JSON: %v", err)
+	}
+	if _, _, err := newTestConsumer(false).decode(d); !errors.Is(err, events.ErrNotCloudEvent) {
+		t.Fatalf("err = %v, want ErrNotCloudEvent", err)
+	}
+}
@@ -1,30 +1,54 @@
 package handlers
 
 import (
-	"cleanup-service/shared"
 	"encoding/json"
 	"net/http"
+	"strconv"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/go-chi/chi/v5"
 
 	"cleanup-service/internal/service/cleanup"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"go.uber.org/zap"
 )
 
 type CleanupHandler struct {
 	service *cleanup.Service
-	logger  *shared.Logger
+	logger  *zap.Logger
 }
 
-func NewCleanupHandler(service *cleanup.Service, logger *shared.Logger) *CleanupHandler {
+func NewCleanupHandler(service *cleanup.Service, logger *zap.Logger) *CleanupHandler {
 	return &CleanupHandler{
 		service: service,
 		logger:  logger,
 	}
 }
 
+// RunCleanup deletes expired pastes. With ?dry_run=true it only lists them.
 func (h *CleanupHandler) RunCleanup(w http.ResponseWriter, r *http.Request) {
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run")); dryRun {
+		urls, err := h.service.DryRun(r.Context())
+		if err != nil {
+			requestLogger(h.logger, r).Error("Failed to run cleanup dry run", zap.Error(err))
+			apierror.Write(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if urls == nil {
+			urls = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"dry_run": true,
+			"urls":    urls,
+		})
+		return
+	}
+
 	count, err := h.service.RunCleanup(r.Context())
 	if err != nil {
-		h.logger.Errorf("Failed to run cleanup: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		requestLogger(h.logger, r).Error("Failed to run cleanup", zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -46,3 +70,33 @@ func (h *CleanupHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// ExpirePaste force-expires a paste and deletes it right away.
+func (h *CleanupHandler) ExpirePaste(w http.ResponseWriter, r *http.Request) {
+	url := chi.URLParam(r, "url")
+	if err := h.service.ExpirePaste(r.Context(), url); err != nil {
+		requestLogger(h.logger, r).Error("Failed to expire paste", zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"url": url, "expired": true})
+}
+
+// DeletePaste removes a paste from every store right away. Stores that no
+// longer hold the paste are reported in "errors" but do not fail the request.
+func (h *CleanupHandler) DeletePaste(w http.ResponseWriter, r *http.Request) {
+	url := chi.URLParam(r, "url")
+	response := map[string]interface{}{"url": url, "deleted": true}
+	if err := h.service.DeletePaste(r.Context(), url); err != nil {
+		requestLogger(h.logger, r).Error("Force delete incomplete", logging.URL(url), zap.Error(err))
+		response["errors"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// requestLogger tags logger with the ID of the request being served.
+func requestLogger(logger *zap.Logger, r *http.Request) *zap.Logger {
+	return logging.FromContext(r.Context(), logger)
+}
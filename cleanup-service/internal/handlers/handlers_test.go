@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"cleanup-service/internal/domain/paste"
+	"cleanup-service/internal/repository"
+	"cleanup-service/internal/service/cleanup"
+	"cleanup-service/internal/service/reconcile"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi/openapitest"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Fakes embed the repository interfaces so only the methods the handlers
+// reach need implementing.
+
+type fakeMySQL struct {
+	repository.MySQLPasteRepository
+}
+
+func (fakeMySQL) Delete(ctx context.Context, url string) error { return nil }
+func (fakeMySQL) FindPage(ctx context.Context, afterID string, limit int) ([]paste.Paste, error) {
+	return nil, nil
+}
+
+type fakeRetrieval struct{ repository.RetrievalRepository }
+
+// Delete fails for "gone", a paste only some of the stores still hold.
+func (fakeRetrieval) Delete(ctx context.Context, url string) error {
+	if url == "gone" {
+		return errors.New("no paste found with url " + url)
+	}
+	return nil
+}
+func (fakeRetrieval) FindPage(ctx context.Context, afterURL string, limit int) ([]paste.Paste, error) {
+	return nil, nil
+}
+
+type fakeAnalytics struct{ repository.AnalyticsRepository }
+
+func (fakeAnalytics) Delete(ctx context.Context, pasteURL string) error { return nil }
+func (fakeAnalytics) FindStatsPage(ctx context.Context, afterURL string, limit int) ([]repository.URLRecord, error) {
+	return nil, nil
+}
+
+type fakeCleanup struct {
+	repository.CleanupRepository
+	err error
+}
+
+func (f fakeCleanup) FindExpired(ctx context.Context, now time.Time) ([]string, error) {
+	return []string{"abc"}, f.err
+}
+func (f fakeCleanup) DeleteTask(ctx context.Context, url string) error           { return f.err }
+func (f fakeCleanup) Expire(ctx context.Context, url string, at time.Time) error { return f.err }
+func (f fakeCleanup) FindTaskPage(ctx context.Context, afterURL string, limit int) ([]repository.URLRecord, error) {
+	return nil, f.err
+}
+
+type fakeCache struct{}
+
+func (fakeCache) Evict(ctx context.Context, url string) error { return nil }
+
+func newTestRouter(cleanupRepo fakeCleanup) http.Handler {
+	logger := zap.NewNop()
+	cleanupService := cleanup.NewCleanupService(fakeMySQL{}, fakeRetrieval{}, fakeAnalytics{}, cleanupRepo, fakeCache{}, nil, logger)
+	reconcileService := reconcile.NewService(fakeMySQL{}, fakeRetrieval{}, fakeAnalytics{}, cleanupRepo, nil, time.Minute, logger)
+	handler := NewCleanupHandler(cleanupService, logger)
+	reconcileHandler := NewReconcileHandler(reconcileService, logger)
+
+	r := chi.NewRouter()
+	r.Post("/api/cleanup/run", handler.RunCleanup)
+	r.Get("/api/cleanup/status", handler.GetStatus)
+	r.Get("/admin/reconcile", reconcileHandler.Report)
+	r.Post("/admin/reconcile", reconcileHandler.Start)
+	r.Post("/admin/pastes/{url}/expire", handler.ExpirePaste)
+	r.Delete("/admin/pastes/{url}", handler.DeletePaste)
+	return r
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		repo   fakeCleanup
+		want   int
+	}{
+		{"run", http.MethodPost, "/api/cleanup/run", ``, fakeCleanup{}, http.StatusOK},
+		{"dry run", http.MethodPost, "/api/cleanup/run?dry_run=true", ``, fakeCleanup{}, http.StatusOK},
+		{"run failure", http.MethodPost, "/api/cleanup/run", ``, fakeCleanup{err: errors.New("mongo down")}, http.StatusInternalServerError},
+		{"status", http.MethodGet, "/api/cleanup/status", ``, fakeCleanup{}, http.StatusOK},
+		{"expire", http.MethodPost, "/admin/pastes/abc/expire", ``, fakeCleanup{}, http.StatusOK},
+		{"expire failure", http.MethodPost, "/admin/pastes/abc/expire", ``, fakeCleanup{err: errors.New("mongo down")}, http.StatusInternalServerError},
+		{"expire partially stored", http.MethodPost, "/admin/pastes/gone/expire", ``, fakeCleanup{}, http.StatusInternalServerError},
+		{"delete", http.MethodDelete, "/admin/pastes/abc", ``, fakeCleanup{}, http.StatusOK},
+		{"delete partially stored", http.MethodDelete, "/admin/pastes/gone", ``, fakeCleanup{}, http.StatusOK},
+		{"reconcile report", http.MethodGet, "/admin/reconcile", ``, fakeCleanup{}, http.StatusOK},
+		{"reconcile start", http.MethodPost, "/admin/reconcile", `{"page_size":10}`, fakeCleanup{}, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := openapitest.New(t, openapi.ServiceCleanup, newTestRouter(tt.repo))
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := check.Do(req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
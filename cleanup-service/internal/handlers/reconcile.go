@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"cleanup-service/internal/service/reconcile"
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"go.uber.org/zap"
+)
+
+type ReconcileHandler struct {
+	service *reconcile.Service
+	logger  *zap.Logger
+}
+
+func NewReconcileHandler(service *reconcile.Service, logger *zap.Logger) *ReconcileHandler {
+	return &ReconcileHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Start begins a reconciliation in the background. The body is optional:
+// {"page_size": 500, "repair": false}.
+func (h *ReconcileHandler) Start(w http.ResponseWriter, r *http.Request) {
+	var opts reconcile.Options
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Not r.Context(): the request ends long before the reconciliation does
+	if err := h.service.Start(context.Background(), opts); err != nil {
+		if errors.Is(err, reconcile.ErrRunning) {
+			apierror.Write(w, http.StatusConflict, err.Error())
+			return
+		}
+		requestLogger(h.logger, r).Error("Failed to start reconciliation", zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(h.service.Report())
+}
+
+// Report returns the progress of the current run or the result of the last one.
+func (h *ReconcileHandler) Report(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.service.Report())
+}
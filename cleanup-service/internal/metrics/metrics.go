@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	RabbitMQConnected = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cleanup_service_rabbitmq_connected",
+			Help: "Whether the RabbitMQ connection is currently up (1) or reconnecting (0).",
+		},
+	)
+
+	RabbitMQReconnects = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "cleanup_service_rabbitmq_reconnects_total",
+			Help: "Number of successful RabbitMQ reconnects.",
+		},
+	)
+
+	DuplicateMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cleanup_service_duplicate_messages_total",
+			Help: "Number of redelivered messages skipped because they were already processed.",
+		},
+		[]string{"queue"},
+	)
+
+	ReconcileDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cleanup_service_reconcile_drift",
+			Help: "Records found out of sync between stores by the last completed reconciliation, by category.",
+		},
+		[]string{"category"},
+	)
+
+	ReconcileRepaired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cleanup_service_reconcile_repaired_total",
+			Help: "Number of drifted records repaired by the reconciler, by category.",
+		},
+		[]string{"category"},
+	)
+
+	ReconcileLastSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cleanup_service_reconcile_last_success_timestamp_seconds",
+			Help: "Unix time of the last completed reconciliation.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(RabbitMQConnected, RabbitMQReconnects, DuplicateMessages,
+		ReconcileDrift, ReconcileRepaired, ReconcileLastSuccess)
+}
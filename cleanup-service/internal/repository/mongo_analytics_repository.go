@@ -2,14 +2,23 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// PasteStats summarises the analytics kept for one paste.
+type PasteStats struct {
+	ViewCount   int   `json:"view_count"`
+	StoredViews int64 `json:"stored_views"`
+}
+
 type AnalyticsRepository interface {
 	Delete(ctx context.Context, pasteURL string) error
+	FindStatsPage(ctx context.Context, afterURL string, limit int) ([]URLRecord, error)
+	FindStats(ctx context.Context, pasteURL string) (*PasteStats, error)
 }
 
 type MongoAnalyticsRepository struct {
@@ -42,3 +51,30 @@ func (r *MongoAnalyticsRepository) Delete(ctx context.Context, pasteURL string)
 
 	return nil
 }
+
+// FindStatsPage returns up to limit paste URLs that have stats, greater than
+// afterURL, in order, with when the stats were first recorded.
+func (r *MongoAnalyticsRepository) FindStatsPage(ctx context.Context, afterURL string, limit int) ([]URLRecord, error) {
+	return pageRecords(ctx, r.statsCollection, "paste_url", afterURL, limit)
+}
+
+// FindStats returns the analytics kept for pasteURL, or nil if there are none.
+func (r *MongoAnalyticsRepository) FindStats(ctx context.Context, pasteURL string) (*PasteStats, error) {
+	var doc struct {
+		ViewCount int `bson:"view_count"`
+	}
+	err := r.statsCollection.FindOne(ctx, bson.M{"paste_url": pasteURL}).Decode(&doc)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("failed to find stats for %s: %w", pasteURL, err)
+	}
+	hasStats := err == nil
+
+	views, err := r.viewsCollection.CountDocuments(ctx, bson.M{"paste_url": pasteURL})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count views for %s: %w", pasteURL, err)
+	}
+	if !hasStats && views == 0 {
+		return nil, nil
+	}
+	return &PasteStats{ViewCount: doc.ViewCount, StoredViews: views}, nil
+}
@@ -2,17 +2,32 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// CleanupTask is the scheduled deletion of one paste.
+type CleanupTask struct {
+	URL             string    `bson:"url" json:"url"`
+	ExpireAt        time.Time `bson:"expire_at" json:"expire_at"`
+	IsBurnAfterRead bool      `bson:"is_burn_after_read" json:"is_burn_after_read"`
+	IsRead          bool      `bson:"is_read" json:"is_read"`
+}
+
 type CleanupRepository interface {
 	AddTask(ctx context.Context, url string, expireAt time.Time, isBurnAfterRead bool) error
 	MarkRead(ctx context.Context, url string) error
 	FindExpired(ctx context.Context, now time.Time) ([]string, error)
 	DeleteTask(ctx context.Context, url string) error
+	FindTask(ctx context.Context, url string) (*CleanupTask, error)
+	Expire(ctx context.Context, url string, at time.Time) error
+	FindTaskPage(ctx context.Context, afterURL string, limit int) ([]URLRecord, error)
+	ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error)
 }
 
 type MongoCleanupRepository struct {
@@ -25,14 +40,20 @@ func NewMongoCleanupRepository(client *mongo.Client, dbName string) *MongoCleanu
 	}
 }
 
+// AddTask creates the cleanup task for url. It is an upsert so that a
+// redelivered paste.created event neither duplicates the task nor resets one
+// that was already marked read. A zero expireAt stores no expiry, for pastes
+// that only go away when read or deleted.
 func (r *MongoCleanupRepository) AddTask(ctx context.Context, url string, expireAt time.Time, isBurnAfterRead bool) error {
 	task := bson.M{
-		"url":                url,
-		"expire_at":          expireAt,
 		"is_burn_after_read": isBurnAfterRead,
 		"is_read":            false,
 	}
-	_, err := r.collection.InsertOne(ctx, task)
+	if !expireAt.IsZero() {
+		task["expire_at"] = expireAt
+	}
+	update := bson.M{"$setOnInsert": task}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"url": url}, update, options.Update().SetUpsert(true))
 	return err
 }
 
@@ -51,7 +72,9 @@ func (r *MongoCleanupRepository) MarkRead(ctx context.Context, url string) error
 func (r *MongoCleanupRepository) FindExpired(ctx context.Context, now time.Time) ([]string, error) {
 	filter := bson.M{
 		"$or": []bson.M{
-			{"expire_at": bson.M{"$lte": now}},
+			// Tasks written before AddTask skipped zero expiries hold the
+			// zero time; they never expire
+			{"expire_at": bson.M{"$gt": time.Time{}, "$lte": now}},
 			{"is_burn_after_read": true, "is_read": true},
 		},
 	}
@@ -78,3 +101,38 @@ func (r *MongoCleanupRepository) DeleteTask(ctx context.Context, url string) err
 	_, err := r.collection.DeleteOne(ctx, bson.M{"url": url})
 	return err
 }
+
+// FindTask returns the cleanup task for url, or nil if there is none.
+func (r *MongoCleanupRepository) FindTask(ctx context.Context, url string) (*CleanupTask, error) {
+	var task CleanupTask
+	err := r.collection.FindOne(ctx, bson.M{"url": url}).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cleanup task %s: %w", url, err)
+	}
+	return &task, nil
+}
+
+// Expire moves the expiry of url's task to at, creating the task if needed,
+// so the next cleanup run deletes the paste.
+func (r *MongoCleanupRepository) Expire(ctx context.Context, url string, at time.Time) error {
+	update := bson.M{
+		"$set":         bson.M{"expire_at": at},
+		"$setOnInsert": bson.M{"is_burn_after_read": false, "is_read": false},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"url": url}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// FindTaskPage returns up to limit task URLs greater than afterURL, in order,
+// with when each task was created.
+func (r *MongoCleanupRepository) FindTaskPage(ctx context.Context, afterURL string, limit int) ([]URLRecord, error) {
+	return pageRecords(ctx, r.collection, "url", afterURL, limit)
+}
+
+// ExistingURLs reports which of urls have a cleanup task.
+func (r *MongoCleanupRepository) ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	return existingURLs(ctx, r.collection, "url", urls)
+}
@@ -2,15 +2,20 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"cleanup-service/internal/domain/paste"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type RetrievalRepository interface {
-	FindAll(ctx context.Context) ([]paste.Paste, error)
+	FindByURL(ctx context.Context, url string) (*paste.Paste, error)
+	FindPage(ctx context.Context, afterURL string, limit int) ([]paste.Paste, error)
+	ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error)
 	Delete(ctx context.Context, url string) error
 }
 
@@ -24,8 +29,24 @@ func NewMongoRetrievalRepository(client *mongo.Client, dbName string) *MongoRetr
 	}
 }
 
-func (r *MongoRetrievalRepository) FindAll(ctx context.Context) ([]paste.Paste, error) {
-	cursor, err := r.collection.Find(ctx, bson.M{})
+// FindByURL returns the read model document for url, or nil if there is none.
+func (r *MongoRetrievalRepository) FindByURL(ctx context.Context, url string) (*paste.Paste, error) {
+	var p paste.Paste
+	err := r.collection.FindOne(ctx, bson.M{"url": url}).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find paste %s: %w", url, err)
+	}
+	return &p, nil
+}
+
+// FindPage returns up to limit pastes with a URL greater than afterURL,
+// ordered by URL.
+func (r *MongoRetrievalRepository) FindPage(ctx context.Context, afterURL string, limit int) ([]paste.Paste, error) {
+	opts := options.Find().SetSort(bson.M{"url": 1}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"url": bson.M{"$gt": afterURL}}, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find pastes: %w", err)
 	}
@@ -52,3 +73,66 @@ func (r *MongoRetrievalRepository) Delete(ctx context.Context, url string) error
 	}
 	return nil
 }
+
+// ExistingURLs reports which of urls are present in the read model.
+func (r *MongoRetrievalRepository) ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	return existingURLs(ctx, r.collection, "url", urls)
+}
+
+// existingURLs reports which of urls appear in field of collection.
+func existingURLs(ctx context.Context, collection *mongo.Collection, field string, urls []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(urls))
+	if len(urls) == 0 {
+		return found, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{field: 1, "_id": 0})
+	cursor, err := collection.Find(ctx, bson.M{field: bson.M{"$in": urls}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up urls: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		if url, ok := cursor.Current.Lookup(field).StringValueOK(); ok {
+			found[url] = true
+		}
+	}
+	return found, cursor.Err()
+}
+
+// URLRecord is one paste URL found in a store, with the time its record was
+// created there.
+type URLRecord struct {
+	URL       string
+	CreatedAt time.Time
+}
+
+// pageRecords returns up to limit distinct values of field greater than after,
+// in ascending order. The creation time is taken from the ObjectID in _id; it
+// is zero for documents with any other kind of _id.
+func pageRecords(ctx context.Context, collection *mongo.Collection, field, after string, limit int) ([]URLRecord, error) {
+	opts := options.Find().
+		SetSort(bson.M{field: 1}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{field: 1, "_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{field: bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list urls: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []URLRecord
+	for cursor.Next(ctx) {
+		url, ok := cursor.Current.Lookup(field).StringValueOK()
+		if !ok {
+			continue
+		}
+		record := URLRecord{URL: url}
+		if id, ok := cursor.Current.Lookup("_id").ObjectIDOK(); ok {
+			record.CreatedAt = id.Timestamp()
+		}
+		records = append(records, record)
+	}
+	return records, cursor.Err()
+}
@@ -3,11 +3,18 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+
+	"cleanup-service/internal/domain/paste"
 )
 
 type MySQLPasteRepository interface {
 	Delete(ctx context.Context, url string) error
+	FindByURL(ctx context.Context, url string) (*paste.Paste, error)
+	FindPage(ctx context.Context, afterID string, limit int) ([]paste.Paste, error)
+	ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error)
 }
 
 type MySQLPasteRepositoryImpl struct {
@@ -33,3 +40,76 @@ func (r *MySQLPasteRepositoryImpl) Delete(ctx context.Context, url string) error
 	}
 	return nil
 }
+
+// FindByURL returns the paste stored under url, or nil if there is none.
+func (r *MySQLPasteRepositoryImpl) FindByURL(ctx context.Context, url string) (*paste.Paste, error) {
+	query := `SELECT p.id, p.url, p.content, p.created_at, e.policy_type, COALESCE(e.duration, '')
+		FROM pastes p
+		JOIN expiration_policies e ON e.id = p.expiration_policy_id
+		WHERE p.url = ?`
+	var p paste.Paste
+	err := r.db.QueryRowContext(ctx, query, url).Scan(&p.ID, &p.URL, &p.Content, &p.CreatedAt,
+		&p.ExpirationPolicy.Type, &p.ExpirationPolicy.Duration)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find paste %s: %w", url, err)
+	}
+	return &p, nil
+}
+
+// FindPage returns up to limit pastes with an ID greater than afterID, ordered
+// by ID, joined with their expiration policy.
+func (r *MySQLPasteRepositoryImpl) FindPage(ctx context.Context, afterID string, limit int) ([]paste.Paste, error) {
+	query := `SELECT p.id, p.url, p.content, p.created_at, e.policy_type, COALESCE(e.duration, '')
+		FROM pastes p
+		JOIN expiration_policies e ON e.id = p.expiration_policy_id
+		WHERE p.id > ?
+		ORDER BY p.id
+		LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pastes: %w", err)
+	}
+	defer rows.Close()
+
+	var pastes []paste.Paste
+	for rows.Next() {
+		var p paste.Paste
+		if err := rows.Scan(&p.ID, &p.URL, &p.Content, &p.CreatedAt,
+			&p.ExpirationPolicy.Type, &p.ExpirationPolicy.Duration); err != nil {
+			return nil, fmt.Errorf("failed to scan paste: %w", err)
+		}
+		pastes = append(pastes, p)
+	}
+	return pastes, rows.Err()
+}
+
+// ExistingURLs reports which of urls still have a row in pastes.
+func (r *MySQLPasteRepositoryImpl) ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(urls))
+	if len(urls) == 0 {
+		return found, nil
+	}
+
+	args := make([]interface{}, len(urls))
+	for i, url := range urls {
+		args[i] = url
+	}
+	query := "SELECT url FROM pastes WHERE url IN (?" + strings.Repeat(",?", len(urls)-1) + ")"
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up pastes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, fmt.Errorf("failed to scan url: %w", err)
+		}
+		found[url] = true
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RetrievalCache drops pastes from the cache retrieval-service reads
+// through, including the in-process copies held by each of its replicas.
+type RetrievalCache interface {
+	Evict(ctx context.Context, url string) error
+}
+
+// invalidationChannel is where retrieval-service replicas learn to drop
+// their in-process copy of a paste. Messages are "<origin> <url>"; replicas
+// skip their own, which never carry this service's origin.
+const (
+	invalidationChannel = "paste:invalidate"
+	invalidationOrigin  = "cleanup-service"
+)
+
+type RedisRetrievalCache struct {
+	client *redis.Client
+}
+
+func NewRedisRetrievalCache(client *redis.Client) *RedisRetrievalCache {
+	return &RedisRetrievalCache{client: client}
+}
+
+// CacheKey is the key retrieval-service caches a paste under.
+func CacheKey(url string) string {
+	return "paste:" + url
+}
+
+func (c *RedisRetrievalCache) Evict(ctx context.Context, url string) error {
+	if err := c.client.Del(ctx, CacheKey(url)).Err(); err != nil {
+		return fmt.Errorf("failed to evict paste %s from redis: %w", url, err)
+	}
+	if err := c.client.Publish(ctx, invalidationChannel, invalidationOrigin+" "+url).Err(); err != nil {
+		return fmt.Errorf("failed to publish invalidation of paste %s: %w", url, err)
+	}
+	return nil
+}
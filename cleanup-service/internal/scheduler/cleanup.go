@@ -1,20 +1,20 @@
 package scheduler
 
 import (
-	"cleanup-service/shared"
 	"context"
 	"time"
 
 	"cleanup-service/internal/service/cleanup"
+	"go.uber.org/zap"
 )
 
 // CleanupScheduler manages periodic cleanup tasks
 type CleanupScheduler struct {
 	service *cleanup.Service
-	logger  *shared.Logger
+	logger  *zap.Logger
 }
 
-func NewCleanupScheduler(service *cleanup.Service, logger *shared.Logger) *CleanupScheduler {
+func NewCleanupScheduler(service *cleanup.Service, logger *zap.Logger) *CleanupScheduler {
 	return &CleanupScheduler{
 		service: service,
 		logger:  logger,
@@ -35,10 +35,10 @@ func (s *CleanupScheduler) Start(ctx context.Context) {
 			s.logger.Info("Running scheduled cleanup")
 			count, err := s.service.RunCleanup(ctx)
 			if err != nil {
-				s.logger.Errorf("Scheduled cleanup failed: %v", err)
+				s.logger.Error("Scheduled cleanup failed", zap.Error(err))
 				continue
 			}
-			s.logger.Infof("Scheduled cleanup completed, deleted %d pastes", count)
+			s.logger.Info("Scheduled cleanup completed", zap.Int("deleted", count))
 		}
 	}
 }
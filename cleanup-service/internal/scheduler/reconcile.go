@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cleanup-service/internal/service/reconcile"
+	"go.uber.org/zap"
+)
+
+// ReconcileScheduler runs the cross-store reconciler periodically
+type ReconcileScheduler struct {
+	service  *reconcile.Service
+	interval time.Duration
+	// opts is read before every run so reloaded settings apply to the next one
+	opts   func() reconcile.Options
+	logger *zap.Logger
+}
+
+func NewReconcileScheduler(service *reconcile.Service, interval time.Duration, opts func() reconcile.Options,
+	logger *zap.Logger) *ReconcileScheduler {
+	return &ReconcileScheduler{
+		service:  service,
+		interval: interval,
+		opts:     opts,
+		logger:   logger,
+	}
+}
+
+func (s *ReconcileScheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.logger.Info("Starting reconcile scheduler", zap.Duration("interval", s.interval))
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Stopping reconcile scheduler")
+			return
+		case <-ticker.C:
+			_, err := s.service.Run(ctx, s.opts())
+			if errors.Is(err, reconcile.ErrRunning) {
+				s.logger.Info("Skipping scheduled reconciliation, one is already running")
+			} else if err != nil {
+				s.logger.Error("Scheduled reconciliation failed", zap.Error(err))
+			}
+		}
+	}
+}
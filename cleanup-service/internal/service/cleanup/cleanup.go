@@ -4,9 +4,11 @@ import (
 	"cleanup-service/internal/domain/paste"
 	"cleanup-service/internal/eventbus"
 	"cleanup-service/internal/repository"
-	"cleanup-service/shared"
 	"context"
+	"errors"
 	"fmt"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"go.uber.org/zap"
 	"sync"
 	"time"
 )
@@ -16,8 +18,13 @@ type Service struct {
 	retrievalRepo repository.RetrievalRepository
 	analyticsRepo repository.AnalyticsRepository
 	cleanupRepo   repository.CleanupRepository
+	cache         repository.RetrievalCache
 	consumer      eventbus.EventConsumer
-	logger        *shared.Logger
+	logger        *zap.Logger
+
+	// deletes tracks burn-after-read deletions still running after their
+	// event was acknowledged
+	deletes sync.WaitGroup
 
 	mu            sync.Mutex
 	lastRun       time.Time
@@ -29,14 +36,16 @@ func NewCleanupService(
 	retrievalRepo repository.RetrievalRepository,
 	analyticsRepo repository.AnalyticsRepository,
 	cleanupRepo repository.CleanupRepository,
+	cache repository.RetrievalCache,
 	consumer eventbus.EventConsumer,
-	logger *shared.Logger,
+	logger *zap.Logger,
 ) *Service {
 	return &Service{
 		mysqlRepo:     mysqlRepo,
 		retrievalRepo: retrievalRepo,
 		analyticsRepo: analyticsRepo,
 		cleanupRepo:   cleanupRepo,
+		cache:         cache,
 		consumer:      consumer,
 		logger:        logger,
 	}
@@ -44,7 +53,8 @@ func NewCleanupService(
 
 // StartEventConsumer handles incoming events
 func (s *Service) StartEventConsumer(ctx context.Context) error {
-	return s.consumer.Consume(ctx, func(event interface{}) error {
+	return s.consumer.Consume(ctx, func(ctx context.Context, event interface{}) error {
+		logger := logging.FromContext(ctx, s.logger)
 		switch e := event.(type) {
 		case paste.CreatedEvent:
 			return s.handleCreatedEvent(ctx, e)
@@ -53,17 +63,19 @@ func (s *Service) StartEventConsumer(ctx context.Context) error {
 			return s.cleanupRepo.MarkRead(ctx, e.URL)
 
 		case paste.BurnAfterReadPasteViewedEvent:
-			s.logger.Infof("Processing burn after read event for URL: %s", e.URL)
+			logger.Info("Processing burn after read event", logging.URL(e.URL))
 
 			if err := s.cleanupRepo.MarkRead(ctx, e.URL); err != nil {
 				return fmt.Errorf("failed to mark burn after read paste as read: %w", err)
 			}
 
+			s.deletes.Add(1)
 			go func(url string) {
+				defer s.deletes.Done()
 				if err := s.deletePaste(ctx, url, true); err != nil {
-					s.logger.Errorf("Failed to delete burn after read paste %s: %v", url, err)
+					logger.Error("Failed to delete burn after read paste", logging.URL(url), zap.Error(err))
 				} else {
-					s.logger.Infof("Successfully deleted burn after read paste %s", url)
+					logger.Info("Successfully deleted burn after read paste", logging.URL(url))
 				}
 			}(e.URL)
 
@@ -75,21 +87,21 @@ func (s *Service) StartEventConsumer(ctx context.Context) error {
 	})
 }
 
+// StopEventConsumer stops taking new events and waits for the ones in
+// flight, including burn-after-read deletions they started.
+func (s *Service) StopEventConsumer() error {
+	err := s.consumer.Close()
+	s.deletes.Wait()
+	return err
+}
+
 func (s *Service) handleCreatedEvent(ctx context.Context, e paste.CreatedEvent) error {
-	var expireAt time.Time
-	isBurnAfterRead := false
-
-	switch e.ExpirationPolicy.Type {
-	case paste.BurnAfterRead:
-		isBurnAfterRead = true
-	case paste.TimedExpiration:
-		duration, ok := paste.DurationMap[e.ExpirationPolicy.Duration]
-		if !ok {
-			return fmt.Errorf("invalid duration: %s", e.ExpirationPolicy.Duration)
-		}
-		expireAt = e.CreatedAt.Add(duration)
+	// NEVER and unread burn-after-read pastes get a task without expiry
+	expireAt, _, err := e.ExpirationPolicy.ExpiresAt(e.CreatedAt)
+	if err != nil {
+		return err
 	}
-
+	isBurnAfterRead := e.ExpirationPolicy.Type == paste.BurnAfterRead
 	return s.cleanupRepo.AddTask(ctx, e.URL, expireAt, isBurnAfterRead)
 }
 
@@ -106,7 +118,7 @@ func (s *Service) RunCleanup(ctx context.Context) (int, error) {
 	count := 0
 	for _, url := range urls {
 		if err := s.deletePaste(ctx, url, false); err != nil {
-			s.logger.Errorf("Failed to delete paste %s: %v", url, err)
+			s.logger.Error("Failed to delete paste", logging.URL(url), zap.Error(err))
 			continue
 		}
 		count++
@@ -117,6 +129,59 @@ func (s *Service) RunCleanup(ctx context.Context) (int, error) {
 	return count, nil
 }
 
+// DryRun returns the pastes the next cleanup run would delete, without
+// deleting anything.
+func (s *Service) DryRun(ctx context.Context) ([]string, error) {
+	urls, err := s.cleanupRepo.FindExpired(ctx, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired pastes: %w", err)
+	}
+	return urls, nil
+}
+
+// ExpirePaste expires a paste now and deletes it the way the cleanup run
+// would. Retrieval-service judges expiry from the paste's own policy, so a
+// due task alone would leave it readable until the next run. If the deletion
+// fails the task stays due and the next run retries it.
+func (s *Service) ExpirePaste(ctx context.Context, url string) error {
+	if err := s.cleanupRepo.Expire(ctx, url, time.Now()); err != nil {
+		return fmt.Errorf("failed to expire paste %s: %w", url, err)
+	}
+	if err := s.deletePaste(ctx, url, false); err != nil {
+		return fmt.Errorf("failed to delete expired paste %s: %w", url, err)
+	}
+	if err := s.cache.Evict(ctx, url); err != nil {
+		return err
+	}
+	s.logger.Info("Force-expired paste", logging.URL(url))
+	return nil
+}
+
+// DeletePaste removes a paste from every store immediately, then evicts it
+// from the retrieval cache. Unlike the cleanup run it carries on past stores
+// that no longer hold the paste, and returns the combined errors.
+func (s *Service) DeletePaste(ctx context.Context, url string) error {
+	var errs []error
+	if err := s.mysqlRepo.Delete(ctx, url); err != nil {
+		errs = append(errs, fmt.Errorf("mysql: %w", err))
+	}
+	if err := s.retrievalRepo.Delete(ctx, url); err != nil {
+		errs = append(errs, fmt.Errorf("retrieval: %w", err))
+	}
+	if err := s.analyticsRepo.Delete(ctx, url); err != nil {
+		errs = append(errs, fmt.Errorf("analytics: %w", err))
+	}
+	if err := s.cleanupRepo.DeleteTask(ctx, url); err != nil {
+		errs = append(errs, fmt.Errorf("cleanup: %w", err))
+	}
+	// Evicted last, so a read racing the deletes cannot cache the paste again
+	if err := s.cache.Evict(ctx, url); err != nil {
+		errs = append(errs, fmt.Errorf("cache: %w", err))
+	}
+	s.logger.Info("Force-deleted paste", logging.URL(url))
+	return errors.Join(errs...)
+}
+
 // deletePaste deletes a paste from databases. If burnAfterRead is true, skip analytics deletion.
 func (s *Service) deletePaste(ctx context.Context, url string, burnAfterRead bool) error {
 	if err := s.mysqlRepo.Delete(ctx, url); err != nil {
@@ -137,7 +202,7 @@ func (s *Service) deletePaste(ctx context.Context, url string, burnAfterRead boo
 		return fmt.Errorf("failed to delete from cleanup_tasks: %w", err)
 	}
 
-	s.logger.Infof("Deleted paste %s from all databases", url)
+	s.logger.Info("Deleted paste from all databases", logging.URL(url))
 	return nil
 }
 
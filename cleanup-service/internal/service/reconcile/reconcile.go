@@ -0,0 +1,388 @@
+// Package reconcile compares the stores that hold a copy of each paste and
+// reports, and optionally repairs, the drift between them.
+//
+// MySQL (create-service) is the source of truth. A paste missing from the
+// retrieval read model or without a cleanup task is repaired by republishing
+// paste.created; retrieval documents, cleanup tasks and analytics stats whose
+// paste is gone from MySQL are orphans and are deleted.
+//
+// create-service writes MySQL asynchronously through paste.save, so the other
+// stores may briefly know a paste that MySQL does not. Records younger than
+// the grace period are never reported as orphans.
+package reconcile
+
+import (
+	"cleanup-service/internal/domain/paste"
+	"cleanup-service/internal/metrics"
+	"cleanup-service/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// ErrRunning is returned when a run is started while one is in progress.
+var ErrRunning = errors.New("reconcile: already running")
+
+// DefaultPageSize is the number of records read from each store per query.
+const DefaultPageSize = 500
+
+// maxSamples caps the URLs kept per category in a report.
+const maxSamples = 20
+
+// Category is a kind of drift between stores.
+type Category string
+
+const (
+	MissingInRetrieval Category = "missing_in_retrieval"
+	MissingCleanupTask Category = "missing_cleanup_task"
+	OrphanInRetrieval  Category = "orphan_in_retrieval"
+	OrphanCleanupTask  Category = "orphan_cleanup_task"
+	OrphanAnalytics    Category = "orphan_analytics"
+)
+
+// Categories lists every drift category in report order.
+var Categories = []Category{
+	MissingInRetrieval, MissingCleanupTask, OrphanInRetrieval, OrphanCleanupTask, OrphanAnalytics,
+}
+
+// Status values reported in Report.
+const (
+	StatusIdle      = "idle"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Options controls a run.
+type Options struct {
+	// PageSize is the number of records read per query.
+	PageSize int `json:"page_size"`
+	// Repair republishes missing pastes and deletes orphans. Without it the
+	// run only reports.
+	Repair bool `json:"repair"`
+}
+
+// Report describes the current or last run.
+type Report struct {
+	Status     string                `json:"status"`
+	Repair     bool                  `json:"repair"`
+	StartedAt  time.Time             `json:"started_at,omitempty"`
+	FinishedAt time.Time             `json:"finished_at,omitempty"`
+	Scanned    map[string]int64      `json:"scanned"`
+	Drift      map[Category]int64    `json:"drift"`
+	Repaired   map[Category]int64    `json:"repaired"`
+	Samples    map[Category][]string `json:"samples"`
+	Error      string                `json:"error,omitempty"`
+}
+
+// Publisher republishes paste.created for pastes that need repair.
+type Publisher interface {
+	PublishPasteCreated(ctx context.Context, p paste.Paste) error
+}
+
+type Service struct {
+	mysqlRepo     repository.MySQLPasteRepository
+	retrievalRepo repository.RetrievalRepository
+	analyticsRepo repository.AnalyticsRepository
+	cleanupRepo   repository.CleanupRepository
+	publisher     Publisher
+	grace         time.Duration
+	logger        *zap.Logger
+
+	mu      sync.Mutex
+	running bool
+	report  Report
+}
+
+// NewService creates a reconciler. Pastes and records created less than grace
+// ago are not reported as missing or orphaned, since their paste.created or
+// paste.save may still be in flight.
+func NewService(
+	mysqlRepo repository.MySQLPasteRepository,
+	retrievalRepo repository.RetrievalRepository,
+	analyticsRepo repository.AnalyticsRepository,
+	cleanupRepo repository.CleanupRepository,
+	publisher Publisher,
+	grace time.Duration,
+	logger *zap.Logger,
+) *Service {
+	return &Service{
+		mysqlRepo:     mysqlRepo,
+		retrievalRepo: retrievalRepo,
+		analyticsRepo: analyticsRepo,
+		cleanupRepo:   cleanupRepo,
+		publisher:     publisher,
+		grace:         grace,
+		logger:        logger,
+		report:        Report{Status: StatusIdle},
+	}
+}
+
+// Report returns a snapshot of the current or last run.
+func (s *Service) Report() Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.report.clone()
+}
+
+// Start runs a reconciliation in the background.
+func (s *Service) Start(ctx context.Context, opts Options) error {
+	if err := s.begin(opts); err != nil {
+		return err
+	}
+	go func() {
+		_ = s.run(ctx, opts)
+	}()
+	return nil
+}
+
+// Run reconciles synchronously and returns the final report.
+func (s *Service) Run(ctx context.Context, opts Options) (Report, error) {
+	if err := s.begin(opts); err != nil {
+		return Report{}, err
+	}
+	err := s.run(ctx, opts)
+	return s.Report(), err
+}
+
+func (s *Service) begin(opts Options) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return ErrRunning
+	}
+	s.running = true
+	s.report = Report{
+		Status:    StatusRunning,
+		Repair:    opts.Repair,
+		StartedAt: time.Now(),
+		Scanned:   map[string]int64{},
+		Drift:     map[Category]int64{},
+		Repaired:  map[Category]int64{},
+		Samples:   map[Category][]string{},
+	}
+	return nil
+}
+
+func (s *Service) run(ctx context.Context, opts Options) (err error) {
+	defer func() { s.finish(err) }()
+
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultPageSize
+	}
+	s.logger.Info("Starting reconciliation", zap.Bool("repair", opts.Repair), zap.Int("pageSize", opts.PageSize))
+
+	if err := s.scanMySQL(ctx, opts); err != nil {
+		return err
+	}
+	if err := s.scanOrphans(ctx, opts, "retrieval", OrphanInRetrieval,
+		func(after string) ([]repository.URLRecord, error) {
+			pastes, err := s.retrievalRepo.FindPage(ctx, after, opts.PageSize)
+			records := make([]repository.URLRecord, len(pastes))
+			for i, p := range pastes {
+				records[i] = repository.URLRecord{URL: p.URL, CreatedAt: p.CreatedAt}
+			}
+			return records, err
+		}, s.retrievalRepo.Delete); err != nil {
+		return err
+	}
+	if err := s.scanOrphans(ctx, opts, "cleanup", OrphanCleanupTask,
+		func(after string) ([]repository.URLRecord, error) {
+			return s.cleanupRepo.FindTaskPage(ctx, after, opts.PageSize)
+		}, s.cleanupRepo.DeleteTask); err != nil {
+		return err
+	}
+	return s.scanOrphans(ctx, opts, "analytics", OrphanAnalytics,
+		func(after string) ([]repository.URLRecord, error) {
+			return s.analyticsRepo.FindStatsPage(ctx, after, opts.PageSize)
+		}, s.analyticsRepo.Delete)
+}
+
+// scanMySQL walks every paste in MySQL and checks that the read model and
+// the cleanup tasks know about it.
+func (s *Service) scanMySQL(ctx context.Context, opts Options) error {
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pastes, err := s.mysqlRepo.FindPage(ctx, after, opts.PageSize)
+		if err != nil {
+			return err
+		}
+		if len(pastes) == 0 {
+			return nil
+		}
+		after = pastes[len(pastes)-1].ID
+		s.scanned("mysql", len(pastes))
+
+		cutoff := time.Now().Add(-s.grace)
+		var urls []string
+		for _, p := range pastes {
+			if p.CreatedAt.Before(cutoff) {
+				urls = append(urls, p.URL)
+			}
+		}
+		inRetrieval, err := s.retrievalRepo.ExistingURLs(ctx, urls)
+		if err != nil {
+			return err
+		}
+		withTask, err := s.cleanupRepo.ExistingURLs(ctx, urls)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range pastes {
+			if !p.CreatedAt.Before(cutoff) {
+				continue
+			}
+			var missing []Category
+			if !inRetrieval[p.URL] {
+				missing = append(missing, MissingInRetrieval)
+			}
+			if !withTask[p.URL] {
+				missing = append(missing, MissingCleanupTask)
+			}
+			if len(missing) == 0 {
+				continue
+			}
+			for _, c := range missing {
+				s.drift(c, p.URL)
+			}
+
+			// One paste.created event repairs both kinds of drift
+			if opts.Repair {
+				if err := s.publisher.PublishPasteCreated(ctx, p); err != nil {
+					s.logger.Error("Failed to republish paste", logging.URL(p.URL), zap.Error(err))
+					continue
+				}
+				for _, c := range missing {
+					s.repaired(c)
+				}
+			}
+		}
+	}
+}
+
+// scanOrphans walks the URLs of one store and reports those whose paste no
+// longer exists in MySQL, deleting them when repairing. Records younger than
+// the grace period are skipped.
+func (s *Service) scanOrphans(ctx context.Context, opts Options, store string, category Category,
+	page func(after string) ([]repository.URLRecord, error),
+	remove func(ctx context.Context, url string) error) error {
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		records, err := page(after)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", store, err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		after = records[len(records)-1].URL
+		s.scanned(store, len(records))
+
+		// A recent record may belong to a paste whose paste.save has not
+		// reached MySQL yet
+		cutoff := time.Now().Add(-s.grace)
+		var urls []string
+		for _, rec := range records {
+			if rec.CreatedAt.Before(cutoff) {
+				urls = append(urls, rec.URL)
+			}
+		}
+
+		exists, err := s.mysqlRepo.ExistingURLs(ctx, urls)
+		if err != nil {
+			return err
+		}
+		for _, url := range urls {
+			if exists[url] {
+				continue
+			}
+			s.drift(category, url)
+			if opts.Repair {
+				if err := remove(ctx, url); err != nil {
+					s.logger.Error("Failed to delete orphan", logging.URL(url), zap.String("store", store),
+						zap.Error(err))
+					continue
+				}
+				s.repaired(category)
+			}
+		}
+	}
+}
+
+func (s *Service) scanned(store string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Scanned[store] += int64(n)
+}
+
+func (s *Service) drift(c Category, url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Drift[c]++
+	if len(s.report.Samples[c]) < maxSamples {
+		s.report.Samples[c] = append(s.report.Samples[c], url)
+	}
+}
+
+func (s *Service) repaired(c Category) {
+	metrics.ReconcileRepaired.WithLabelValues(string(c)).Inc()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Repaired[c]++
+}
+
+func (s *Service) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = false
+	s.report.FinishedAt = time.Now()
+	if err != nil {
+		s.report.Status = StatusFailed
+		s.report.Error = err.Error()
+		s.logger.Error("Reconciliation failed", zap.Error(err))
+		return
+	}
+
+	s.report.Status = StatusCompleted
+	for _, c := range Categories {
+		metrics.ReconcileDrift.WithLabelValues(string(c)).Set(float64(s.report.Drift[c]))
+	}
+	metrics.ReconcileLastSuccess.SetToCurrentTime()
+	s.logger.Info("Reconciliation completed", zap.Any("drift", s.report.Drift),
+		zap.Any("repaired", s.report.Repaired))
+}
+
+func (r Report) clone() Report {
+	out := r
+	out.Scanned = make(map[string]int64, len(r.Scanned))
+	for k, v := range r.Scanned {
+		out.Scanned[k] = v
+	}
+	out.Drift = make(map[Category]int64, len(r.Drift))
+	for k, v := range r.Drift {
+		out.Drift[k] = v
+	}
+	out.Repaired = make(map[Category]int64, len(r.Repaired))
+	for k, v := range r.Repaired {
+		out.Repaired[k] = v
+	}
+	out.Samples = make(map[Category][]string, len(r.Samples))
+	for k, v := range r.Samples {
+		out.Samples[k] = append([]string(nil), v...)
+	}
+	return out
+}
@@ -0,0 +1,259 @@
+package reconcile
+
+import (
+	"cleanup-service/internal/domain/paste"
+	"cleanup-service/internal/repository"
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Fakes embed the repository interfaces so only the methods the reconciler
+// reaches need implementing.
+
+type fakeMySQL struct {
+	repository.MySQLPasteRepository
+	pastes []paste.Paste
+}
+
+func (f *fakeMySQL) FindPage(ctx context.Context, afterID string, limit int) ([]paste.Paste, error) {
+	return page(f.pastes, func(p paste.Paste) string { return p.ID }, afterID, limit), nil
+}
+
+func (f *fakeMySQL) ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	for _, p := range f.pastes {
+		found[p.URL] = true
+	}
+	return only(found, urls), nil
+}
+
+type fakeRetrieval struct {
+	repository.RetrievalRepository
+	pastes  []paste.Paste
+	deleted []string
+}
+
+func (f *fakeRetrieval) FindPage(ctx context.Context, afterURL string, limit int) ([]paste.Paste, error) {
+	return page(f.pastes, func(p paste.Paste) string { return p.URL }, afterURL, limit), nil
+}
+
+func (f *fakeRetrieval) ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	for _, p := range f.pastes {
+		found[p.URL] = true
+	}
+	return only(found, urls), nil
+}
+
+func (f *fakeRetrieval) Delete(ctx context.Context, url string) error {
+	f.deleted = append(f.deleted, url)
+	return nil
+}
+
+type fakeCleanup struct {
+	repository.CleanupRepository
+	tasks   []repository.URLRecord
+	deleted []string
+}
+
+func (f *fakeCleanup) FindTaskPage(ctx context.Context, afterURL string, limit int) ([]repository.URLRecord, error) {
+	return page(f.tasks, recordURL, afterURL, limit), nil
+}
+
+func (f *fakeCleanup) ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	for _, t := range f.tasks {
+		found[t.URL] = true
+	}
+	return only(found, urls), nil
+}
+
+func (f *fakeCleanup) DeleteTask(ctx context.Context, url string) error {
+	f.deleted = append(f.deleted, url)
+	return nil
+}
+
+type fakeAnalytics struct {
+	repository.AnalyticsRepository
+	stats   []repository.URLRecord
+	deleted []string
+}
+
+func (f *fakeAnalytics) FindStatsPage(ctx context.Context, afterURL string, limit int) ([]repository.URLRecord, error) {
+	return page(f.stats, recordURL, afterURL, limit), nil
+}
+
+func (f *fakeAnalytics) Delete(ctx context.Context, url string) error {
+	f.deleted = append(f.deleted, url)
+	return nil
+}
+
+type fakePublisher struct{ published []string }
+
+func (f *fakePublisher) PublishPasteCreated(ctx context.Context, p paste.Paste) error {
+	f.published = append(f.published, p.URL)
+	return nil
+}
+
+func page[T any](items []T, key func(T) string, after string, limit int) []T {
+	sorted := append([]T(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	var out []T
+	for _, item := range sorted {
+		if key(item) > after && len(out) < limit {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func only(found map[string]bool, urls []string) map[string]bool {
+	out := map[string]bool{}
+	for _, url := range urls {
+		if found[url] {
+			out[url] = true
+		}
+	}
+	return out
+}
+
+func recordURL(r repository.URLRecord) string { return r.URL }
+
+func TestRun(t *testing.T) {
+	const grace = 5 * time.Minute
+	now := time.Now()
+	old, young := now.Add(-time.Hour), now.Add(-time.Minute)
+
+	stored := func(id, url string, at time.Time) paste.Paste {
+		return paste.Paste{ID: id, URL: url, CreatedAt: at,
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpires}}
+	}
+	record := func(url string, at time.Time) repository.URLRecord {
+		return repository.URLRecord{URL: url, CreatedAt: at}
+	}
+
+	tests := []struct {
+		name      string
+		mysql     []paste.Paste
+		retrieval []paste.Paste
+		tasks     []repository.URLRecord
+		stats     []repository.URLRecord
+
+		wantDrift     map[Category]int64
+		wantPublished []string
+		wantDeleted   map[string][]string
+	}{
+		{
+			name:      "in sync",
+			mysql:     []paste.Paste{stored("1", "a", old)},
+			retrieval: []paste.Paste{stored("", "a", old)},
+			tasks:     []repository.URLRecord{record("a", old)},
+			stats:     []repository.URLRecord{record("a", old)},
+			wantDrift: map[Category]int64{},
+		},
+		{
+			name:  "missing everywhere",
+			mysql: []paste.Paste{stored("1", "a", old), stored("2", "b", old)},
+			tasks: []repository.URLRecord{record("b", old)},
+			wantDrift: map[Category]int64{
+				MissingInRetrieval: 2,
+				MissingCleanupTask: 1,
+			},
+			wantPublished: []string{"a", "b"},
+		},
+		{
+			name:      "young paste not yet propagated",
+			mysql:     []paste.Paste{stored("1", "a", young)},
+			wantDrift: map[Category]int64{},
+		},
+		{
+			name:      "orphans",
+			retrieval: []paste.Paste{stored("", "a", old)},
+			tasks:     []repository.URLRecord{record("a", old), record("b", old)},
+			stats:     []repository.URLRecord{record("c", old)},
+			wantDrift: map[Category]int64{
+				OrphanInRetrieval: 1,
+				OrphanCleanupTask: 2,
+				OrphanAnalytics:   1,
+			},
+			wantDeleted: map[string][]string{
+				"retrieval": {"a"},
+				"cleanup":   {"a", "b"},
+				"analytics": {"c"},
+			},
+		},
+		{
+			name:      "young records not yet saved to mysql",
+			retrieval: []paste.Paste{stored("", "a", young)},
+			tasks:     []repository.URLRecord{record("a", young)},
+			stats:     []repository.URLRecord{record("a", young)},
+			wantDrift: map[Category]int64{},
+		},
+		{
+			name:      "record without creation time",
+			tasks:     []repository.URLRecord{record("a", time.Time{})},
+			wantDrift: map[Category]int64{OrphanCleanupTask: 1},
+			wantDeleted: map[string][]string{
+				"cleanup": {"a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, repair := range []bool{false, true} {
+			name := tt.name
+			if repair {
+				name += " repair"
+			}
+			t.Run(name, func(t *testing.T) {
+				retrieval := &fakeRetrieval{pastes: tt.retrieval}
+				cleanup := &fakeCleanup{tasks: tt.tasks}
+				analytics := &fakeAnalytics{stats: tt.stats}
+				publisher := &fakePublisher{}
+				svc := NewService(&fakeMySQL{pastes: tt.mysql}, retrieval, analytics, cleanup, publisher,
+					grace, zap.NewNop())
+
+				report, err := svc.Run(context.Background(), Options{PageSize: 1, Repair: repair})
+				if err != nil {
+					t.Fatalf("Run: %v", err)
+				}
+				if !reflect.DeepEqual(report.Drift, tt.wantDrift) {
+					t.Errorf("drift = %v, want %v", report.Drift, tt.wantDrift)
+				}
+
+				wantRepaired := map[Category]int64{}
+				wantPublished, wantDeleted := []string(nil), map[string][]string{}
+				if repair {
+					wantRepaired = tt.wantDrift
+					wantPublished = tt.wantPublished
+					for store, urls := range tt.wantDeleted {
+						wantDeleted[store] = urls
+					}
+				}
+				if !reflect.DeepEqual(report.Repaired, wantRepaired) {
+					t.Errorf("repaired = %v, want %v", report.Repaired, wantRepaired)
+				}
+				if !reflect.DeepEqual(publisher.published, wantPublished) {
+					t.Errorf("published = %v, want %v", publisher.published, wantPublished)
+				}
+				deleted := map[string][]string{}
+				for store, urls := range map[string][]string{
+					"retrieval": retrieval.deleted,
+					"cleanup":   cleanup.deleted,
+					"analytics": analytics.deleted,
+				} {
+					if len(urls) > 0 {
+						deleted[store] = urls
+					}
+				}
+				if !reflect.DeepEqual(deleted, wantDeleted) {
+					t.Errorf("deleted = %v, want %v", deleted, wantDeleted)
+				}
+			})
+		}
+	}
+}
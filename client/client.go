@@ -0,0 +1,270 @@
+// Package client is a Go SDK for the public pastebin-ms HTTP APIs: creating
+// pastes (create-service), reading them (retrieval-service) and reading view
+// statistics (analytics-service).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Errors returned for pastes that cannot be read. They mirror
+// ErrPasteNotFound and ErrPasteExpired in retrieval-service.
+var (
+	ErrPasteNotFound = errors.New("paste not found")
+	ErrPasteExpired  = errors.New("paste has expired")
+)
+
+// reasonPasteExpired is the reason retrieval-service sends with
+// ErrPasteExpired.
+const reasonPasteExpired = "paste_expired"
+
+// PolicyType is how a paste expires.
+type PolicyType string
+
+const (
+	PolicyTimed         PolicyType = "TIMED"
+	PolicyNever         PolicyType = "NEVER"
+	PolicyBurnAfterRead PolicyType = "BURN_AFTER_READ"
+)
+
+// Durations lists the values accepted for timed pastes.
+var Durations = []string{
+	"10minutes", "1hour", "1day", "1week", "2weeks", "1month", "6months", "1year",
+}
+
+// APIError is a non-success response that is not one of the paste errors.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RequestID is the service's X-Request-ID for the call, to quote when
+	// searching the service logs.
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Config points a Client at the services.
+type Config struct {
+	// CreateURL, RetrievalURL and AnalyticsURL are the base URLs of each
+	// service, e.g. http://localhost:8081.
+	CreateURL    string
+	RetrievalURL string
+	AnalyticsURL string
+	// APIKey, if set, is sent as a bearer token.
+	APIKey string
+	// HTTPClient defaults to a client with a 30 second timeout.
+	HTTPClient *http.Client
+}
+
+// Client talks to the pastebin-ms APIs.
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// New creates a Client.
+func New(cfg Config) *Client {
+	hc := cfg.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{cfg: cfg, http: hc}
+}
+
+// CreateRequest describes a new paste. Duration is required for PolicyTimed.
+type CreateRequest struct {
+	Content    string     `json:"content"`
+	PolicyType PolicyType `json:"policyType"`
+	Duration   string     `json:"duration,omitempty"`
+}
+
+// Paste is a paste as returned by retrieval-service.
+type Paste struct {
+	URL           string `json:"url"`
+	Content       string `json:"content"`
+	RemainingTime string `json:"remaining_time"`
+	BurnAfterRead bool   `json:"burn_after_read,omitempty"`
+	// RevealToken is set on an unread burn-after-read paste returned without
+	// its content; see Reveal
+	RevealToken string `json:"reveal_token,omitempty"`
+}
+
+// Stats is the total view count of a paste.
+type Stats struct {
+	ViewCount int `json:"viewCount"`
+}
+
+// Period selects the bucket size of a view time series.
+type Period string
+
+const (
+	Hourly  Period = "hourly"
+	Weekly  Period = "weekly"
+	Monthly Period = "monthly"
+)
+
+// TimeSeriesPoint is the view count of one bucket.
+type TimeSeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	ViewCount int       `json:"viewCount"`
+}
+
+// TimeSeries is the view history of a paste.
+type TimeSeries struct {
+	PasteURL   string            `json:"pasteUrl"`
+	TotalViews int               `json:"totalViews"`
+	TimeSeries []TimeSeriesPoint `json:"timeSeries"`
+}
+
+// Create stores a new paste and returns its short URL.
+func (c *Client) Create(ctx context.Context, req CreateRequest) (string, error) {
+	if req.PolicyType == "" {
+		req.PolicyType = PolicyNever
+	}
+	var resp struct {
+		URL string `json:"url"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.cfg.CreateURL, "/api/pastes", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.URL, nil
+}
+
+// Get returns a paste's content. Reading a paste counts as a view, and burns
+// a burn-after-read paste: Get reveals it with the token the server returns.
+func (c *Client) Get(ctx context.Context, pasteURL string) (*Paste, error) {
+	var p Paste
+	if err := c.do(ctx, http.MethodGet, c.cfg.RetrievalURL, "/api/pastes/"+url.PathEscape(pasteURL)+"/content", nil, &p); err != nil {
+		return nil, err
+	}
+	if p.RevealToken != "" {
+		return c.Reveal(ctx, pasteURL, p.RevealToken)
+	}
+	return &p, nil
+}
+
+// Reveal reads a burn-after-read paste with a reveal token, burning it.
+func (c *Client) Reveal(ctx context.Context, pasteURL, token string) (*Paste, error) {
+	var p Paste
+	body := struct {
+		Token string `json:"token"`
+	}{token}
+	if err := c.do(ctx, http.MethodPost, c.cfg.RetrievalURL, "/api/pastes/"+url.PathEscape(pasteURL)+"/reveal", body, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Policy returns the human-readable time left before a paste expires, such
+// as "2 days, 3 hours", "never" or "after reading". It does not count as a
+// view.
+func (c *Client) Policy(ctx context.Context, pasteURL string) (string, error) {
+	var resp struct {
+		Policy string `json:"policy"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.cfg.RetrievalURL, "/api/pastes/"+url.PathEscape(pasteURL)+"/policy", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Policy, nil
+}
+
+// Stats returns the total view count of a paste.
+func (c *Client) Stats(ctx context.Context, pasteURL string) (*Stats, error) {
+	var s Stats
+	if err := c.do(ctx, http.MethodGet, c.cfg.AnalyticsURL, "/api/pastes/"+url.PathEscape(pasteURL)+"/stats", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Views returns the view history of a paste in buckets of period.
+func (c *Client) Views(ctx context.Context, pasteURL string, period Period) (*TimeSeries, error) {
+	var ts TimeSeries
+	path := "/api/analytics/" + string(period) + "/" + url.PathEscape(pasteURL)
+	if err := c.do(ctx, http.MethodGet, c.cfg.AnalyticsURL, path, nil, &ts); err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+func (c *Client) do(ctx context.Context, method, base, path string, body, out interface{}) error {
+	if base == "" {
+		return fmt.Errorf("no base URL configured for %s", path)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(base, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return responseError(resp.StatusCode, resp.Header.Get("X-Request-ID"), data)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// responseError maps an error response to ErrPasteNotFound, ErrPasteExpired
+// or an *APIError. Services answer either {"reason": ..., "message": ...} or
+// plain text.
+func responseError(code int, requestID string, body []byte) error {
+	var payload struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &payload) == nil && payload.Message != "" {
+		message = payload.Message
+	}
+
+	if code == http.StatusNotFound {
+		if payload.Reason == reasonPasteExpired {
+			return ErrPasteExpired
+		}
+		return ErrPasteNotFound
+	}
+	return &APIError{StatusCode: code, Message: message, RequestID: requestID}
+}
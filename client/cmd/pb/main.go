@@ -0,0 +1,270 @@
+// Command pb is the pastebin-ms command-line client.
+//
+//	pb < file.log                       create a paste from stdin, print its URL
+//	pb [create] [-policy p] [-duration d] [file...]
+//	pb get <url>                        print the raw content
+//	pb info <url>                       show how long until the paste expires
+//	pb stats [-period hourly|weekly|monthly] <url>
+//
+// Exit codes: 0 success, 1 error, 2 usage, 3 paste not found, 4 paste expired.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/client"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitExpired  = 4
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	global := flag.NewFlagSet("pb", flag.ContinueOnError)
+	profile := global.String("profile", os.Getenv("PB_PROFILE"), "config profile to use")
+	configPath := global.String("config", "", "config file (default ~/.config/pb/config.json)")
+	// create's flags are accepted up front too, so `pb -duration 1hour < f` works
+	policy := global.String("policy", "", "")
+	duration := global.String("duration", "", "")
+	global.Usage = usage
+	if err := global.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	c, err := newClient(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pb:", err)
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	args = global.Args()
+	cmd := "create"
+	if len(args) > 0 {
+		switch args[0] {
+		case "create", "get", "info", "stats":
+			cmd, args = args[0], args[1:]
+		case "help":
+			usage()
+			return exitOK
+		}
+	}
+
+	switch cmd {
+	case "get":
+		err = get(ctx, c, args)
+	case "info":
+		err = info(ctx, c, args)
+	case "stats":
+		err = stats(ctx, c, args)
+	default:
+		err = create(ctx, c, args, *policy, *duration)
+	}
+	return exitCode(err)
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: pb [-profile name] [-config file] [command] [args]
+
+commands:
+  create [-policy never|timed|burn] [-duration d] [file...]
+                          create a paste from files or stdin (default command)
+  get <url>               print a paste's content
+  info <url>              show how long until a paste expires
+  stats [-period hourly|weekly|monthly] <url>
+                          show view counts
+
+durations: `+strings.Join(client.Durations, ", ")+`
+
+exit codes: 0 ok, 1 error, 2 usage, 3 not found, 4 expired
+`)
+}
+
+func newClient(path, profile string) (*client.Client, error) {
+	if path == "" {
+		var err error
+		if path, err = client.DefaultConfigPath(); err != nil {
+			return nil, err
+		}
+	}
+	f, err := client.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := f.Profile(profile)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(p.Config()), nil
+}
+
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func exitCode(err error) int {
+	var ue usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ue):
+		fmt.Fprintln(os.Stderr, "pb:", err)
+		return exitUsage
+	case errors.Is(err, client.ErrPasteNotFound):
+		fmt.Fprintln(os.Stderr, "pb:", err)
+		return exitNotFound
+	case errors.Is(err, client.ErrPasteExpired):
+		fmt.Fprintln(os.Stderr, "pb:", err)
+		return exitExpired
+	case errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	default:
+		fmt.Fprintln(os.Stderr, "pb:", err)
+		return exitError
+	}
+}
+
+var policies = map[string]client.PolicyType{
+	"never": client.PolicyNever,
+	"timed": client.PolicyTimed,
+	"burn":  client.PolicyBurnAfterRead,
+}
+
+func create(ctx context.Context, c *client.Client, args []string, defaultPolicy, defaultDuration string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	policy := fs.String("policy", defaultPolicy, "expiration policy: never, timed or burn (default timed with -duration, else never)")
+	duration := fs.String("duration", defaultDuration, "lifetime of a timed paste, e.g. 1hour or 1week")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+
+	req := client.CreateRequest{PolicyType: client.PolicyNever, Duration: *duration}
+	switch {
+	case *policy != "":
+		p, ok := policies[strings.ToLower(*policy)]
+		if !ok {
+			return usageError{fmt.Sprintf("unknown policy %q", *policy)}
+		}
+		req.PolicyType = p
+	case *duration != "":
+		req.PolicyType = client.PolicyTimed
+	}
+	if req.PolicyType == client.PolicyTimed && req.Duration == "" {
+		return usageError{"-duration is required for timed pastes"}
+	}
+	if req.PolicyType != client.PolicyTimed {
+		req.Duration = ""
+	}
+
+	content, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return usageError{"nothing to paste"}
+	}
+	req.Content = string(content)
+
+	url, err := c.Create(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Println(url)
+	return nil
+}
+
+// readInput concatenates the named files, or reads stdin when there are none.
+func readInput(files []string) ([]byte, error) {
+	if len(files) == 0 {
+		return io.ReadAll(os.Stdin)
+	}
+	var out []byte
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+func get(ctx context.Context, c *client.Client, args []string) error {
+	url, err := oneURL("get", args)
+	if err != nil {
+		return err
+	}
+	p, err := c.Get(ctx, url)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(os.Stdout, p.Content)
+	return err
+}
+
+func info(ctx context.Context, c *client.Client, args []string) error {
+	url, err := oneURL("info", args)
+	if err != nil {
+		return err
+	}
+	remaining, err := c.Policy(ctx, url)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("url:       %s\nexpires:   %s\n", url, remaining)
+	return nil
+}
+
+func stats(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	period := fs.String("period", "", "also show views per hour, week or month")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+	url, err := oneURL("stats", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	s, err := c.Stats(ctx, url)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("url:       %s\nviews:     %d\n", url, s.ViewCount)
+
+	if *period == "" {
+		return nil
+	}
+	ts, err := c.Views(ctx, url, client.Period(*period))
+	if err != nil {
+		return err
+	}
+	for _, p := range ts.TimeSeries {
+		fmt.Printf("%s  %d\n", p.Timestamp.Local().Format("2006-01-02 15:04"), p.ViewCount)
+	}
+	return nil
+}
+
+func oneURL(cmd string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", usageError{cmd + ": expected one paste url"}
+	}
+	return args[0], nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   int
+	}{
+		{"not found", http.StatusNotFound,
+			`{"code":404,"reason":"paste_not_found","message":"Paste not found"}`, exitNotFound},
+		{"expired", http.StatusNotFound,
+			`{"code":404,"reason":"paste_expired","message":"Paste has expired"}`, exitExpired},
+		{"expired message without reason", http.StatusNotFound,
+			`{"code":404,"message":"Paste has expired"}`, exitNotFound},
+		{"plain text 404", http.StatusNotFound, "404 page not found", exitNotFound},
+		{"server error", http.StatusInternalServerError,
+			`{"code":500,"message":"Internal server error"}`, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			config, err := json.Marshal(map[string]any{
+				"profiles": map[string]any{"default": map[string]string{"base_url": srv.URL}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, config, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := run([]string{"-config", path, "get", "abc"}); got != tt.want {
+				t.Errorf("exit code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Profile is one named set of connection settings in the config file.
+// BaseURL is used for every service whose own URL is empty, which suits
+// deployments that route all APIs through one gateway.
+type Profile struct {
+	BaseURL      string `json:"base_url,omitempty"`
+	CreateURL    string `json:"create_url,omitempty"`
+	RetrievalURL string `json:"retrieval_url,omitempty"`
+	AnalyticsURL string `json:"analytics_url,omitempty"`
+	APIKey       string `json:"api_key,omitempty"`
+}
+
+// File is the client config file, by default ~/.config/pb/config.json:
+//
+//	{
+//	  "default_profile": "prod",
+//	  "profiles": {
+//	    "local": {"create_url": "http://localhost:8081", "retrieval_url": "http://localhost:8082"},
+//	    "prod":  {"base_url": "https://paste.example.com", "api_key": "..."}
+//	  }
+//	}
+type File struct {
+	DefaultProfile string             `json:"default_profile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles"`
+}
+
+// DefaultConfigPath returns the config file location, honouring PB_CONFIG.
+func DefaultConfigPath() (string, error) {
+	if p := os.Getenv("PB_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pb", "config.json"), nil
+}
+
+// LoadFile reads the config file at path. A missing file is not an error.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{Profiles: map[string]Profile{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if f.Profiles == nil {
+		f.Profiles = map[string]Profile{}
+	}
+	return &f, nil
+}
+
+// Profile returns the named profile, or the default one when name is empty.
+// With no profiles configured it returns an empty Profile.
+func (f *File) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" {
+		return f.Profiles["default"], nil
+	}
+	p, ok := f.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// Config resolves the profile into a client Config. The PB_CREATE_URL,
+// PB_RETRIEVAL_URL, PB_ANALYTICS_URL, PB_BASE_URL and PB_API_KEY environment
+// variables override the profile; local development ports are the fallback.
+func (p Profile) Config() Config {
+	base := firstNonEmpty(os.Getenv("PB_BASE_URL"), p.BaseURL)
+	return Config{
+		CreateURL:    firstNonEmpty(os.Getenv("PB_CREATE_URL"), p.CreateURL, base, "http://localhost:8081"),
+		RetrievalURL: firstNonEmpty(os.Getenv("PB_RETRIEVAL_URL"), p.RetrievalURL, base, "http://localhost:8082"),
+		AnalyticsURL: firstNonEmpty(os.Getenv("PB_ANALYTICS_URL"), p.AnalyticsURL, base, "http://localhost:8085"),
+		APIKey:       firstNonEmpty(os.Getenv("PB_API_KEY"), p.APIKey),
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,3 @@
+module github.com/ArsiHien/pastebin-ms/client
+
+go 1.24
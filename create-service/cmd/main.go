@@ -1,46 +1,147 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"github.com/ArsiHien/pastebin-ms/create-service/config"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/handlers"
 	pasteService "github.com/ArsiHien/pastebin-ms/create-service/internal/service/paste"
+	"github.com/ArsiHien/pastebin-ms/pkg/auth"
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"github.com/ArsiHien/pastebin-ms/pkg/lifecycle"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/settings"
+	"github.com/ArsiHien/pastebin-ms/pkg/tracing"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
 )
 
 func main() {
+	// Tải cấu hình
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	// Khởi tạo logger
-	logger, err := zap.NewProduction()
+	logger, logLevel, err := logging.New(logging.Config{
+		Service: "create-service",
+		Level:   cfg.LogLevel,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Sync()
 
-	// Tải cấu hình
-	cfg := config.LoadConfig()
+	// LOG_LEVEL đổi được bằng cách sửa CONFIG_FILE rồi gửi SIGHUP
+	cfgStore := settings.NewStore(cfg, config.LoadConfig)
+	cfgStore.OnReload(func(old, cur *config.AppConfig) {
+		if cur.LogLevel != old.LogLevel {
+			_ = logLevel.UnmarshalText([]byte(cur.LogLevel))
+		}
+	})
+	go cfgStore.WatchSignals(context.Background(), logger)
+
+	// Credential của admin API đổi được bằng cách reload cấu hình
+	tokens, keys := cfg.AdminCredentials()
+	authenticator := auth.NewAuthenticator(tokens, keys, cfg.AdminHMACMaxSkew)
+	if authenticator.Empty() {
+		logger.Warn("Neither ADMIN_TOKENS nor ADMIN_HMAC_KEYS is set; every admin request will be rejected")
+	}
+	cfgStore.OnReload(func(old, cur *config.AppConfig) {
+		if cur.AdminTokens != old.AdminTokens || cur.AdminHMACKeys != old.AdminHMACKeys {
+			authenticator.SetCredentials(cur.AdminCredentials())
+			logger.Info("Reloaded admin credentials")
+		}
+	})
+	auditLogger, closeAuditLog, err := auth.NewAuditLogger(logger, cfg.AuditLogFile)
+	if err != nil {
+		logger.Fatal("Failed to open audit log", zap.Error(err))
+	}
+
+	// Khởi tạo tracing trước để DB và RabbitMQ dùng tracer provider đã cấu hình
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "create-service",
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", zap.Error(err))
+		}
+	}()
 
 	// Khởi tạo ứng dụng
-	app, err := config.Initialize(cfg)
+	app, err := config.Initialize(cfg, logger)
 	if err != nil {
 		logger.Fatal("Failed to initialize application", zap.Error(err))
 	}
-	defer config.Cleanup(app)
 
 	// Create use case
 	createPasteUseCase := pasteService.NewCreatePasteUseCase(
 		app.PasteRepo,
 		app.ExpirationPolicyRepo,
 		app.Publisher,
+		logger,
 	)
+	createPasteUseCase.URLLength = cfg.URLLength
 
 	// Handler và router
 	handler := handlers.NewPasteHandler(createPasteUseCase, logger)
-	router := handlers.NewRouter(handler)
+	sqlDB, err := app.DB.DB()
+	if err != nil {
+		logger.Fatal("Failed to get SQL DB", zap.Error(err))
+	}
+	probe := health.NewProbe(map[string]health.Check{
+		"mysql":    sqlDB.PingContext,
+		"rabbitmq": app.RabbitConn.Check,
+	})
+	router, err := handlers.NewRouter(handler, probe, handlers.Admin{
+		Auth:         authenticator.Middleware("create-service", auditLogger),
+		DLQ:          app.DLQAdmin,
+		LogLevel:     logLevel,
+		Config:       cfgStore.Handler(),
+		ReloadConfig: cfgStore.ReloadHandler(),
+	})
+	if err != nil {
+		logger.Fatal("Failed to create router", zap.Error(err))
+	}
 
 	// Khởi động server
-	logger.Info("Server is running", zap.String("port", cfg.Port))
-	if err := http.ListenAndServe(":"+cfg.Port, router); err != nil {
-		logger.Fatal("Server failed", zap.Error(err))
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: router,
+	}
+	go func() {
+		logger.Info("Server is running", zap.String("port", cfg.Port))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("Server failed", zap.Error(err))
+		}
+	}()
+
+	// Tắt êm: rút khỏi load balancer, xử lý nốt request đang dở, để worker
+	// flush các batch đang gom rồi mới đóng kết nối
+	sig := lifecycle.WaitForSignal()
+	logger.Info("Shutting down", zap.Stringer("signal", sig))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err = lifecycle.Shutdown(ctx, logger,
+		lifecycle.Drain(probe, cfg.ShutdownDelay),
+		lifecycle.Step{Name: "http", Stop: server.Shutdown},
+		lifecycle.Close("application", func() error {
+			config.Cleanup(app)
+			return nil
+		}),
+		lifecycle.Close("audit log", closeAuditLog),
+	)
+	if err != nil {
+		logger.Error("Shutdown did not complete", zap.Error(err))
+		return
 	}
+	logger.Info("Server stopped")
 }
@@ -3,7 +3,7 @@ package paste
 import "context"
 
 type EventPublisher interface {
-	PublishPasteCreated(paste *Paste) error
+	PublishPasteCreated(ctx context.Context, paste *Paste) error
 	PublishPasteSave(ctx context.Context, pasteData []byte) error
 	Close() error
 }
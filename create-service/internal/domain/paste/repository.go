@@ -1,11 +1,15 @@
 package paste
 
+import "context"
+
 type ExpirationPolicyRepository interface {
-	FindByPolicyTypeAndDuration(policyType ExpirationPolicyType,
+	FindByPolicyTypeAndDuration(ctx context.Context, policyType ExpirationPolicyType,
 		duration string) (*ExpirationPolicy, error)
-	Save(policy *ExpirationPolicy) error
+	Save(ctx context.Context, policy *ExpirationPolicy) error
 }
 
 type Repository interface {
 	Save(paste *Paste) error
+	// SaveBatch trả về số paste thực sự được thêm; paste đã tồn tại bị bỏ qua
+	SaveBatch(ctx context.Context, pastes []*Paste) (int64, error)
 }
@@ -2,75 +2,68 @@ package eventbus
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/domain/paste"
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
 	"time"
 )
 
+// eventSource là CloudEvents source của mọi sự kiện do create-service phát
+const eventSource = "/create-service"
+
+// PasteSaveVersion là phiên bản schema của paste.save, vốn là JSON của
+// paste.Paste và chỉ được dùng nội bộ create-service
+const PasteSaveVersion = "1"
+
 type RabbitMQPublisher struct {
-	channel *amqp.Channel
+	publisher *rabbitmq.Publisher
+	encoder   events.Encoder
 }
 
-func NewRabbitMQPublisher(conn *amqp.Connection) (*RabbitMQPublisher, error) {
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, err
-	}
-	err = ch.ExchangeDeclare("pastebin_events", "topic", true, false, false, false, nil)
+// NewRabbitMQPublisher tạo publisher; contentType chọn encoding JSON hoặc
+// protobuf cho paste.created
+func NewRabbitMQPublisher(conn *rabbitmq.Connection, confirmTimeout time.Duration,
+	contentType string, logger *zap.Logger) (*RabbitMQPublisher, error) {
+	publisher, err := rabbitmq.NewPublisher(conn, events.Exchange,
+		rabbitmq.WithConfirmTimeout(confirmTimeout),
+		rabbitmq.WithReturnHandler(func(ret amqp.Return) {
+			logger.Error("Message returned by broker", logging.RoutingKey(ret.RoutingKey),
+				zap.Uint16("replyCode", ret.ReplyCode), zap.String("replyText", ret.ReplyText))
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
-	return &RabbitMQPublisher{channel: ch}, nil
+	return &RabbitMQPublisher{
+		publisher: publisher,
+		encoder:   events.Encoder{Source: eventSource, ContentType: contentType},
+	}, nil
 }
 
-func (p *RabbitMQPublisher) PublishPasteCreated(paste *paste.Paste) error {
-	type PasteMessage struct {
-		ID         string    `json:"id"`
-		URL        string    `json:"url"`
-		Content    string    `json:"content"`
-		CreatedAt  time.Time `json:"created_at"`
-		PolicyType string    `json:"policy_type"`
-		Duration   string    `json:"duration"`
-	}
-
-	message := PasteMessage{
+func (p *RabbitMQPublisher) PublishPasteCreated(ctx context.Context, paste *paste.Paste) error {
+	msg, err := p.encoder.Encode(v1.PasteCreated{
 		ID:         paste.ID,
 		URL:        paste.URL,
 		Content:    paste.Content,
 		CreatedAt:  paste.CreatedAt,
-		PolicyType: string(paste.ExpirationPolicy.Type),
+		PolicyType: v1.PolicyType(paste.ExpirationPolicy.Type),
 		Duration:   paste.ExpirationPolicy.Duration,
-	}
-
-	body, err := json.Marshal(message)
+	})
 	if err != nil {
 		return err
 	}
-	return p.channel.Publish(
-		"pastebin_events", "paste.created", false, false,
-		amqp.Publishing{ContentType: "application/json", Body: body},
-	)
+	return p.publisher.Publish(ctx, events.RoutingKeyPasteCreated, msg)
 }
 
 func (p *RabbitMQPublisher) PublishPasteSave(ctx context.Context, pasteData []byte) error {
-	err := p.channel.PublishWithContext(
-		ctx,
-		"pastebin_events",
-		"paste.save",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        pasteData,
-		},
-	)
-	if err != nil {
-		return err
-	}
-	return nil
+	env := events.NewEnvelope(eventSource, events.RoutingKeyPasteSave, PasteSaveVersion)
+	return p.publisher.Publish(ctx, events.RoutingKeyPasteSave, env.Publishing(pasteData))
 }
 
 func (p *RabbitMQPublisher) Close() error {
-	return p.channel.Close()
+	return p.publisher.Close()
 }
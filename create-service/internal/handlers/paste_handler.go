@@ -1,14 +1,19 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/metrics"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/service/paste"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/shared"
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/ArsiHien/pastebin-ms/pkg/dlq"
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"github.com/ArsiHien/pastebin-ms/pkg/tracing"
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"net/http"
@@ -26,9 +31,9 @@ func NewPasteHandler(useCase *paste.CreatePasteUseCase, logger *zap.Logger) *Pas
 
 func (h *PasteHandler) CreatePaste(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
-	requestID := uuid.New().String()
-	ctx := context.WithValue(r.Context(), "requestID", requestID)
-	logger := h.Logger.With(zap.String("requestID", requestID))
+	// Request ID do requestid.Middleware gán, lấy từ X-Request-ID nếu client gửi
+	ctx := r.Context()
+	logger := logging.FromContext(ctx, h.Logger)
 
 	// Giai đoạn 1: Nhận yêu cầu
 	logger.Info("Received create paste request")
@@ -39,7 +44,7 @@ func (h *PasteHandler) CreatePaste(w http.ResponseWriter, r *http.Request) {
 	var req paste.CreatePasteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Error("Failed to decode request body", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 	logger.Info("Decoded request body", zap.Any("request", req))
@@ -51,31 +56,77 @@ func (h *PasteHandler) CreatePaste(w http.ResponseWriter, r *http.Request) {
 		var httpErr shared.HTTPError
 		if errors.As(err, &httpErr) {
 			logger.Error("Use case error", zap.Error(err), zap.Int("code", httpErr.Code))
-			w.WriteHeader(httpErr.Code)
-			_ = json.NewEncoder(w).Encode(httpErr)
+			apierror.Write(w, httpErr.Code, httpErr.Message)
 			return
 		}
 		logger.Error("Internal error", zap.Error(err))
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, shared.ErrInternal.Message)
 		return
 	}
 
 	// Giai đoạn 7: Trả về phản hồi
 	phaseStart = time.Now()
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		logger.Error("Failed to encode response", zap.Error(err))
 	}
-	logger.Info("Sent response", zap.String("url", resp.URL))
+	logger.Info("Sent response", logging.URL(resp.URL))
 	metrics.CreateRequestDuration.WithLabelValues("send_response").Observe(time.Since(phaseStart).Seconds())
 
 	totalDuration := time.Since(startTime).Seconds()
 	logger.Info("Request completed", zap.Float64("totalDurationSeconds", totalDuration))
 }
 
-func NewRouter(handler *PasteHandler) http.Handler {
+// Admin gom các thành phần của endpoint vận hành dưới /admin
+type Admin struct {
+	// Auth xác thực mọi request tới admin API; admin API chỉ được mount khi có Auth
+	Auth     func(http.Handler) http.Handler
+	DLQ      *dlq.Admin
+	LogLevel zap.AtomicLevel
+	// Config và ReloadConfig phục vụ /admin/config; bỏ qua nếu nil
+	Config       http.HandlerFunc
+	ReloadConfig http.HandlerFunc
+}
+
+// NewRouter mounts the API, validating requests against the OpenAPI spec.
+// probe answers /readyz and reports draining once shutdown starts.
+func NewRouter(handler *PasteHandler, probe *health.Probe, admin Admin) (http.Handler, error) {
+	spec, err := openapi.ForService(openapi.ServiceCreate)
+	if err != nil {
+		return nil, err
+	}
+	validate, err := openapi.Middleware(spec)
+	if err != nil {
+		return nil, err
+	}
+
 	r := chi.NewRouter()
-	r.Post("/api/pastes", handler.CreatePaste)
-	r.Get("/metrics", promhttp.Handler().ServeHTTP)
-	return r
+	r.Use(tracing.Middleware("create-service"))
+	r.Use(requestid.Middleware)
+	r.Group(func(r chi.Router) {
+		r.Use(validate)
+		r.Get("/openapi.json", openapi.Handler(spec))
+		r.Post("/api/pastes", handler.CreatePaste)
+		r.Get("/metrics", promhttp.Handler().ServeHTTP)
+		r.Get("/healthz", health.LiveHandler())
+		r.Get("/readyz", probe.ReadyHandler())
+	})
+	// Người gọi được xác thực trước khi request được validate để người gọi ẩn
+	// danh không biết gì về admin API
+	if admin.Auth != nil {
+		r.Group(func(r chi.Router) {
+			r.Use(admin.Auth)
+			r.Use(validate)
+			r.Handle("/admin/log-level", logging.LevelHandler(admin.LogLevel))
+			if admin.Config != nil {
+				r.Get("/admin/config", admin.Config)
+			}
+			if admin.ReloadConfig != nil {
+				r.Post("/admin/config/reload", admin.ReloadConfig)
+			}
+			r.Mount("/admin/dlq", dlq.NewRouter(admin.DLQ))
+		})
+	}
+	return r, nil
 }
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ArsiHien/pastebin-ms/create-service/internal/domain/paste"
+	pasteService "github.com/ArsiHien/pastebin-ms/create-service/internal/service/paste"
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi/openapitest"
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"go.uber.org/zap"
+)
+
+type policyRepo struct{}
+
+func (policyRepo) FindByPolicyTypeAndDuration(context.Context, paste.ExpirationPolicyType, string) (*paste.ExpirationPolicy, error) {
+	return nil, nil
+}
+func (policyRepo) Save(ctx context.Context, policy *paste.ExpirationPolicy) error { return nil }
+
+type publisher struct{ err error }
+
+func (p publisher) PublishPasteCreated(context.Context, *paste.Paste) error { return p.err }
+func (p publisher) PublishPasteSave(context.Context, []byte) error          { return p.err }
+func (p publisher) Close() error                                            { return nil }
+
+func newTestRouter(t *testing.T, pub publisher, ready error) http.Handler {
+	useCase := pasteService.NewCreatePasteUseCase(nil, policyRepo{}, pub, zap.NewNop())
+	router, err := NewRouter(NewPasteHandler(useCase, zap.NewNop()), health.NewProbe(map[string]health.Check{
+		"rabbitmq": func(context.Context) error { return ready },
+	}), Admin{LogLevel: zap.NewAtomicLevel()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		pub    publisher
+		ready  error
+		want   int
+	}{
+		{"create never", http.MethodPost, "/api/pastes", `{"content":"hi","policyType":"NEVER"}`, publisher{}, nil, http.StatusCreated},
+		{"create timed", http.MethodPost, "/api/pastes", `{"content":"hi","policyType":"TIMED","duration":"1hour"}`, publisher{}, nil, http.StatusCreated},
+		{"timed without duration", http.MethodPost, "/api/pastes", `{"content":"hi","policyType":"TIMED"}`, publisher{}, nil, http.StatusBadRequest},
+		{"broker down", http.MethodPost, "/api/pastes", `{"content":"hi","policyType":"NEVER"}`, publisher{err: errors.New("closed")}, nil, http.StatusInternalServerError},
+		{"live", http.MethodGet, "/healthz", ``, publisher{}, errors.New("reconnecting"), http.StatusOK},
+		{"ready", http.MethodGet, "/readyz", ``, publisher{}, nil, http.StatusOK},
+		{"not ready", http.MethodGet, "/readyz", ``, publisher{}, errors.New("reconnecting"), http.StatusServiceUnavailable},
+		{"spec", http.MethodGet, "/openapi.json", ``, publisher{}, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := openapitest.New(t, openapi.ServiceCreate, newTestRouter(t, tt.pub, tt.ready))
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := check.Do(req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+type recordingPublisher struct {
+	publisher
+	requestIDs []string
+}
+
+func (p *recordingPublisher) PublishPasteCreated(ctx context.Context, _ *paste.Paste) error {
+	p.requestIDs = append(p.requestIDs, requestid.FromContext(ctx))
+	return nil
+}
+
+func TestRequestIDPropagates(t *testing.T) {
+	pub := &recordingPublisher{}
+	useCase := pasteService.NewCreatePasteUseCase(nil, policyRepo{}, pub, zap.NewNop())
+	router, err := NewRouter(NewPasteHandler(useCase, zap.NewNop()), health.NewProbe(nil), Admin{LogLevel: zap.NewAtomicLevel()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sent := range []string{"trace-me-123", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/api/pastes", strings.NewReader(`{"content":"hi","policyType":"NEVER"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if sent != "" {
+			req.Header.Set(requestid.Header, sent)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		echoed := rec.Header().Get(requestid.Header)
+		if sent != "" && echoed != sent {
+			t.Errorf("echoed %s = %q, want %q", requestid.Header, echoed, sent)
+		}
+		if echoed == "" {
+			t.Errorf("no %s in response", requestid.Header)
+		}
+		if got := pub.requestIDs[len(pub.requestIDs)-1]; got != echoed {
+			t.Errorf("published with request ID %q, want %q", got, echoed)
+		}
+	}
+}
+
+func TestExecuteWithoutRequestID(t *testing.T) {
+	useCase := pasteService.NewCreatePasteUseCase(nil, policyRepo{}, publisher{}, zap.NewNop())
+	if _, err := useCase.Execute(context.Background(), pasteService.CreatePasteRequest{
+		Content: "hi", PolicyType: paste.NeverExpiration,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -14,6 +14,51 @@ var CreateRequestDuration = prometheus.NewHistogramVec(
 	[]string{"phase"},
 )
 
+// SaveBatchSize đo số lượng paste trong mỗi lần flush của MySQL save worker
+var SaveBatchSize = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "create_service_save_batch_size",
+		Help:    "Number of pastes written to MySQL per batch flush",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 9),
+	},
+)
+
+// SaveFlushDuration đo thời gian của mỗi lần flush batch vào MySQL
+var SaveFlushDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "create_service_save_flush_duration_seconds",
+		Help:    "Duration of each batch insert into MySQL",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"result"},
+)
+
+// RabbitMQConnected là 1 khi kết nối RabbitMQ đang mở, 0 khi đang kết nối lại
+var RabbitMQConnected = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "create_service_rabbitmq_connected",
+		Help: "Whether the RabbitMQ connection is currently up (1) or reconnecting (0)",
+	},
+)
+
+// RabbitMQReconnects đếm số lần kết nối lại RabbitMQ thành công
+var RabbitMQReconnects = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "create_service_rabbitmq_reconnects_total",
+		Help: "Number of successful RabbitMQ reconnects",
+	},
+)
+
+// DuplicateMessages đếm số message paste.save bị bỏ qua vì paste đã được lưu
+var DuplicateMessages = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "create_service_duplicate_messages_total",
+		Help: "Number of redelivered messages skipped because they were already processed",
+	},
+	[]string{"queue"},
+)
+
 func init() {
-	prometheus.MustRegister(CreateRequestDuration)
+	prometheus.MustRegister(CreateRequestDuration, SaveBatchSize, SaveFlushDuration,
+		RabbitMQConnected, RabbitMQReconnects, DuplicateMessages)
 }
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/domain/paste"
 	"gorm.io/gorm"
@@ -14,11 +15,11 @@ func NewExpirationPolicyMySQLRepository(db *gorm.DB) *ExpirationPolicyMySQLRepos
 	return &ExpirationPolicyMySQLRepository{db: db}
 }
 
-func (r *ExpirationPolicyMySQLRepository) FindByPolicyTypeAndDuration(
+func (r *ExpirationPolicyMySQLRepository) FindByPolicyTypeAndDuration(ctx context.Context,
 	policyType paste.ExpirationPolicyType, duration string) (*paste.ExpirationPolicy,
 	error) {
 	var policy paste.ExpirationPolicy
-	err := r.db.Where("policy_type = ? AND duration = ?", policyType, duration).First(&policy).Error
+	err := r.db.WithContext(ctx).Where("policy_type = ? AND duration = ?", policyType, duration).First(&policy).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -28,9 +29,9 @@ func (r *ExpirationPolicyMySQLRepository) FindByPolicyTypeAndDuration(
 	return &policy, nil
 }
 
-func (r *ExpirationPolicyMySQLRepository) Save(policy *paste.ExpirationPolicy) error {
+func (r *ExpirationPolicyMySQLRepository) Save(ctx context.Context, policy *paste.ExpirationPolicy) error {
 	if policy.ID != "" {
-		return r.db.Save(policy).Error
+		return r.db.WithContext(ctx).Save(policy).Error
 	}
-	return r.db.Create(policy).Error
+	return r.db.WithContext(ctx).Create(policy).Error
 }
@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"context"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/domain/paste"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PasteMySQLRepository struct {
@@ -16,3 +18,17 @@ func NewPasteMySQLRepository(db *gorm.DB) *PasteMySQLRepository {
 func (r *PasteMySQLRepository) Save(paste *paste.Paste) error {
 	return r.db.Create(paste).Error
 }
+
+// SaveBatch inserts all pastes in a single multi-row INSERT. Rows whose URL
+// already exists are skipped so that redelivered messages do not fail the
+// whole batch. It returns how many rows were actually inserted.
+func (r *PasteMySQLRepository) SaveBatch(ctx context.Context, pastes []*paste.Paste) (int64, error) {
+	if len(pastes) == 0 {
+		return 0, nil
+	}
+	result := r.db.WithContext(ctx).
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(pastes)
+	return result.RowsAffected, result.Error
+}
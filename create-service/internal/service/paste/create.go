@@ -6,6 +6,7 @@ import (
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/domain/paste"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/metrics"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/shared"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
 	"go.uber.org/zap"
 	"sync"
 	"time"
@@ -25,24 +26,29 @@ type CreatePasteUseCase struct {
 	PasteRepo            paste.Repository
 	ExpirationPolicyRepo paste.ExpirationPolicyRepository
 	Publisher            paste.EventPublisher
-	policyCache          map[string]*paste.ExpirationPolicy // Cache in-memory
-	cacheMutex           sync.RWMutex                       // Bảo vệ cache
+	Logger               *zap.Logger
+	// URLLength là số ký tự của URL sinh ra, mặc định 5
+	URLLength   int
+	policyCache map[string]*paste.ExpirationPolicy // Cache in-memory
+	cacheMutex  sync.RWMutex                       // Bảo vệ cache
 }
 
 func NewCreatePasteUseCase(pasteRepo paste.Repository,
 	expirationPolicyRepo paste.ExpirationPolicyRepository,
-	pub paste.EventPublisher) *CreatePasteUseCase {
+	pub paste.EventPublisher, logger *zap.Logger) *CreatePasteUseCase {
 	return &CreatePasteUseCase{
 		PasteRepo:            pasteRepo,
 		ExpirationPolicyRepo: expirationPolicyRepo,
 		Publisher:            pub,
+		Logger:               logger,
+		URLLength:            5,
 		policyCache:          make(map[string]*paste.ExpirationPolicy),
 	}
 }
 
 func (uc *CreatePasteUseCase) Execute(ctx context.Context, req CreatePasteRequest) (
 	*CreatePasteResponse, error) {
-	logger := zap.L().With(zap.String("requestID", ctx.Value("requestID").(string)))
+	logger := logging.FromContext(ctx, uc.Logger)
 
 	// Kiểm tra dữ liệu đầu vào
 	if req.Content == "" {
@@ -60,12 +66,12 @@ func (uc *CreatePasteUseCase) Execute(ctx context.Context, req CreatePasteReques
 
 	// Giai đoạn 3: Tạo URL ngẫu nhiên
 	phaseStart := time.Now()
-	url, err := shared.GenerateURL(5)
+	url, err := shared.GenerateURL(uc.URLLength)
 	if err != nil {
 		logger.Error("Failed to generate URL", zap.Error(err))
 		return nil, err
 	}
-	logger.Info("Generated random URL", zap.String("url", url))
+	logger.Info("Generated random URL", logging.URL(url))
 	metrics.CreateRequestDuration.WithLabelValues("generate_url").Observe(time.Since(phaseStart).Seconds())
 
 	// Giai đoạn 4: Tìm hoặc tạo Expiration Policy
@@ -79,7 +85,7 @@ func (uc *CreatePasteUseCase) Execute(ctx context.Context, req CreatePasteReques
 
 	if !exists {
 		// Cache miss, truy vấn MySQL
-		expirationPolicy, err = uc.ExpirationPolicyRepo.FindByPolicyTypeAndDuration(req.PolicyType, normalizedDuration)
+		expirationPolicy, err = uc.ExpirationPolicyRepo.FindByPolicyTypeAndDuration(ctx, req.PolicyType, normalizedDuration)
 		if err != nil {
 			logger.Error("Failed to find expiration policy", zap.Error(err))
 			return nil, err
@@ -89,7 +95,7 @@ func (uc *CreatePasteUseCase) Execute(ctx context.Context, req CreatePasteReques
 				Type:     req.PolicyType,
 				Duration: normalizedDuration,
 			}
-			if err := uc.ExpirationPolicyRepo.Save(expirationPolicy); err != nil {
+			if err := uc.ExpirationPolicyRepo.Save(ctx, expirationPolicy); err != nil {
 				logger.Error("Failed to save expiration policy", zap.Error(err))
 				return nil, err
 			}
@@ -128,16 +134,16 @@ func (uc *CreatePasteUseCase) Execute(ctx context.Context, req CreatePasteReques
 		logger.Error("Failed to publish paste to save queue", zap.Error(err))
 		return nil, err
 	}
-	logger.Info("Published paste to save queue", zap.String("url", url))
+	logger.Info("Published paste to save queue", logging.URL(url))
 	metrics.CreateRequestDuration.WithLabelValues("rabbitmq_publish_save").Observe(time.Since(phaseStart).Seconds())
 
 	// Giai đoạn 6: Publish sự kiện paste.created
 	phaseStart = time.Now()
-	if err := uc.Publisher.PublishPasteCreated(&newPaste); err != nil {
+	if err := uc.Publisher.PublishPasteCreated(ctx, &newPaste); err != nil {
 		logger.Error("Failed to publish paste.created event", zap.Error(err))
 		return nil, err
 	}
-	logger.Info("Published paste.created event", zap.String("url", url))
+	logger.Info("Published paste.created event", logging.URL(url))
 	metrics.CreateRequestDuration.WithLabelValues("rabbitmq_publish").Observe(time.Since(phaseStart).Seconds())
 
 	return &CreatePasteResponse{URL: newPaste.URL}, nil
@@ -3,27 +3,103 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/domain/paste"
+	"github.com/ArsiHien/pastebin-ms/create-service/internal/eventbus"
 	"github.com/ArsiHien/pastebin-ms/create-service/internal/metrics"
+	"github.com/ArsiHien/pastebin-ms/events"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"strings"
+	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
+// MySQLSaveWorkerConfig điều chỉnh số consumer, prefetch và cách gom batch
+type MySQLSaveWorkerConfig struct {
+	Concurrency   int
+	Prefetch      int
+	BatchSize     int
+	FlushInterval time.Duration
+	FlushTimeout  time.Duration
+	Retry         rabbitmq.RetryPolicy
+	Decoder       events.Decoder
+	Logger        *zap.Logger
+}
+
 type MySQLSaveWorker struct {
-	channel   *amqp.Channel
+	conn      *rabbitmq.Connection
 	repo      paste.Repository
+	cfg       MySQLSaveWorkerConfig
 	queueName string
+	retrier   *rabbitmq.Retrier
+
+	consumers []*rabbitmq.Consumer
+	wg        sync.WaitGroup
 }
 
-func NewMySQLSaveWorker(conn *amqp.Connection, repo paste.Repository) (*MySQLSaveWorker, error) {
+func NewMySQLSaveWorker(conn *rabbitmq.Connection, repo paste.Repository,
+	cfg MySQLSaveWorkerConfig) (*MySQLSaveWorker, error) {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	if cfg.Prefetch < cfg.BatchSize {
+		cfg.Prefetch = cfg.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 200 * time.Millisecond
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = 30 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+
+	w := &MySQLSaveWorker{
+		conn:      conn,
+		repo:      repo,
+		cfg:       cfg,
+		queueName: "paste_save_queue",
+	}
+
+	// Khai báo queue ngay để paste.save có chỗ route trước khi consumer chạy
 	ch, err := conn.Channel()
 	if err != nil {
 		return nil, err
 	}
+	defer ch.Close()
+	if err := w.declare(ch); err != nil {
+		return nil, err
+	}
+
+	retrier, err := rabbitmq.NewRetrier(conn, w.queueName, cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	w.retrier = retrier
+
+	return w, nil
+}
+
+// QueueName trả về tên queue mà worker consume
+func (w *MySQLSaveWorker) QueueName() string {
+	return w.queueName
+}
+
+// declare khai báo queue, binding, các retry queue và DLQ; được gọi lại mỗi
+// khi channel được mở lại
+func (w *MySQLSaveWorker) declare(ch *amqp.Channel) error {
+	if err := rabbitmq.DeclareRetryTopology(ch, w.queueName, w.cfg.Retry); err != nil {
+		return err
+	}
 
 	q, err := ch.QueueDeclare(
-		"paste_save_queue",
+		w.queueName,
 		true,
 		false,
 		false,
@@ -31,83 +107,187 @@ func NewMySQLSaveWorker(conn *amqp.Connection, repo paste.Repository) (*MySQLSav
 		nil,
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = ch.QueueBind(
+	return ch.QueueBind(
 		q.Name,
-		"paste.save",
-		"pastebin_events",
+		events.RoutingKeyPasteSave,
+		events.Exchange,
 		false,
 		nil,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &MySQLSaveWorker{
-		channel:   ch,
-		repo:      repo,
-		queueName: q.Name,
-	}, nil
 }
 
+// Start chạy một pool consumer, mỗi consumer có channel riêng với QoS
+// prefetch và tự đăng ký lại khi kết nối RabbitMQ được khôi phục.
 func (w *MySQLSaveWorker) Start() error {
-	msgs, err := w.channel.Consume(
-		w.queueName,
-		"mysql-save-consumer",
-		false, // Manual ack
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+	for i := 0; i < w.cfg.Concurrency; i++ {
+		consumer := w.conn.NewConsumer(rabbitmq.ConsumerOptions{
+			Queue:    w.queueName,
+			Tag:      fmt.Sprintf("mysql-save-consumer-%d", i),
+			Prefetch: w.cfg.Prefetch,
+			Setup:    w.declare,
+			OnError: func(err error) {
+				w.cfg.Logger.Error("MySQL save consumer could not subscribe", zap.Error(err))
+			},
+		})
+		w.consumers = append(w.consumers, consumer)
+
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			if err := consumer.Run(context.Background(), w.consume); err != nil {
+				w.cfg.Logger.Error("MySQL save consumer stopped", zap.Error(err))
+			}
+		}()
 	}
 
-	go func() {
-		for msg := range msgs {
-			w.handleMessage(msg)
+	return nil
+}
+
+// consume gom message vào batch và flush khi đủ BatchSize hoặc hết FlushInterval
+func (w *MySQLSaveWorker) consume(msgs <-chan amqp.Delivery) {
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	deliveries := make([]amqp.Delivery, 0, w.cfg.BatchSize)
+	pastes := make([]*paste.Paste, 0, w.cfg.BatchSize)
+
+	flush := func() {
+		if len(deliveries) == 0 {
+			return
 		}
-	}()
+		w.flush(deliveries, pastes)
+		deliveries = deliveries[:0]
+		pastes = pastes[:0]
+	}
 
-	return nil
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				flush()
+				return
+			}
+
+			var p paste.Paste
+			_, err := w.cfg.Decoder.Envelope(msg, events.RoutingKeyPasteSave, eventbus.PasteSaveVersion)
+			if err == nil {
+				err = json.Unmarshal(msg.Body, &p)
+			}
+			if err != nil {
+				logger := w.cfg.Logger.With(logging.RequestID(rabbitmq.RequestID(msg)))
+				logger.Error("Failed to decode paste from save queue", zap.Error(err))
+				if err := w.retrier.DeadLetter(context.Background(), msg, err); err != nil {
+					logger.Error("Failed to dead-letter message", zap.Error(err))
+				}
+				continue
+			}
+
+			deliveries = append(deliveries, msg)
+			pastes = append(pastes, &p)
+			if len(deliveries) >= w.cfg.BatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
 }
 
-func (w *MySQLSaveWorker) handleMessage(msg amqp.Delivery) {
+// flush ghi cả batch bằng một câu INSERT nhiều dòng, sau đó ack từng message.
+// Nếu ghi thất bại, các paste được ghi lại từng cái một (saveEach) để chỉ
+// những message lỗi đi vào retry queue và DLQ.
+func (w *MySQLSaveWorker) flush(deliveries []amqp.Delivery, pastes []*paste.Paste) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.FlushTimeout)
+	defer cancel()
+	// Span của batch nối tới trace của từng paste đã tạo
+	ctx, span := rabbitmq.StartBatchSpan(ctx, w.queueName, deliveries)
 
 	phaseStart := time.Now()
-	var p paste.Paste
-	if err := json.Unmarshal(msg.Body, &p); err != nil {
-		if err := msg.Nack(false, false); err != nil {
+	inserted, err := w.repo.SaveBatch(ctx, pastes)
+	elapsed := time.Since(phaseStart).Seconds()
 
+	metrics.SaveBatchSize.Observe(float64(len(pastes)))
+	if err != nil {
+		metrics.SaveFlushDuration.WithLabelValues("error").Observe(elapsed)
+		w.cfg.Logger.Error("Failed to save batch", zap.Int("size", len(pastes)), zap.Error(err))
+		rabbitmq.EndSpan(span, err)
+		if len(pastes) == 1 {
+			w.retry(deliveries[0], err)
+			return
 		}
+		w.saveEach(deliveries, pastes)
 		return
 	}
+	defer span.End()
+	metrics.SaveFlushDuration.WithLabelValues("success").Observe(elapsed)
+	// Message được giao lại có URL trùng nên bị ON DUPLICATE KEY bỏ qua
+	if dup := int64(len(pastes)) - inserted; dup > 0 {
+		metrics.DuplicateMessages.WithLabelValues(w.queueName).Add(float64(dup))
+	}
+	metrics.CreateRequestDuration.WithLabelValues("mysql_save").Observe(elapsed)
+
+	for _, msg := range deliveries {
+		w.ack(msg)
+	}
+}
 
-	_, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// saveEach ghi lại từng paste của một batch thất bại, để một dòng lỗi không
+// kéo các paste hợp lệ cùng batch vào retry queue rồi DLQ. Paste ghi được
+// thì ack, paste lỗi mới được retry; cả lượt dùng chung FlushTimeout.
+func (w *MySQLSaveWorker) saveEach(deliveries []amqp.Delivery, pastes []*paste.Paste) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.FlushTimeout)
 	defer cancel()
 
-	if err := w.repo.Save(&p); err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") && strings.Contains(err.Error(), "uni_pastes_url") {
-			if err := msg.Ack(false); err != nil {
-			}
-			return
+	var failed int
+	for i, msg := range deliveries {
+		inserted, err := w.repo.SaveBatch(ctx, pastes[i:i+1])
+		if err != nil {
+			failed++
+			w.cfg.Logger.Error("Failed to save paste", logging.URL(pastes[i].URL),
+				logging.RequestID(rabbitmq.RequestID(msg)), zap.Error(err))
+			w.retry(msg, err)
+			continue
 		}
-		if err := msg.Nack(false, true); err != nil {
+		if inserted == 0 {
+			metrics.DuplicateMessages.WithLabelValues(w.queueName).Inc()
 		}
-		return
+		w.ack(msg)
 	}
-	if err := msg.Ack(false); err != nil {
+	w.cfg.Logger.Info("Saved failed batch row by row", zap.Int("size", len(deliveries)),
+		zap.Int("failed", failed))
+}
+
+// retry đưa message vào retry queue, hoặc vào DLQ khi đã hết số lần thử
+func (w *MySQLSaveWorker) retry(msg amqp.Delivery, cause error) {
+	if err := w.retrier.Retry(context.Background(), msg, cause); err != nil {
+		w.cfg.Logger.Error("Failed to schedule retry", logging.RequestID(rabbitmq.RequestID(msg)),
+			zap.Error(err))
 	}
+}
 
-	metrics.CreateRequestDuration.WithLabelValues("mysql_save").Observe(time.Since(phaseStart).Seconds())
+func (w *MySQLSaveWorker) ack(msg amqp.Delivery) {
+	if err := msg.Ack(false); err != nil {
+		w.cfg.Logger.Error("Failed to ack message", zap.Error(err))
+	}
 }
 
+// Stop huỷ các consumer và chờ các batch đang gom được flush
 func (w *MySQLSaveWorker) Stop() error {
-	if err := w.channel.Close(); err != nil {
-		return err
+	var firstErr error
+	for _, consumer := range w.consumers {
+		if err := consumer.Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
-	return nil
+
+	w.wg.Wait()
+
+	if err := w.retrier.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
 }
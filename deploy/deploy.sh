@@ -101,9 +101,64 @@ done
 
 # Triển khai stack ứng dụng
 echo -e "${YELLOW}Triển khai stack ứng dụng...${NC}"
-sudo docker stack deploy --with-registry-auth -c application.yml application
+# Mọi service dùng chung token admin; CLEANUP_ADMIN_TOKENS là tên cũ
+PASTEBIN_ADMIN_TOKENS="${PASTEBIN_ADMIN_TOKENS:-$CLEANUP_ADMIN_TOKENS}"
+if [ -z "$PASTEBIN_ADMIN_TOKENS" ]; then
+  echo -e "${YELLOW}PASTEBIN_ADMIN_TOKENS chưa được đặt, mọi request admin tới các service sẽ bị từ chối${NC}"
+fi
+# sudo không giữ biến môi trường nên phải truyền token vào tường minh
+sudo PASTEBIN_ADMIN_TOKENS="$PASTEBIN_ADMIN_TOKENS" docker stack deploy --with-registry-auth -c application.yml application
 echo -e "${GREEN}Đã triển khai stack ứng dụng${NC}"
 
+# Hàm kiểm tra /readyz của service ứng dụng từ bên trong container
+check_ready() {
+  local container=$1
+  local port=$2
+
+  if sudo docker exec "$container" wget -qO- "http://localhost:${port}/readyz" >/dev/null 2>&1; then
+    echo -e "${GREEN}Service ${container} đã ready${NC}"
+    return 0
+  fi
+  echo -e "${YELLOW}Service ${container} chưa ready${NC}"
+  return 1
+}
+
+# Đợi các service ứng dụng healthy (/healthz) rồi ready (/readyz)
+echo -e "${YELLOW}Đợi các service ứng dụng khởi động...${NC}"
+
+declare -A app_ports=(
+  ["application_create-service"]=8081
+  ["application_retrieval-service"]=8082
+  ["application_cleanup-service"]=8084
+  ["application_analytics-service"]=8085
+)
+
+for service in "${!app_ports[@]}"; do
+  until sudo docker service ls | grep "$service" | grep -q -E "1/1|2/2"; do
+    echo "Đang đợi service ${service} triển khai đầy đủ..."
+    sleep 5
+  done
+
+  # Chỉ kiểm tra được container chạy trên node hiện tại
+  container_name=$(sudo docker ps --filter "name=${service}" --format "{{.Names}}" | head -n 1)
+  if [ -z "$container_name" ]; then
+    echo -e "${YELLOW}Không tìm thấy container cho service ${service} trên node này, bỏ qua kiểm tra health${NC}"
+    continue
+  fi
+
+  until check_health "$container_name"; do
+    echo "Đang đợi ${container_name} healthy..."
+    sleep 10
+  done
+
+  until check_ready "$container_name" "${app_ports[$service]}"; do
+    echo "Đang đợi ${container_name} ready..."
+    sleep 5
+  done
+
+  echo -e "${GREEN}Service ${service} đã sẵn sàng${NC}"
+done
+
 # Kiểm tra trạng thái của tất cả các service
 echo -e "${YELLOW}Kiểm tra trạng thái tất cả các service...${NC}"
 sudo docker stack services infrastructure
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SpecVersion is the CloudEvents specification version produced.
+const SpecVersion = "1.0"
+
+// CloudEvents attributes in binary content mode, carried as AMQP headers as
+// described by the CloudEvents AMQP protocol binding. datacontenttype maps to
+// the AMQP content-type property.
+const (
+	HeaderSpecVersion = "cloudEvents:specversion"
+	HeaderID          = "cloudEvents:id"
+	HeaderSource      = "cloudEvents:source"
+	HeaderType        = "cloudEvents:type"
+	HeaderTime        = "cloudEvents:time"
+	HeaderDataSchema  = "cloudEvents:dataschema"
+)
+
+const schemaPrefix = "urn:pastebin-ms:events:"
+
+// Envelope holds the CloudEvents context attributes of a message.
+type Envelope struct {
+	ID              string
+	Source          string
+	Type            string
+	SpecVersion     string
+	Time            time.Time
+	DataContentType string
+	DataSchema      string
+}
+
+// NewEnvelope returns an envelope with a fresh ID for an event of the given
+// type and schema version.
+func NewEnvelope(source, eventType, version string) Envelope {
+	return Envelope{
+		ID:              newID(),
+		Source:          source,
+		Type:            eventType,
+		SpecVersion:     SpecVersion,
+		Time:            time.Now().UTC(),
+		DataContentType: ContentTypeJSON,
+		DataSchema:      DataSchema(eventType, version),
+	}
+}
+
+// DataSchema returns the schema URI of an event type at a version, e.g.
+// "urn:pastebin-ms:events:v1:paste.created".
+func DataSchema(eventType, version string) string {
+	return schemaPrefix + "v" + version + ":" + eventType
+}
+
+// Version returns the schema version recorded in the dataschema attribute,
+// defaulting to "1".
+func (e Envelope) Version() string {
+	rest, ok := strings.CutPrefix(e.DataSchema, schemaPrefix+"v")
+	if !ok {
+		return "1"
+	}
+	version, _, _ := strings.Cut(rest, ":")
+	return version
+}
+
+// Publishing returns a binary-mode message carrying data. The ID, type and
+// time are also set on the AMQP properties so that tooling which knows
+// nothing about CloudEvents still sees them.
+func (e Envelope) Publishing(data []byte) amqp.Publishing {
+	return amqp.Publishing{
+		Headers: amqp.Table{
+			HeaderSpecVersion: e.SpecVersion,
+			HeaderID:          e.ID,
+			HeaderSource:      e.Source,
+			HeaderType:        e.Type,
+			HeaderTime:        e.Time.Format(time.RFC3339Nano),
+			HeaderDataSchema:  e.DataSchema,
+		},
+		ContentType: e.DataContentType,
+		MessageId:   e.ID,
+		Type:        e.Type,
+		AppId:       e.Source,
+		Timestamp:   e.Time,
+		Body:        data,
+	}
+}
+
+// ParseEnvelope reads the CloudEvents attributes of d. It returns
+// ErrNotCloudEvent if d has no specversion header.
+func ParseEnvelope(d amqp.Delivery) (Envelope, error) {
+	spec, _ := d.Headers[HeaderSpecVersion].(string)
+	if spec == "" {
+		return Envelope{}, ErrNotCloudEvent
+	}
+	if major(spec) != major(SpecVersion) {
+		return Envelope{}, fmt.Errorf("%w: specversion %s", ErrUnsupportedVersion, spec)
+	}
+
+	env := Envelope{
+		SpecVersion:     spec,
+		ID:              header(d, HeaderID),
+		Source:          header(d, HeaderSource),
+		Type:            header(d, HeaderType),
+		DataSchema:      header(d, HeaderDataSchema),
+		DataContentType: d.ContentType,
+	}
+	if env.ID == "" || env.Source == "" || env.Type == "" {
+		return env, fmt.Errorf("%w: missing id, source or type", ErrNotCloudEvent)
+	}
+	if t := header(d, HeaderTime); t != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return env, fmt.Errorf("invalid %s: %w", HeaderTime, err)
+		}
+		env.Time = parsed
+	}
+	return env, nil
+}
+
+// bareEnvelope describes a pre-CloudEvents message as well as its AMQP
+// properties allow.
+func bareEnvelope(d amqp.Delivery) Envelope {
+	return Envelope{
+		ID:              d.MessageId,
+		Source:          d.AppId,
+		Type:            d.Type,
+		Time:            d.Timestamp,
+		DataContentType: d.ContentType,
+	}
+}
+
+func header(d amqp.Delivery, key string) string {
+	s, _ := d.Headers[key].(string)
+	return s
+}
+
+func major(version string) string {
+	if i := strings.IndexByte(version, '.'); i >= 0 {
+		return version[:i]
+	}
+	return version
+}
+
+// newID returns a random (version 4) UUID.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	env := NewEnvelope("/create-service", RoutingKeyPasteCreated, "1")
+	msg := env.Publishing([]byte(`{}`))
+
+	got, err := ParseEnvelope(amqp.Delivery{Headers: msg.Headers, ContentType: msg.ContentType})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got.ID != env.ID || got.Source != env.Source || got.Type != env.Type ||
+		got.DataSchema != env.DataSchema || got.DataContentType != ContentTypeJSON {
+		t.Errorf("got %+v, want %+v", got, env)
+	}
+	if !got.Time.Equal(env.Time) {
+		t.Errorf("time = %v, want %v", got.Time, env.Time)
+	}
+	if got.Version() != "1" {
+		t.Errorf("version = %q", got.Version())
+	}
+}
+
+func TestParseEnvelopeRejectsUnknownSpecVersion(t *testing.T) {
+	d := amqp.Delivery{Headers: amqp.Table{
+		HeaderSpecVersion: "2.0",
+		HeaderID:          "1",
+		HeaderSource:      "/x",
+		HeaderType:        RoutingKeyPasteViewed,
+		HeaderTime:        time.Now().Format(time.RFC3339),
+	}}
+	if _, err := ParseEnvelope(d); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("err = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestDecoderRejectsWrongType(t *testing.T) {
+	msg := NewEnvelope("/x", RoutingKeyPasteViewed, "1").Publishing(nil)
+	d := amqp.Delivery{Headers: msg.Headers}
+	if _, err := (Decoder{}).Envelope(d, RoutingKeyPasteCreated, "1"); !errors.Is(err, ErrUnexpectedType) {
+		t.Fatalf("err = %v, want ErrUnexpectedType", err)
+	}
+}
+
+func TestNewIDIsUUIDv4(t *testing.T) {
+	id := newID()
+	if len(id) != 36 || id[14] != '4' {
+		t.Errorf("id = %q", id)
+	}
+	if id == newID() {
+		t.Error("ids repeat")
+	}
+}
@@ -0,0 +1,166 @@
+// Package events is the wire contract shared by every pastebin service: the
+// exchange, routing keys and the versioned payloads published on it.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange is the topic exchange all pastebin events are published to.
+const (
+	Exchange     = "pastebin_events"
+	ExchangeType = "topic"
+)
+
+// Routing keys. They double as the CloudEvents type of each event.
+const (
+	RoutingKeyPasteCreated             = "paste.created"
+	RoutingKeyPasteSave                = "paste.save"
+	RoutingKeyPasteViewed              = "paste.viewed"
+	RoutingKeyBurnAfterReadPasteViewed = "paste.burn_after_read_paste_viewed"
+)
+
+// Content types a payload can be encoded with.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when a message was produced with a
+	// major schema or spec version the consumer does not understand.
+	ErrUnsupportedVersion = errors.New("events: unsupported event version")
+	// ErrNotCloudEvent is returned for bare messages when the Decoder does
+	// not accept them.
+	ErrNotCloudEvent = errors.New("events: message is not a CloudEvent")
+	// ErrUnexpectedType is returned when the CloudEvents type does not match
+	// the payload being decoded.
+	ErrUnexpectedType = errors.New("events: unexpected event type")
+	// ErrUnsupportedContentType is returned for payloads in an encoding the
+	// event has no codec for.
+	ErrUnsupportedContentType = errors.New("events: unsupported content type")
+)
+
+// Event is a payload published on Exchange.
+type Event interface {
+	// RoutingKey is the key the event is published with.
+	RoutingKey() string
+	// Version is the schema version, "<major>" or "<major>.<minor>".
+	Version() string
+}
+
+// ProtoMarshaler is implemented by events with a protobuf encoding.
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+// ProtoEvent is an Event that can be decoded from protobuf.
+type ProtoEvent interface {
+	Event
+	ProtoMarshaler
+	UnmarshalProto(data []byte) error
+}
+
+// DeclareExchange declares Exchange on ch.
+func DeclareExchange(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(Exchange, ExchangeType, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", Exchange, err)
+	}
+	return nil
+}
+
+// Encode returns the JSON encoding of e.
+func Encode(e Event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// NewPublishing encodes e as JSON into a CloudEvent from source, ready to be
+// published with e.RoutingKey().
+func NewPublishing(source string, e Event) (amqp.Publishing, error) {
+	return Encoder{Source: source}.Encode(e)
+}
+
+// Encoder turns events into CloudEvents.
+type Encoder struct {
+	// Source is the CloudEvents source, identifying the producing service.
+	Source string
+	// ContentType selects the payload encoding. Events without a protobuf
+	// encoding are always sent as JSON. Empty means ContentTypeJSON.
+	ContentType string
+}
+
+// Encode encodes e into a message ready to be published with e.RoutingKey().
+func (enc Encoder) Encode(e Event) (amqp.Publishing, error) {
+	env := NewEnvelope(enc.Source, e.RoutingKey(), e.Version())
+
+	var data []byte
+	var err error
+	if pm, ok := e.(ProtoMarshaler); ok && enc.ContentType == ContentTypeProtobuf {
+		env.DataContentType = ContentTypeProtobuf
+		data, err = pm.MarshalProto()
+	} else {
+		data, err = Encode(e)
+	}
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("failed to encode %s: %w", e.RoutingKey(), err)
+	}
+	return env.Publishing(data), nil
+}
+
+// Decoder reads CloudEvents off deliveries.
+type Decoder struct {
+	// AcceptBareJSON also accepts messages without a CloudEvents envelope,
+	// as sent before the envelope was introduced. They are treated as
+	// version 1.
+	AcceptBareJSON bool
+}
+
+// Envelope parses the envelope of d and checks that it carries eventType in a
+// major version compatible with version.
+func (dec Decoder) Envelope(d amqp.Delivery, eventType, version string) (Envelope, error) {
+	env, err := ParseEnvelope(d)
+	if errors.Is(err, ErrNotCloudEvent) && dec.AcceptBareJSON {
+		return bareEnvelope(d), nil
+	}
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	if env.Type != eventType {
+		return env, fmt.Errorf("%w: got %q, want %q", ErrUnexpectedType, env.Type, eventType)
+	}
+	if got := env.Version(); major(got) != major(version) {
+		return env, fmt.Errorf("%w: %s v%s", ErrUnsupportedVersion, env.Type, got)
+	}
+	return env, nil
+}
+
+// Decode checks the envelope of d against e and unmarshals the data into e,
+// using the codec selected by the message's content type.
+func (dec Decoder) Decode(d amqp.Delivery, e Event) (Envelope, error) {
+	env, err := dec.Envelope(d, e.RoutingKey(), e.Version())
+	if err != nil {
+		return env, err
+	}
+
+	switch env.DataContentType {
+	case ContentTypeJSON, "":
+		err = json.Unmarshal(d.Body, e)
+	case ContentTypeProtobuf:
+		pe, ok := e.(ProtoEvent)
+		if !ok {
+			return env, fmt.Errorf("%w: %s for %s", ErrUnsupportedContentType, env.DataContentType, e.RoutingKey())
+		}
+		err = pe.UnmarshalProto(d.Body)
+	default:
+		return env, fmt.Errorf("%w: %s", ErrUnsupportedContentType, env.DataContentType)
+	}
+	if err != nil {
+		return env, fmt.Errorf("failed to decode %s: %w", e.RoutingKey(), err)
+	}
+	return env, nil
+}
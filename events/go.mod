@@ -0,0 +1,10 @@
+module github.com/ArsiHien/pastebin-ms/events
+
+go 1.24
+
+require (
+	github.com/rabbitmq/amqp091-go v1.10.0
+	google.golang.org/protobuf v1.36.5
+)
+
+require github.com/google/go-cmp v0.7.0 // indirect
@@ -0,0 +1,77 @@
+package v1_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+)
+
+var encodings = []struct {
+	name        string
+	contentType string
+}{
+	{"json", events.ContentTypeJSON},
+	{"protobuf", events.ContentTypeProtobuf},
+}
+
+// pasteCreated returns an event whose content has the given size and
+// includes characters JSON has to escape.
+func pasteCreated(size int) v1.PasteCreated {
+	line := "func main() {\n\tfmt.Println(\"<hello>\")\n}\n"
+	return v1.PasteCreated{
+		ID:         "0f8b1c2e-6a3d-4d4e-9b1a-2c5d7e8f9a0b",
+		URL:        "aB3dE5gH",
+		Content:    strings.Repeat(line, size/len(line)+1)[:size],
+		CreatedAt:  time.Now(),
+		PolicyType: v1.PolicyTimed,
+		Duration:   "1hour",
+	}
+}
+
+func BenchmarkEncodePasteCreated(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10} {
+		event := pasteCreated(size)
+		for _, e := range encodings {
+			enc := events.Encoder{Source: "/bench", ContentType: e.contentType}
+			b.Run(fmt.Sprintf("%s/%dKiB", e.name, size>>10), func(b *testing.B) {
+				b.ReportAllocs()
+				var n int
+				for i := 0; i < b.N; i++ {
+					msg, err := enc.Encode(event)
+					if err != nil {
+						b.Fatal(err)
+					}
+					n = len(msg.Body)
+				}
+				b.ReportMetric(float64(n), "bytes/msg")
+			})
+		}
+	}
+}
+
+func BenchmarkDecodePasteCreated(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10} {
+		event := pasteCreated(size)
+		for _, e := range encodings {
+			msg, err := events.Encoder{Source: "/bench", ContentType: e.contentType}.Encode(event)
+			if err != nil {
+				b.Fatal(err)
+			}
+			d := delivery(msg)
+			b.Run(fmt.Sprintf("%s/%dKiB", e.name, size>>10), func(b *testing.B) {
+				b.ReportAllocs()
+				b.ReportMetric(float64(len(d.Body)), "bytes/msg")
+				for i := 0; i < b.N; i++ {
+					var got v1.PasteCreated
+					if _, err := (events.Decoder{}).Decode(d, &got); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
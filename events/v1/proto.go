@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events/v1/v1pb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Protobuf codecs, see v1pb/events.proto. A zero time travels as an unset
+// timestamp so that both encodings round-trip identically.
+
+func (e PasteCreated) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&v1pb.PasteCreated{
+		Id:         e.ID,
+		Url:        e.URL,
+		Content:    e.Content,
+		CreatedAt:  toTimestamp(e.CreatedAt),
+		PolicyType: string(e.PolicyType),
+		Duration:   e.Duration,
+	})
+}
+
+func (e *PasteCreated) UnmarshalProto(data []byte) error {
+	var m v1pb.PasteCreated
+	if err := proto.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*e = PasteCreated{
+		ID:         m.GetId(),
+		URL:        m.GetUrl(),
+		Content:    m.GetContent(),
+		CreatedAt:  fromTimestamp(m.GetCreatedAt()),
+		PolicyType: PolicyType(m.GetPolicyType()),
+		Duration:   m.GetDuration(),
+	}
+	return nil
+}
+
+func (e PasteViewed) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&v1pb.PasteViewed{
+		Url:      e.URL,
+		ViewedAt: toTimestamp(e.ViewedAt),
+	})
+}
+
+func (e *PasteViewed) UnmarshalProto(data []byte) error {
+	var m v1pb.PasteViewed
+	if err := proto.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*e = PasteViewed{URL: m.GetUrl(), ViewedAt: fromTimestamp(m.GetViewedAt())}
+	return nil
+}
+
+func (e BurnAfterReadPasteViewed) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&v1pb.BurnAfterReadPasteViewed{Url: e.URL})
+}
+
+func (e *BurnAfterReadPasteViewed) UnmarshalProto(data []byte) error {
+	var m v1pb.BurnAfterReadPasteViewed
+	if err := proto.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*e = BurnAfterReadPasteViewed{URL: m.GetUrl()}
+	return nil
+}
+
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,53 @@
+// Package v1 holds version 1 of the pastebin event payloads.
+package v1
+
+import (
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+)
+
+// Version is the schema version of every payload in this package.
+const Version = "1"
+
+// PolicyType is the expiration policy of a paste.
+type PolicyType string
+
+const (
+	PolicyTimed         PolicyType = "TIMED"
+	PolicyNever         PolicyType = "NEVER"
+	PolicyBurnAfterRead PolicyType = "BURN_AFTER_READ"
+)
+
+// PasteCreated is published by create-service once a paste is accepted.
+type PasteCreated struct {
+	ID         string     `json:"id"`
+	URL        string     `json:"url"`
+	Content    string     `json:"content"`
+	CreatedAt  time.Time  `json:"created_at"`
+	PolicyType PolicyType `json:"policy_type"`
+	Duration   string     `json:"duration"`
+}
+
+func (PasteCreated) RoutingKey() string { return events.RoutingKeyPasteCreated }
+func (PasteCreated) Version() string    { return Version }
+
+// PasteViewed is published by retrieval-service on every read.
+type PasteViewed struct {
+	URL      string    `json:"url"`
+	ViewedAt time.Time `json:"viewed_at"`
+}
+
+func (PasteViewed) RoutingKey() string { return events.RoutingKeyPasteViewed }
+func (PasteViewed) Version() string    { return Version }
+
+// BurnAfterReadPasteViewed is published by retrieval-service when a
+// burn-after-read paste has been consumed.
+type BurnAfterReadPasteViewed struct {
+	URL string `json:"url"`
+}
+
+func (BurnAfterReadPasteViewed) RoutingKey() string {
+	return events.RoutingKeyBurnAfterReadPasteViewed
+}
+func (BurnAfterReadPasteViewed) Version() string { return Version }
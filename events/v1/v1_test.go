@@ -0,0 +1,250 @@
+package v1_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// The fixtures in testdata/v1 are the published wire format. Producers encode
+// with these types and consumers decode with them, so any change to a field
+// name, type or tag shows up here before it reaches the broker.
+var fixtures = []fixture{
+	{
+		event: &v1.PasteCreated{
+			ID:         "0f8b1c2e-6a3d-4d4e-9b1a-2c5d7e8f9a0b",
+			URL:        "aB3dE5gH",
+			Content:    "hello, world",
+			CreatedAt:  time.Date(2025, 4, 1, 10, 0, 0, 0, time.UTC),
+			PolicyType: v1.PolicyTimed,
+			Duration:   "1hour",
+		},
+		empty: func() events.Event { return &v1.PasteCreated{} },
+	},
+	{
+		file: "paste.created.never",
+		event: &v1.PasteCreated{
+			ID:         "5d2c9e1a-3b7f-4a60-8c1e-9f0a2b3c4d5e",
+			URL:        "nV3rE9xP",
+			Content:    "hello, world",
+			CreatedAt:  time.Date(2025, 4, 1, 10, 0, 0, 0, time.UTC),
+			PolicyType: v1.PolicyNever,
+		},
+		empty: func() events.Event { return &v1.PasteCreated{} },
+	},
+	{
+		file: "paste.created.burn_after_read",
+		event: &v1.PasteCreated{
+			ID:         "8a7b6c5d-4e3f-4a1b-9c8d-7e6f5a4b3c2d",
+			URL:        "bU7nR4aD",
+			Content:    "hello, world",
+			CreatedAt:  time.Date(2025, 4, 1, 10, 0, 0, 0, time.UTC),
+			PolicyType: v1.PolicyBurnAfterRead,
+		},
+		empty: func() events.Event { return &v1.PasteCreated{} },
+	},
+	{
+		event: &v1.PasteViewed{
+			URL:      "aB3dE5gH",
+			ViewedAt: time.Date(2025, 4, 1, 10, 5, 0, 0, time.UTC),
+		},
+		empty: func() events.Event { return &v1.PasteViewed{} },
+	},
+	{
+		event: &v1.BurnAfterReadPasteViewed{URL: "aB3dE5gH"},
+		empty: func() events.Event { return &v1.BurnAfterReadPasteViewed{} },
+	},
+}
+
+type fixture struct {
+	// file names the fixture when a routing key has several, as
+	// <routing key>.<variant>; it defaults to the routing key
+	file  string
+	event events.Event
+	empty func() events.Event
+}
+
+func (f fixture) name() string {
+	if f.file != "" {
+		return f.file
+	}
+	return f.event.RoutingKey()
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "v1", name+".json"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return bytes.TrimSpace(b)
+}
+
+func TestProducersMatchFixtures(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name(), func(t *testing.T) {
+			got, err := events.Encode(f.event)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if want := readFixture(t, f.name()); !bytes.Equal(got, want) {
+				t.Errorf("wire format changed\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+func TestConsumersDecodeFixtures(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name(), func(t *testing.T) {
+			body := readFixture(t, f.name())
+
+			// Every field in the fixture must be known to the consumer type.
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(f.empty()); err != nil {
+				t.Fatalf("consumer type does not accept fixture: %v", err)
+			}
+
+			msg, err := events.NewPublishing("/test", f.event)
+			if err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+			msg.Body = body
+			got := f.empty()
+			if _, err := (events.Decoder{}).Decode(delivery(msg), got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !equalJSON(t, got, f.event) {
+				t.Errorf("decoded %+v, want %+v", got, f.event)
+			}
+		})
+	}
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	enc := events.Encoder{Source: "/test", ContentType: events.ContentTypeProtobuf}
+	for _, f := range fixtures {
+		t.Run(f.name(), func(t *testing.T) {
+			msg, err := enc.Encode(f.event)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if msg.ContentType != events.ContentTypeProtobuf {
+				t.Fatalf("content type = %q", msg.ContentType)
+			}
+
+			got := f.empty()
+			if _, err := (events.Decoder{}).Decode(delivery(msg), got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !equalJSON(t, got, f.event) {
+				t.Errorf("decoded %+v, want %+v", got, f.event)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsUnknownContentType(t *testing.T) {
+	msg, err := events.NewPublishing("/test", v1.PasteViewed{URL: "aB3dE5gH"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.ContentType = "application/xml"
+
+	var e v1.PasteViewed
+	if _, err := (events.Decoder{}).Decode(delivery(msg), &e); !errors.Is(err, events.ErrUnsupportedContentType) {
+		t.Fatalf("err = %v, want ErrUnsupportedContentType", err)
+	}
+}
+
+func TestDecodeBareJSONInCompatibilityMode(t *testing.T) {
+	d := amqp.Delivery{Body: readFixture(t, events.RoutingKeyPasteViewed)}
+
+	var e v1.PasteViewed
+	if _, err := (events.Decoder{AcceptBareJSON: true}).Decode(d, &e); err != nil {
+		t.Fatalf("bare message should decode as v1: %v", err)
+	}
+	if _, err := (events.Decoder{}).Decode(d, &e); !errors.Is(err, events.ErrNotCloudEvent) {
+		t.Fatalf("err = %v, want ErrNotCloudEvent", err)
+	}
+}
+
+func TestDecodeVersions(t *testing.T) {
+	for _, tc := range []struct {
+		version string
+		ok      bool
+	}{
+		{"1", true},
+		{"1.3", true},
+		{"2", false},
+	} {
+		t.Run(tc.version, func(t *testing.T) {
+			env := events.NewEnvelope("/test", events.RoutingKeyPasteViewed, tc.version)
+			d := delivery(env.Publishing(readFixture(t, events.RoutingKeyPasteViewed)))
+
+			var e v1.PasteViewed
+			_, err := (events.Decoder{}).Decode(d, &e)
+			if tc.ok && err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, events.ErrUnsupportedVersion) {
+				t.Fatalf("err = %v, want ErrUnsupportedVersion", err)
+			}
+		})
+	}
+}
+
+func TestNewPublishing(t *testing.T) {
+	e := v1.BurnAfterReadPasteViewed{URL: "aB3dE5gH"}
+	msg, err := events.NewPublishing("/retrieval-service", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != events.RoutingKeyBurnAfterReadPasteViewed {
+		t.Errorf("type = %q", msg.Type)
+	}
+	if msg.MessageId == "" || msg.MessageId != msg.Headers[events.HeaderID] {
+		t.Errorf("message id = %q, ce id = %v", msg.MessageId, msg.Headers[events.HeaderID])
+	}
+	if got := msg.Headers[events.HeaderDataSchema]; got != "urn:pastebin-ms:events:v1:paste.burn_after_read_paste_viewed" {
+		t.Errorf("dataschema = %v", got)
+	}
+	if msg.ContentType != events.ContentTypeJSON {
+		t.Errorf("content type = %q", msg.ContentType)
+	}
+}
+
+// delivery turns a publishing into what a consumer would receive.
+func delivery(msg amqp.Publishing) amqp.Delivery {
+	return amqp.Delivery{
+		Headers:     msg.Headers,
+		ContentType: msg.ContentType,
+		MessageId:   msg.MessageId,
+		Type:        msg.Type,
+		AppId:       msg.AppId,
+		Timestamp:   msg.Timestamp,
+		Body:        msg.Body,
+	}
+}
+
+func equalJSON(t *testing.T, a, b interface{}) bool {
+	t.Helper()
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(ja, jb)
+}
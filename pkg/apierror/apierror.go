@@ -0,0 +1,38 @@
+// Package apierror writes the error body shared by every service:
+//
+//	{"code": 404, "reason": "paste_not_found", "message": "Paste not found", "details": ["..."]}
+//
+// Clients tell errors apart by reason; message is for people and may change.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Reasons sent with errors that clients need to tell apart from others with
+// the same status code.
+const (
+	ReasonPasteNotFound = "paste_not_found"
+	ReasonPasteExpired  = "paste_expired"
+)
+
+// Body is the JSON error response.
+type Body struct {
+	Code    int      `json:"code"`
+	Reason  string   `json:"reason,omitempty"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Write sends an error response with the given status code.
+func Write(w http.ResponseWriter, code int, message string, details ...string) {
+	WriteReason(w, code, "", message, details...)
+}
+
+// WriteReason sends an error response carrying a machine-readable reason.
+func WriteReason(w http.ResponseWriter, code int, reason, message string, details ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(Body{Code: code, Reason: reason, Message: message, Details: details})
+}
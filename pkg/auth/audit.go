@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewAuditLogger returns the logger admin actions are recorded with. Its
+// entries go to the service log under the "audit" logger name and, when
+// path is set, are also appended to that file as JSON lines regardless of
+// the service's log level. The returned function closes the file.
+func NewAuditLogger(logger *zap.Logger, path string) (*zap.Logger, func() error, error) {
+	audit := logger.Named("audit")
+	if path == "" {
+		return audit, func() error { return nil }, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	enc := zap.NewProductionEncoderConfig()
+	enc.TimeKey = "time"
+	enc.EncodeTime = zapcore.ISO8601TimeEncoder
+	file := zapcore.NewCore(zapcore.NewJSONEncoder(enc), zapcore.Lock(f), zapcore.DebugLevel)
+
+	audit = audit.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, file)
+	}))
+	return audit, f.Close, nil
+}
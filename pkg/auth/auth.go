@@ -0,0 +1,320 @@
+// Package auth protects the admin APIs of the services. Callers present
+// either a static bearer token or an HMAC signature of the request, both
+// configured with a role: viewers may only read, operators may also change
+// state, such as running cleanups, deleting pastes, replaying dead letters
+// and changing settings.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Role is what a credential is allowed to do. Every role can do what the
+// roles before it can.
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleOperator
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	}
+	return "unknown"
+}
+
+// ParseRole reads a role name as written in the configuration.
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	}
+	return 0, fmt.Errorf("unknown role %q, want viewer or operator", s)
+}
+
+// RequiredRole is the role a request needs: reads are open to viewers and
+// anything that changes state needs an operator.
+func RequiredRole(r *http.Request) Role {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return RoleViewer
+	}
+	return RoleOperator
+}
+
+// Principal is the caller a request was authenticated as.
+type Principal struct {
+	Name string
+	Role Role
+	// Scheme is "bearer" or "hmac"
+	Scheme string
+}
+
+// Credential is one configured token or HMAC key.
+type Credential struct {
+	Name   string
+	Role   Role
+	Secret string
+}
+
+// ParseCredentials reads a comma-separated list of name:role:secret
+// entries, as in ADMIN_TOKENS and ADMIN_HMAC_KEYS. An empty list is valid.
+func ParseCredentials(list string) ([]Credential, error) {
+	var creds []Credential
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(entry, ":")
+		roleName, secret, ok2 := strings.Cut(rest, ":")
+		if !ok || !ok2 || name == "" || secret == "" {
+			return nil, fmt.Errorf("entry %d: want name:role:secret", len(creds)+1)
+		}
+		role, err := ParseRole(roleName)
+		if err != nil {
+			// The role is not echoed: with the fields out of order it may
+			// be the secret
+			return nil, fmt.Errorf("%s: role must be viewer or operator", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s: duplicate name", name)
+		}
+		seen[name] = true
+		creds = append(creds, Credential{Name: name, Role: role, Secret: secret})
+	}
+	return creds, nil
+}
+
+// Errors returned by Authenticate. ErrMissing and ErrInvalid answer 401.
+var (
+	ErrMissing = errors.New("missing credentials")
+	ErrInvalid = errors.New("invalid credentials")
+)
+
+// HMACScheme is the Authorization scheme of signed requests:
+//
+//	Authorization: HMAC-SHA256 Credential=<name>, Timestamp=<unix seconds>, Signature=<hex>
+//
+// The signature is the HMAC-SHA256 of StringToSign under the key's secret.
+const HMACScheme = "HMAC-SHA256"
+
+// maxSignedBody is the largest body read to check a signature. Admin
+// requests carry small JSON documents.
+const maxSignedBody = 1 << 20
+
+// Authenticator checks the credentials of admin requests. Its credentials
+// can be replaced while it is serving.
+type Authenticator struct {
+	creds   atomic.Pointer[credentials]
+	maxSkew time.Duration
+	now     func() time.Time
+
+	// used holds the signatures of accepted state-changing requests until
+	// their timestamp leaves the skew window
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+type credentials struct {
+	tokens []Credential
+	keys   map[string]Credential
+}
+
+// NewAuthenticator returns an authenticator accepting tokens as bearer
+// tokens and keys as HMAC keys. Signed requests older or newer than maxSkew
+// are rejected so a captured request cannot be replayed later, and a signed
+// request that changes state is accepted only once. Used signatures are
+// remembered in memory, so behind several replicas a captured request can
+// still be replayed against another instance within maxSkew.
+func NewAuthenticator(tokens, keys []Credential, maxSkew time.Duration) *Authenticator {
+	a := &Authenticator{maxSkew: maxSkew, now: time.Now, used: map[string]time.Time{}}
+	a.SetCredentials(tokens, keys)
+	return a
+}
+
+// SetCredentials replaces the accepted tokens and HMAC keys.
+func (a *Authenticator) SetCredentials(tokens, keys []Credential) {
+	c := &credentials{tokens: tokens, keys: make(map[string]Credential, len(keys))}
+	for _, k := range keys {
+		c.keys[k.Name] = k
+	}
+	a.creds.Store(c)
+}
+
+// Empty reports whether no credential is configured, in which case every
+// request is rejected.
+func (a *Authenticator) Empty() bool {
+	c := a.creds.Load()
+	return len(c.tokens) == 0 && len(c.keys) == 0
+}
+
+// Authenticate identifies the caller of r. Reading the body to check a
+// signature leaves it in place for the handler.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	header := r.Header.Get("Authorization")
+	scheme, params, _ := strings.Cut(header, " ")
+	switch {
+	case header == "":
+		return Principal{}, ErrMissing
+	case strings.EqualFold(scheme, "Bearer"):
+		return a.bearer(strings.TrimSpace(params))
+	case scheme == HMACScheme:
+		return a.signed(r, params)
+	}
+	return Principal{}, ErrInvalid
+}
+
+func (a *Authenticator) bearer(token string) (Principal, error) {
+	// Every token is compared so the time taken does not reveal which one
+	// a guess came close to
+	var match *Credential
+	tokens := a.creds.Load().tokens
+	for i := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(tokens[i].Secret)) == 1 {
+			match = &tokens[i]
+		}
+	}
+	if match == nil {
+		return Principal{}, ErrInvalid
+	}
+	return Principal{Name: match.Name, Role: match.Role, Scheme: "bearer"}, nil
+}
+
+func (a *Authenticator) signed(r *http.Request, params string) (Principal, error) {
+	fields := map[string]string{}
+	for _, p := range strings.Split(params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		fields[k] = v
+	}
+	key, ok := a.creds.Load().keys[fields["Credential"]]
+	if !ok {
+		return Principal{}, ErrInvalid
+	}
+	ts, err := strconv.ParseInt(fields["Timestamp"], 10, 64)
+	if err != nil {
+		return Principal{}, ErrInvalid
+	}
+	if skew := a.now().Sub(time.Unix(ts, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return Principal{}, fmt.Errorf("%w: timestamp outside the allowed %s", ErrInvalid, a.maxSkew)
+	}
+	sig, err := hex.DecodeString(fields["Signature"])
+	if err != nil {
+		return Principal{}, ErrInvalid
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(nil, r.Body, maxSignedBody)
+	}
+	body, err := readBody(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Principal{}, fmt.Errorf("%w: body larger than %d bytes", ErrInvalid, maxSignedBody)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	if !hmac.Equal(sig, sign(key.Secret, StringToSign(r.Method, r.URL.RequestURI(), ts, body))) {
+		return Principal{}, ErrInvalid
+	}
+	// Reads may repeat, e.g. when polling within the same second
+	if RequiredRole(r) > RoleViewer && !a.claim(hex.EncodeToString(sig), time.Unix(ts, 0).Add(a.maxSkew)) {
+		return Principal{}, fmt.Errorf("%w: signature already used", ErrInvalid)
+	}
+	return Principal{Name: key.Name, Role: key.Role, Scheme: "hmac"}, nil
+}
+
+// claim records sig as used until expires. It reports false if sig was
+// already used.
+func (a *Authenticator) claim(sig string, expires time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	for s, exp := range a.used {
+		if !exp.After(now) {
+			delete(a.used, s)
+		}
+	}
+	if _, ok := a.used[sig]; ok {
+		return false
+	}
+	a.used[sig] = expires
+	return true
+}
+
+// StringToSign is what an HMAC signature covers: the method, the path with
+// its query, the timestamp and the SHA-256 of the body, one per line.
+func StringToSign(method, requestURI string, timestamp int64, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{method, requestURI, strconv.FormatInt(timestamp, 10), hex.EncodeToString(sum[:])}, "\n")
+}
+
+// Sign adds an HMAC Authorization header to r for the key name and secret,
+// as clients such as pastebinctl do.
+func Sign(r *http.Request, name, secret string, now time.Time) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	ts := now.Unix()
+	sig := sign(secret, StringToSign(r.Method, r.URL.RequestURI(), ts, body))
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, Timestamp=%d, Signature=%s",
+		HMACScheme, name, ts, hex.EncodeToString(sig)))
+	return nil
+}
+
+func sign(secret, s string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// readBody returns the body of r and puts an unread copy back.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of an authenticated request.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	tokens, err := ParseCredentials("grafana:viewer:read-token, ops:operator:write-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseCredentials("ci:operator:hmac-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthenticator(tokens, keys, time.Minute)
+}
+
+func TestMiddleware(t *testing.T) {
+	a := newTestAuthenticator(t)
+	core, logs := observer.New(zap.InfoLevel)
+	var body string
+	handler := a.Middleware("test", zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	signed := func(method, target, payload, secret string, at time.Time) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(payload))
+		if err := Sign(req, "ci", secret, at); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	bearer := func(method, token string) *http.Request {
+		req := httptest.NewRequest(method, "/api/cleanup/run", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req
+	}
+
+	at := time.Now()
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"no credentials", bearer(http.MethodGet, ""), http.StatusUnauthorized},
+		{"unknown token", bearer(http.MethodGet, "guess"), http.StatusUnauthorized},
+		{"viewer reads", bearer(http.MethodGet, "read-token"), http.StatusNoContent},
+		{"viewer writes", bearer(http.MethodPost, "read-token"), http.StatusForbidden},
+		{"operator writes", bearer(http.MethodPost, "write-token"), http.StatusNoContent},
+		{"signed read", signed(http.MethodGet, "/admin/reconcile", ``, "hmac-secret", at), http.StatusNoContent},
+		{"repeated signed read", signed(http.MethodGet, "/admin/reconcile", ``, "hmac-secret", at), http.StatusNoContent},
+		{"signed", signed(http.MethodPost, "/admin/reconcile?x=1", `{"page_size":10}`, "hmac-secret", at), http.StatusNoContent},
+		{"replayed", signed(http.MethodPost, "/admin/reconcile?x=1", `{"page_size":10}`, "hmac-secret", at), http.StatusUnauthorized},
+		{"oversized body", signed(http.MethodPost, "/admin/reconcile", strings.Repeat(" ", maxSignedBody+1), "hmac-secret", at), http.StatusUnauthorized},
+		{"wrong secret", signed(http.MethodPost, "/admin/reconcile", `{}`, "other", time.Now()), http.StatusUnauthorized},
+		{"stale signature", signed(http.MethodPost, "/admin/reconcile", `{}`, "hmac-secret", time.Now().Add(-time.Hour)), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if body != `{"page_size":10}` {
+		t.Errorf("handler read body %q after signature check", body)
+	}
+	if n := logs.Len(); n != len(tests) {
+		t.Errorf("audit log has %d entries, want one per request (%d)", n, len(tests))
+	}
+	forbidden := logs.FilterMessage("Admin request forbidden").All()
+	if len(forbidden) != 1 || forbidden[0].ContextMap()["principal"] != "grafana" {
+		t.Errorf("forbidden entries = %v", forbidden)
+	}
+}
+
+func TestParseCredentialsRejectsBadEntries(t *testing.T) {
+	for _, list := range []string{"a:viewer", "a:admin:s3cr3t", "a:s3cr3t:viewer", "a:viewer:s3cr3t,a:operator:s3cr3t", ":viewer:s3cr3t"} {
+		if _, err := ParseCredentials(list); err == nil {
+			t.Errorf("ParseCredentials(%q) succeeded", list)
+		} else if strings.Contains(err.Error(), "s3cr3t") {
+			t.Errorf("error %q reveals the secret", err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// Middleware authenticates every request, checks its role against
+// RequiredRole and records the outcome in the audit log, including
+// rejected attempts. realm names the service in WWW-Authenticate.
+func (a *Authenticator) Middleware(realm string, audit *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			entry := audit.With(
+				logging.RequestID(requestid.FromContext(r.Context())),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.RequestURI()),
+				zap.String("remote", r.RemoteAddr),
+			)
+
+			principal, err := a.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+				apierror.Write(w, http.StatusUnauthorized, "Authentication required")
+				entry.Warn("Admin request rejected", zap.Int("status", http.StatusUnauthorized),
+					zap.Bool("credentialsPresent", !errors.Is(err, ErrMissing)), zap.Error(err))
+				return
+			}
+			entry = entry.With(zap.String("principal", principal.Name),
+				zap.Stringer("role", principal.Role), zap.String("scheme", principal.Scheme))
+
+			if required := RequiredRole(r); principal.Role < required {
+				apierror.Write(w, http.StatusForbidden, "Forbidden",
+					"this action needs the "+required.String()+" role")
+				entry.Warn("Admin request forbidden", zap.Int("status", http.StatusForbidden))
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(WithPrincipal(r.Context(), principal)))
+			entry.Info("Admin request", zap.Int("status", ww.Status()),
+				zap.Duration("duration", time.Since(start)))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Package dedup records which messages a consumer has already processed so
+// that at-least-once redeliveries can be skipped.
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultCollection is the collection processed message IDs are kept in.
+const DefaultCollection = "processed_messages"
+
+// DefaultTTL is how long a processed ID is remembered. It must comfortably
+// exceed the longest retry delay and any redelivery window.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// Store keeps processed message IDs of one consumer in a Mongo collection
+// whose TTL index expires them after a while.
+type Store struct {
+	collection *mongo.Collection
+	consumer   string
+}
+
+// NewStore creates a Store for consumer in db, creating or updating the TTL
+// index on the collection.
+func NewStore(ctx context.Context, db *mongo.Database, consumer string, ttl time.Duration) (*Store, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	s := &Store{collection: db.Collection(DefaultCollection), consumer: consumer}
+	if err := s.ensureTTLIndex(ctx, ttl); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) ensureTTLIndex(ctx context.Context, ttl time.Duration) error {
+	seconds := int32(ttl.Seconds())
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "processed_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(seconds),
+	})
+	if err == nil {
+		return nil
+	}
+
+	// The index exists with another TTL; change it in place.
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == 85 || cmdErr.Code == 86) {
+		err = s.collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: s.collection.Name()},
+			{Key: "index", Value: bson.D{
+				{Key: "keyPattern", Value: bson.D{{Key: "processed_at", Value: 1}}},
+				{Key: "expireAfterSeconds", Value: seconds},
+			}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create TTL index on %s: %w", s.collection.Name(), err)
+	}
+	return nil
+}
+
+func (s *Store) key(id string) string {
+	return s.consumer + ":" + id
+}
+
+// Seen reports whether id has already been processed by this consumer.
+func (s *Store) Seen(ctx context.Context, id string) (bool, error) {
+	err := s.collection.FindOne(ctx, bson.M{"_id": s.key(id)}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up message %s: %w", id, err)
+	}
+	return true, nil
+}
+
+// MarkProcessed records id as processed. Call it only after the message's
+// effects are durable; a crash in between leads to one more delivery, which
+// handlers must tolerate.
+func (s *Store) MarkProcessed(ctx context.Context, id string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": s.key(id)},
+		bson.M{"$set": bson.M{
+			"consumer":     s.consumer,
+			"message_id":   id,
+			"processed_at": time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark message %s as processed: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrUnknownQueue is returned for queues not registered with the Admin.
+	ErrUnknownQueue = errors.New("dlq: unknown queue")
+	// ErrMessageNotFound is returned when no dead letter has the given ID.
+	ErrMessageNotFound = errors.New("dlq: message not found")
+	// ErrScanLimit is returned when dead letters were looked up by ID and
+	// some were not among the first DefaultScanLimit messages of the queue.
+	// They may still be further back.
+	ErrScanLimit = errors.New("dlq: scan limit reached")
+)
+
+// DefaultScanLimit caps how many dead letters a single operation walks.
+const DefaultScanLimit = 1000
+
+// Message describes a dead-lettered message.
+type Message struct {
+	ID             string     `json:"id"`
+	Queue          string     `json:"queue"`
+	RoutingKey     string     `json:"routing_key"`
+	MessageID      string     `json:"message_id,omitempty"`
+	Attempts       int        `json:"attempts"`
+	Error          string     `json:"error,omitempty"`
+	DeadLetteredAt time.Time  `json:"dead_lettered_at"`
+	ContentType    string     `json:"content_type,omitempty"`
+	Size           int        `json:"size"`
+	Headers        amqp.Table `json:"headers,omitempty"`
+	Body           string     `json:"body,omitempty"`
+}
+
+// QueueStats summarises one dead-letter queue.
+type QueueStats struct {
+	Queue           string `json:"queue"`
+	DeadLetterQueue string `json:"dead_letter_queue"`
+	Messages        int    `json:"messages"`
+}
+
+// Admin lists, inspects, replays and purges dead-lettered messages of a
+// fixed set of work queues.
+type Admin struct {
+	conn      *rabbitmq.Connection
+	queues    []string
+	publisher *rabbitmq.Publisher
+}
+
+// NewAdmin creates an Admin for the given work queues.
+func NewAdmin(conn *rabbitmq.Connection, queues ...string) (*Admin, error) {
+	publisher, err := rabbitmq.NewPublisher(conn, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{conn: conn, queues: queues, publisher: publisher}, nil
+}
+
+func (a *Admin) known(queue string) bool {
+	for _, q := range a.queues {
+		if q == queue {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns the number of dead letters per registered queue.
+func (a *Admin) Stats(context.Context) ([]QueueStats, error) {
+	stats := make([]QueueStats, 0, len(a.queues))
+	for _, queue := range a.queues {
+		ch, err := a.conn.Channel()
+		if err != nil {
+			return nil, err
+		}
+		q, err := ch.QueueDeclarePassive(rabbitmq.DeadLetterQueueName(queue), true, false, false, false, nil)
+		_ = ch.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %w", rabbitmq.DeadLetterQueueName(queue), err)
+		}
+		stats = append(stats, QueueStats{
+			Queue:           queue,
+			DeadLetterQueue: q.Name,
+			Messages:        q.Messages,
+		})
+	}
+	return stats, nil
+}
+
+// List returns up to limit dead letters of queue without removing them.
+func (a *Admin) List(ctx context.Context, queue string, limit int) ([]Message, error) {
+	var out []Message
+	err := a.scan(ctx, queue, limit, func(d amqp.Delivery) (bool, bool, error) {
+		m := toMessage(queue, d)
+		m.Headers = nil
+		m.Body = ""
+		out = append(out, m)
+		return false, false, nil
+	})
+	if errors.Is(err, ErrScanLimit) {
+		err = nil
+	}
+	return out, err
+}
+
+// Get returns the dead letter with the given ID, including headers and body.
+// It returns ErrScanLimit if the ID is not among the first DefaultScanLimit
+// dead letters of a longer queue.
+func (a *Admin) Get(ctx context.Context, queue, id string) (*Message, error) {
+	var found *Message
+	err := a.scan(ctx, queue, DefaultScanLimit, func(d amqp.Delivery) (bool, bool, error) {
+		if deadLetterID(d) != id {
+			return false, false, nil
+		}
+		m := toMessage(queue, d)
+		found = &m
+		return false, true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrMessageNotFound
+	}
+	return found, nil
+}
+
+// Replay sends dead letters back to their work queue with a fresh retry
+// budget. With no ids every dead letter is replayed, up to DefaultScanLimit
+// per call. It returns how many messages were moved, and ErrScanLimit if
+// some of ids were not found within the scan limit.
+func (a *Admin) Replay(ctx context.Context, queue string, ids []string) (int, error) {
+	want := toSet(ids)
+	count := 0
+	err := a.scan(ctx, queue, DefaultScanLimit, func(d amqp.Delivery) (bool, bool, error) {
+		if want != nil && !want[deadLetterID(d)] {
+			return false, false, nil
+		}
+
+		msg := rabbitmq.Republish(d)
+		delete(msg.Headers, rabbitmq.HeaderRetryCount)
+		delete(msg.Headers, rabbitmq.HeaderLastError)
+		delete(msg.Headers, rabbitmq.HeaderDeadLetterID)
+		delete(msg.Headers, rabbitmq.HeaderDeadLetteredAt)
+		if err := a.publisher.Publish(ctx, queue, msg); err != nil {
+			return false, true, err
+		}
+		count++
+		return true, want != nil && count == len(want), nil
+	})
+	if want == nil && errors.Is(err, ErrScanLimit) {
+		err = nil
+	}
+	return count, err
+}
+
+// Purge deletes dead letters. With no ids the whole dead-letter queue is
+// purged. It returns how many messages were removed, and ErrScanLimit if
+// some of ids were not found within the scan limit.
+func (a *Admin) Purge(ctx context.Context, queue string, ids []string) (int, error) {
+	if !a.known(queue) {
+		return 0, ErrUnknownQueue
+	}
+
+	if len(ids) == 0 {
+		ch, err := a.conn.Channel()
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close()
+		return ch.QueuePurge(rabbitmq.DeadLetterQueueName(queue), false)
+	}
+
+	want := toSet(ids)
+	count := 0
+	err := a.scan(ctx, queue, DefaultScanLimit, func(d amqp.Delivery) (bool, bool, error) {
+		if !want[deadLetterID(d)] {
+			return false, false, nil
+		}
+		count++
+		return true, count == len(want), nil
+	})
+	return count, err
+}
+
+// scan walks the dead-letter queue with basic.get. Messages for which fn
+// returns ack=true are removed; all others are requeued in their original
+// order when the channel closes. Only the messages queued when the scan
+// starts are visited, so a replayed message that is dead-lettered again
+// meanwhile is not picked up a second time. It returns ErrScanLimit if the
+// limit ran out before the end of the queue and fn never asked to stop.
+func (a *Admin) scan(ctx context.Context, queue string, limit int,
+	fn func(d amqp.Delivery) (ack bool, stop bool, err error)) error {
+	if !a.known(queue) {
+		return ErrUnknownQueue
+	}
+	if limit <= 0 || limit > DefaultScanLimit {
+		limit = DefaultScanLimit
+	}
+
+	ch, err := a.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(rabbitmq.DeadLetterQueueName(queue), true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", rabbitmq.DeadLetterQueueName(queue), err)
+	}
+	truncated := q.Messages > limit
+	limit = min(limit, q.Messages)
+
+	for i := 0; i < limit; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		d, ok, err := ch.Get(rabbitmq.DeadLetterQueueName(queue), false)
+		if err != nil {
+			return fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		ack, stop, err := fn(d)
+		if err != nil {
+			return err
+		}
+		if ack {
+			if err := d.Ack(false); err != nil {
+				return err
+			}
+		}
+		if stop {
+			return nil
+		}
+	}
+	if truncated {
+		return ErrScanLimit
+	}
+	return nil
+}
+
+// Close releases the replay publisher.
+func (a *Admin) Close() error {
+	return a.publisher.Close()
+}
+
+func toMessage(queue string, d amqp.Delivery) Message {
+	m := Message{
+		ID:          deadLetterID(d),
+		Queue:       queue,
+		RoutingKey:  rabbitmq.RoutingKey(d),
+		MessageID:   d.MessageId,
+		Attempts:    rabbitmq.Attempts(d),
+		ContentType: d.ContentType,
+		Size:        len(d.Body),
+		Headers:     d.Headers,
+		Body:        string(d.Body),
+	}
+	if s, ok := d.Headers[rabbitmq.HeaderLastError].(string); ok {
+		m.Error = s
+	}
+	if s, ok := d.Headers[rabbitmq.HeaderDeadLetteredAt].(string); ok {
+		m.DeadLetteredAt, _ = time.Parse(time.RFC3339Nano, s)
+	}
+	return m
+}
+
+func deadLetterID(d amqp.Delivery) string {
+	if id, ok := d.Headers[rabbitmq.HeaderDeadLetterID].(string); ok {
+		return id
+	}
+	return d.MessageId
+}
+
+func toSet(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,126 @@
+package dlq
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/go-chi/chi/v5"
+)
+
+type idsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// NewRouter exposes the Admin over HTTP:
+//
+//	GET    /                        dead-letter counts per queue
+//	GET    /{queue}/messages        list dead letters (?limit=)
+//	GET    /{queue}/messages/{id}   inspect one dead letter
+//	POST   /{queue}/replay          replay {"ids": [...]} or everything
+//	DELETE /{queue}/messages        purge {"ids": [...]} or everything
+//	DELETE /{queue}/messages/{id}   purge one dead letter
+func NewRouter(admin *Admin) http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := admin.Stats(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+	})
+
+	r.Get("/{queue}/messages", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit <= 0 {
+			limit = 50
+		}
+		msgs, err := admin.List(r.Context(), chi.URLParam(r, "queue"), limit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if msgs == nil {
+			msgs = []Message{}
+		}
+		writeJSON(w, http.StatusOK, msgs)
+	})
+
+	r.Get("/{queue}/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		msg, err := admin.Get(r.Context(), chi.URLParam(r, "queue"), chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, msg)
+	})
+
+	r.Post("/{queue}/replay", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeIDs(w, r)
+		if !ok {
+			return
+		}
+		n, err := admin.Replay(r.Context(), chi.URLParam(r, "queue"), req.IDs)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"replayed": n})
+	})
+
+	purge := func(w http.ResponseWriter, r *http.Request) {
+		var ids []string
+		if id := chi.URLParam(r, "id"); id != "" {
+			ids = []string{id}
+		} else {
+			req, ok := decodeIDs(w, r)
+			if !ok {
+				return
+			}
+			ids = req.IDs
+		}
+		n, err := admin.Purge(r.Context(), chi.URLParam(r, "queue"), ids)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"purged": n})
+	}
+	r.Delete("/{queue}/messages", purge)
+	r.Delete("/{queue}/messages/{id}", purge)
+
+	return r
+}
+
+// decodeIDs reads an optional {"ids": [...]} body.
+func decodeIDs(w http.ResponseWriter, r *http.Request) (idsRequest, bool) {
+	var req idsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+		return req, false
+	}
+	return req, true
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownQueue), errors.Is(err, ErrMessageNotFound):
+		apierror.Write(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrScanLimit):
+		apierror.Write(w, http.StatusUnprocessableEntity, err.Error(),
+			"only the first "+strconv.Itoa(DefaultScanLimit)+" dead letters are searched by id")
+	default:
+		apierror.Write(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
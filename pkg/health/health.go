@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+const checkTimeout = 2 * time.Second
+
+// Mongo checks that the primary of client answers a ping.
+func Mongo(client *mongo.Client) Check {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	}
+}
+
+// LiveHandler answers 200 while the process is able to serve HTTP at all.
+// It checks no dependency: an outage of MySQL or RabbitMQ should take the
+// instance out of rotation through readiness, not get it restarted.
+func LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+}
+
+// Probe answers readiness from a set of checks until the service starts
+// shutting down, after which it reports draining regardless of the checks.
+type Probe struct {
+	names    []string
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+// NewProbe returns a probe running checks, keyed by dependency name.
+func NewProbe(checks map[string]Check) *Probe {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &Probe{names: names, checks: checks}
+}
+
+// Drain makes readiness fail from now on so load balancers stop sending
+// new requests while in-flight work finishes.
+func (p *Probe) Drain() {
+	p.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called.
+func (p *Probe) Draining() bool {
+	return p.draining.Load()
+}
+
+// ReadyHandler runs every check and answers 200 when all pass and 503
+// otherwise, with the per-dependency result in the body. Once the probe
+// is draining it answers 503 without running the checks.
+func (p *Probe) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.Draining() {
+			writeStatus(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "draining"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		status := http.StatusOK
+		results := make(map[string]string, len(p.checks))
+		for _, name := range p.names {
+			if err := p.checks[name](ctx); err != nil {
+				status = http.StatusServiceUnavailable
+				results[name] = err.Error()
+				continue
+			}
+			results[name] = "ok"
+		}
+
+		body := map[string]interface{}{"status": "ok", "checks": results}
+		if status != http.StatusOK {
+			body["status"] = "unavailable"
+		}
+		writeStatus(w, status, body)
+	}
+}
+
+// ReadyHandler is NewProbe(checks).ReadyHandler() for services that never
+// drain.
+func ReadyHandler(checks map[string]Check) http.HandlerFunc {
+	return NewProbe(checks).ReadyHandler()
+}
+
+func writeStatus(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
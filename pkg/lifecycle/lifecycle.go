@@ -0,0 +1,88 @@
+// Package lifecycle runs the shutdown sequence shared by every service:
+// fail readiness, stop consumers and let in-flight messages drain, stop
+// serving HTTP, then close connections, all within one deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"go.uber.org/zap"
+)
+
+// Step is one stage of shutdown. Stop should return once the stage is done
+// or ctx expires, whichever comes first.
+type Step struct {
+	Name string
+	Stop func(ctx context.Context) error
+}
+
+// WaitForSignal blocks until the process receives SIGINT or SIGTERM.
+func WaitForSignal() os.Signal {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	return <-sig
+}
+
+// Drain returns the step that fails readiness and then waits delay, giving
+// load balancers time to notice before anything stops accepting work.
+func Drain(probe *health.Probe, delay time.Duration) Step {
+	return Step{Name: "readiness", Stop: func(ctx context.Context) error {
+		probe.Drain()
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+}
+
+// Close adapts a Close or Stop method that takes no context. The step is
+// abandoned, not interrupted, if it outlives the deadline.
+func Close(name string, fn func() error) Step {
+	return Step{Name: name, Stop: func(context.Context) error { return fn() }}
+}
+
+// Shutdown runs steps in order under the deadline of ctx. A step still
+// running when the deadline passes is abandoned and the remaining steps are
+// skipped; the process is about to exit and the OS reclaims what they would
+// have closed. Every failure is logged and returned together.
+func Shutdown(ctx context.Context, logger *zap.Logger, steps ...Step) error {
+	var errs []error
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			logger.Warn("Skipping shutdown step", zap.String("step", step.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: skipped: %w", step.Name, err))
+			continue
+		}
+		start := time.Now()
+		done := make(chan error, 1)
+		go func() { done <- step.Stop(ctx) }()
+
+		var err error
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			logger.Error("Shutdown step failed", zap.String("step", step.Name),
+				zap.Duration("elapsed", time.Since(start)), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", step.Name, err))
+			continue
+		}
+		logger.Info("Shutdown step finished", zap.String("step", step.Name),
+			zap.Duration("elapsed", time.Since(start)))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"go.uber.org/zap"
+)
+
+func TestShutdownStopsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var (
+		mu  sync.Mutex
+		ran []string
+	)
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, name)
+	}
+	first := Close("first", func() error { record("first"); return nil })
+	stuck := Step{Name: "stuck", Stop: func(context.Context) error {
+		record("stuck")
+		select {}
+	}}
+	late := Close("late", func() error { record("late"); return nil })
+
+	err := Shutdown(ctx, zap.NewNop(), first, stuck, late)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(ran, ","); got != "first,stuck" {
+		t.Errorf("ran %s", got)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stuck:") ||
+		!strings.Contains(err.Error(), "late:") {
+		t.Errorf("err = %v, want the stuck step to time out and the late one skipped", err)
+	}
+}
+
+func TestDrainFailsReadiness(t *testing.T) {
+	probe := health.NewProbe(map[string]health.Check{
+		"db": func(context.Context) error { return nil },
+	})
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		probe.ReadyHandler()(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("ready before drain = %d", code)
+	}
+
+	if err := Shutdown(context.Background(), zap.NewNop(), Drain(probe, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("ready after drain = %d, want 503", code)
+	}
+}
@@ -0,0 +1,161 @@
+// Package logging builds the JSON zap logger every service uses, so their
+// logs share one format and one set of field names and can be joined on
+// requestID or url across services.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Field keys shared by all services.
+const (
+	KeyService    = "service"
+	KeyRequestID  = "requestID"
+	KeyURL        = "url"
+	KeyRoutingKey = "routingKey"
+)
+
+// Config describes a service's logger.
+type Config struct {
+	Service string
+	// Level is the initial minimum level: debug, info, warn or error.
+	// It can be changed at runtime through LevelHandler.
+	Level string
+}
+
+// New returns a JSON logger tagged with the service name. The returned
+// AtomicLevel controls the logger and every logger derived from it.
+func New(cfg Config) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, level, err
+		}
+	}
+
+	zcfg := zap.NewProductionConfig()
+	zcfg.Level = level
+	zcfg.EncoderConfig.TimeKey = "time"
+	zcfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	// Sampling is opt-in per logger through Sampled, so that only the hot
+	// paths lose lines under load.
+	zcfg.Sampling = nil
+
+	logger, err := zcfg.Build()
+	if err != nil {
+		return nil, level, err
+	}
+	return logger.With(zap.String(KeyService, cfg.Service)), level, nil
+}
+
+// RequestID is the field carrying the correlation ID of a request.
+func RequestID(id string) zap.Field {
+	return zap.String(KeyRequestID, id)
+}
+
+// URL is the field carrying a paste's short URL.
+func URL(url string) zap.Field {
+	return zap.String(KeyURL, url)
+}
+
+// RoutingKey is the field carrying an event's routing key.
+func RoutingKey(key string) zap.Field {
+	return zap.String(KeyRoutingKey, key)
+}
+
+// FromContext returns logger tagged with the request ID stored in ctx, if any.
+func FromContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := requestid.FromContext(ctx); id != "" {
+		return logger.With(RequestID(id))
+	}
+	return logger
+}
+
+// Sampling limits how many identical Info and Debug lines are written: per
+// Tick, the first First entries with a given message are logged and then
+// every Thereafter-th. Warnings and errors are never sampled.
+type Sampling struct {
+	Tick       time.Duration
+	First      int
+	Thereafter int
+}
+
+// Sampled returns logger with s applied. A zero First disables sampling.
+func Sampled(logger *zap.Logger, s Sampling) *zap.Logger {
+	if s.First <= 0 {
+		return logger
+	}
+	if s.Tick <= 0 {
+		s.Tick = time.Second
+	}
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		sampled := zapcore.NewSamplerWithOptions(core, s.Tick, s.First, s.Thereafter)
+		warnings, err := zapcore.NewIncreaseLevelCore(core, zapcore.WarnLevel)
+		if err != nil {
+			return core
+		}
+		return zapcore.NewTee(belowCore{Core: sampled, below: zapcore.WarnLevel}, warnings)
+	}))
+}
+
+// belowCore passes only entries under a level to the wrapped core.
+type belowCore struct {
+	zapcore.Core
+	below zapcore.Level
+}
+
+func (c belowCore) Enabled(l zapcore.Level) bool {
+	return l < c.below && c.Core.Enabled(l)
+}
+
+func (c belowCore) With(fields []zapcore.Field) zapcore.Core {
+	return belowCore{Core: c.Core.With(fields), below: c.below}
+}
+
+func (c belowCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if e.Level >= c.below {
+		return ce
+	}
+	return c.Core.Check(e, ce)
+}
+
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler reports the current level on GET and changes it on PUT with
+// a body such as {"level": "debug"}.
+func LevelHandler(level zap.AtomicLevel) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body levelBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				apierror.Write(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			var l zapcore.Level
+			if err := l.UnmarshalText([]byte(body.Level)); err != nil {
+				apierror.Write(w, http.StatusBadRequest, "Unknown log level "+body.Level)
+				return
+			}
+			level.SetLevel(l)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			apierror.Write(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(levelBody{Level: level.Level().String()})
+	})
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSampledKeepsWarnings(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := Sampled(zap.New(core), Sampling{Tick: time.Minute, First: 2, Thereafter: 0})
+
+	for i := 0; i < 10; i++ {
+		logger.Info("request")
+		logger.Error("failed")
+	}
+
+	if n := logs.FilterMessage("request").Len(); n != 2 {
+		t.Errorf("logged %d info lines, want 2", n)
+	}
+	if n := logs.FilterMessage("failed").Len(); n != 10 {
+		t.Errorf("logged %d error lines, want 10", n)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	h := LevelHandler(level)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"debug"}`)))
+	if rec.Code != http.StatusOK || level.Level() != zapcore.DebugLevel {
+		t.Fatalf("PUT debug: status %d, level %s", rec.Code, level.Level())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"loud"}`)))
+	if rec.Code != http.StatusBadRequest || level.Level() != zapcore.DebugLevel {
+		t.Fatalf("PUT loud: status %d, level %s", rec.Code, level.Level())
+	}
+}
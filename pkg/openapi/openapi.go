@@ -0,0 +1,206 @@
+// Package openapi holds the OpenAPI 3 description of every service's HTTP
+// API. Each service serves the part of it that it implements and validates
+// incoming requests against it.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Service names used in the x-services extension of each path.
+const (
+	ServiceCreate    = "create"
+	ServiceRetrieval = "retrieval"
+	ServiceAnalytics = "analytics"
+	ServiceCleanup   = "cleanup"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+// Spec returns the raw document describing all services.
+func Spec() []byte {
+	return specYAML
+}
+
+// Load parses and validates the full document.
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(specYAML)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	return doc, nil
+}
+
+// ForService loads the document restricted to the paths served by service.
+func ForService(service string) (*openapi3.T, error) {
+	doc, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	paths := openapi3.NewPaths()
+	for path, item := range doc.Paths.Map() {
+		services, err := Services(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, s := range services {
+			if s == service {
+				paths.Set(path, item)
+				break
+			}
+		}
+	}
+	if paths.Len() == 0 {
+		return nil, fmt.Errorf("no paths for service %q", service)
+	}
+	doc.Paths = paths
+	doc.Info.Title += " " + service
+	return doc, nil
+}
+
+// Services returns the x-services extension of a path.
+func Services(item *openapi3.PathItem) ([]string, error) {
+	raw, ok := item.Extensions["x-services"]
+	if !ok {
+		return nil, errors.New("missing x-services")
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("x-services must be a list, got %T", raw)
+	}
+	services := make([]string, 0, len(list))
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("x-services entries must be strings, got %T", v)
+		}
+		services = append(services, s)
+	}
+	return services, nil
+}
+
+// Handler serves doc as JSON.
+func Handler(doc *openapi3.T) http.HandlerFunc {
+	data, err := json.Marshal(doc)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, "Failed to encode OpenAPI spec")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// NewRouter finds the operation of a request in doc.
+func NewRouter(doc *openapi3.T) (routers.Router, error) {
+	return gorillamux.NewRouter(doc)
+}
+
+// Middleware rejects requests that do not match doc with a 400 and the
+// shared error body. Requests for paths doc does not describe, such as
+// /debug endpoints, pass through untouched.
+func Middleware(doc *openapi3.T) (func(http.Handler) http.Handler, error) {
+	router, err := NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				if errors.Is(err, routers.ErrMethodNotAllowed) {
+					apierror.Write(w, http.StatusMethodNotAllowed, "Method not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			})
+			if err != nil {
+				apierror.Write(w, http.StatusBadRequest, "Request does not match the API specification", details(err)...)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// details flattens validation errors into one line each.
+func details(err error) []string {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var out []string
+		for _, e := range multi {
+			out = append(out, details(e)...)
+		}
+		return out
+	}
+
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		var nested openapi3.MultiError
+		if errors.As(reqErr.Err, &nested) {
+			return details(nested)
+		}
+		if reqErr.Parameter != nil {
+			return []string{fmt.Sprintf("parameter %q in %s: %s", reqErr.Parameter.Name, reqErr.Parameter.In, cause(reqErr.Err))}
+		}
+		if reqErr.RequestBody != nil {
+			return []string{"request body: " + cause(reqErr.Err)}
+		}
+		return []string{reqErr.Error()}
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		return []string{schemaMessage(schemaErr)}
+	}
+	return []string{err.Error()}
+}
+
+func cause(err error) string {
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		return schemaMessage(schemaErr)
+	}
+	if err == nil {
+		return "invalid"
+	}
+	return err.Error()
+}
+
+func schemaMessage(err *openapi3.SchemaError) string {
+	field := strings.Join(err.JSONPointer(), ".")
+	if field == "" {
+		return err.Reason
+	}
+	return field + ": " + err.Reason
+}
@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+)
+
+func TestSpecIsValid(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := map[string]bool{ServiceCreate: true, ServiceRetrieval: true, ServiceAnalytics: true, ServiceCleanup: true}
+	for path, item := range doc.Paths.Map() {
+		services, err := Services(item)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		for _, s := range services {
+			if !known[s] {
+				t.Errorf("%s: unknown service %q", path, s)
+			}
+		}
+	}
+}
+
+func TestForService(t *testing.T) {
+	doc, err := ForService(ServiceRetrieval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Paths.Find("/api/pastes/{url}/content") == nil {
+		t.Error("retrieval spec is missing /api/pastes/{url}/content")
+	}
+	if doc.Paths.Find("/api/pastes") != nil {
+		t.Error("retrieval spec includes create-service's /api/pastes")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	doc, err := ForService(ServiceCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := Middleware(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		want    int
+		details bool
+	}{
+		{"valid", http.MethodPost, "/api/pastes", `{"content":"hi","policyType":"NEVER"}`, http.StatusTeapot, false},
+		{"missing content", http.MethodPost, "/api/pastes", `{"policyType":"NEVER"}`, http.StatusBadRequest, true},
+		{"bad duration", http.MethodPost, "/api/pastes", `{"content":"hi","policyType":"TIMED","duration":"3days"}`, http.StatusBadRequest, true},
+		{"not json", http.MethodPost, "/api/pastes", `hello`, http.StatusBadRequest, true},
+		{"wrong method", http.MethodGet, "/api/pastes", ``, http.StatusMethodNotAllowed, false},
+		{"not in spec", http.MethodGet, "/debug/pprof/", ``, http.StatusTeapot, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == http.StatusTeapot {
+				return
+			}
+			var body apierror.Body
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("error body is not JSON: %v", err)
+			}
+			if body.Code != tt.want || body.Message == "" {
+				t.Errorf("error body = %+v", body)
+			}
+			if tt.details && len(body.Details) == 0 {
+				t.Error("error body has no details")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Package openapitest checks real handler responses against the OpenAPI
+// spec, so services can test that their API has not drifted from it.
+package openapitest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+func init() {
+	// kin-openapi only decodes text/plain out of the box; HTML pages are
+	// checked as strings the same way
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.PlainBodyDecoder)
+}
+
+// Checker serves requests through a handler and validates each request and
+// response against a service's spec.
+type Checker struct {
+	t       testing.TB
+	doc     *openapi3.T
+	router  routers.Router
+	handler http.Handler
+}
+
+// New creates a Checker for service. handler should be the service's real
+// router, or at least its real handlers mounted at the spec's paths.
+func New(t testing.TB, service string, handler http.Handler) *Checker {
+	t.Helper()
+	doc, err := openapi.ForService(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := openapi.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Checker{t: t, doc: doc, router: router, handler: handler}
+}
+
+// Do serves req, fails the test if the request or the response does not
+// match the spec, and returns the recorded response.
+func (c *Checker) Do(req *http.Request) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	route, pathParams, err := c.router.FindRoute(req)
+	if err != nil {
+		c.t.Fatalf("%s %s is not in the spec: %v", req.Method, req.URL.Path, err)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	reqInput := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	if err := openapi3filter.ValidateRequest(context.Background(), reqInput); err != nil {
+		c.t.Fatalf("%s %s: request does not match the spec: %v", req.Method, req.URL.Path, err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+
+	err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: reqInput,
+		Status:                 rec.Code,
+		Header:                 rec.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		c.t.Errorf("%s %s: %d response does not match the spec: %v\nbody: %s",
+			req.Method, req.URL.Path, rec.Code, err, rec.Body.String())
+	}
+	return rec
+}
@@ -0,0 +1,241 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNotConnected is returned while the connection is being re-established.
+var ErrNotConnected = errors.New("rabbitmq: not connected")
+
+// ErrClosed is returned once Close has been called.
+var ErrClosed = errors.New("rabbitmq: connection closed")
+
+// Topology declares exchanges, queues or bindings on a fresh channel.
+type Topology func(ch *amqp.Channel) error
+
+// ConnectionOption customises a Connection.
+type ConnectionOption func(*Connection)
+
+// WithBackoff sets the minimum and maximum delay between reconnect attempts.
+func WithBackoff(min, max time.Duration) ConnectionOption {
+	return func(c *Connection) {
+		if min > 0 {
+			c.minBackoff = min
+		}
+		if max >= c.minBackoff {
+			c.maxBackoff = max
+		}
+	}
+}
+
+// WithTopology registers declarations that run after every (re)connect.
+func WithTopology(t Topology) ConnectionOption {
+	return func(c *Connection) {
+		c.topology = append(c.topology, t)
+	}
+}
+
+// WithStateHandler registers a callback for connection state changes. err is
+// the close reason when connected is false, and nil on a successful connect.
+func WithStateHandler(fn func(connected bool, err error)) ConnectionOption {
+	return func(c *Connection) {
+		c.onState = fn
+	}
+}
+
+// Connection wraps an AMQP connection and transparently re-dials it with
+// exponential backoff whenever the broker closes it.
+type Connection struct {
+	uri        string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	topology   []Topology
+	onState    func(connected bool, err error)
+
+	mu     sync.RWMutex
+	conn   *amqp.Connection
+	ready  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Dial connects to uri and starts watching the connection. The first dial is
+// not retried so that misconfiguration surfaces at startup.
+func Dial(uri string, opts ...ConnectionOption) (*Connection, error) {
+	c := &Connection{
+		uri:        uri,
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+		ready:      make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.setConnected(conn)
+	go c.watch(conn)
+	return c, nil
+}
+
+func (c *Connection) dial() (*amqp.Connection, error) {
+	conn, err := amqp.Dial(c.uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.topology) > 0 {
+		ch, err := conn.Channel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to open channel: %w", err)
+		}
+		for _, declare := range c.topology {
+			if err := declare(ch); err != nil {
+				_ = ch.Close()
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+		_ = ch.Close()
+	}
+	return conn, nil
+}
+
+func (c *Connection) setConnected(conn *amqp.Connection) {
+	c.mu.Lock()
+	c.conn = conn
+	close(c.ready)
+	c.mu.Unlock()
+
+	if c.onState != nil {
+		c.onState(true, nil)
+	}
+}
+
+func (c *Connection) setDisconnected(reason error) {
+	c.mu.Lock()
+	c.conn = nil
+	c.ready = make(chan struct{})
+	c.mu.Unlock()
+
+	if c.onState != nil {
+		c.onState(false, reason)
+	}
+}
+
+// watch waits for the connection to drop and re-dials until it succeeds or
+// Close is called.
+func (c *Connection) watch(conn *amqp.Connection) {
+	for {
+		notify := conn.NotifyClose(make(chan *amqp.Error, 1))
+		select {
+		case <-c.closed:
+			return
+		case amqpErr, ok := <-notify:
+			if !ok || amqpErr == nil {
+				// Closed by us.
+				return
+			}
+			c.setDisconnected(amqpErr)
+		}
+
+		backoff := c.minBackoff
+		for {
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(backoff):
+			}
+
+			next, err := c.dial()
+			if err == nil {
+				conn = next
+				c.setConnected(conn)
+				break
+			}
+			if c.onState != nil {
+				c.onState(false, err)
+			}
+			backoff *= 2
+			if backoff > c.maxBackoff {
+				backoff = c.maxBackoff
+			}
+		}
+	}
+}
+
+// Channel opens a channel on the current connection.
+func (c *Connection) Channel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	select {
+	case <-c.closed:
+		return nil, ErrClosed
+	default:
+	}
+	if conn == nil || conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return conn.Channel()
+}
+
+// WaitConnected blocks until the connection is up, ctx is done or the
+// connection is closed.
+func (c *Connection) WaitConnected(ctx context.Context) error {
+	c.mu.RLock()
+	ready := c.ready
+	c.mu.RUnlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-c.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsConnected reports whether the underlying connection is currently open.
+func (c *Connection) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn != nil && !c.conn.IsClosed()
+}
+
+// Check implements a readiness probe for the connection.
+func (c *Connection) Check(context.Context) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// Close stops reconnecting and closes the current connection.
+func (c *Connection) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		conn := c.conn
+		c.conn = nil
+		c.mu.Unlock()
+		if conn != nil && !conn.IsClosed() {
+			err = conn.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,180 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ConsumerOptions describes a queue subscription.
+type ConsumerOptions struct {
+	Queue    string
+	Tag      string
+	Prefetch int
+	// Setup declares the queue and its bindings. It runs on every new
+	// channel, so the topology is restored after the broker restarts.
+	Setup Topology
+	// OnError is called when opening the channel or subscribing fails.
+	OnError func(err error)
+}
+
+// ConsumeFunc processes deliveries from one channel. It must return once
+// deliveries is closed.
+type ConsumeFunc func(deliveries <-chan amqp.Delivery)
+
+// Consumer keeps a subscription alive across channel and connection loss.
+type Consumer struct {
+	conn *Connection
+	opts ConsumerOptions
+
+	mu      sync.Mutex
+	channel *amqp.Channel
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewConsumer creates a consumer bound to conn. Nothing is consumed until Run.
+func (c *Connection) NewConsumer(opts ConsumerOptions) *Consumer {
+	if opts.Tag == "" {
+		opts.Tag = fmt.Sprintf("%s-%d", opts.Queue, time.Now().UnixNano())
+	}
+	return &Consumer{
+		conn:    c,
+		opts:    opts,
+		stopped: make(chan struct{}),
+	}
+}
+
+// Run subscribes to the queue and hands each channel's deliveries to handle.
+// When the channel dies it waits for the connection to recover and
+// subscribes again. Run returns after Stop is called or ctx is done, once
+// handle has drained the last delivery channel.
+func (c *Consumer) Run(ctx context.Context, handle ConsumeFunc) error {
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Stop()
+		case <-c.stopped:
+		}
+	}()
+
+	for {
+		if c.isStopped() {
+			return nil
+		}
+
+		ch, msgs, err := c.subscribe()
+		if err != nil {
+			if c.opts.OnError != nil {
+				c.opts.OnError(err)
+			}
+			if errors.Is(err, ErrClosed) {
+				return err
+			}
+			if !c.wait(ctx) {
+				return nil
+			}
+			continue
+		}
+
+		handle(msgs)
+
+		c.mu.Lock()
+		c.channel = nil
+		c.mu.Unlock()
+		if !ch.IsClosed() {
+			_ = ch.Close()
+		}
+	}
+}
+
+func (c *Consumer) subscribe() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.opts.Setup != nil {
+		if err := c.opts.Setup(ch); err != nil {
+			_ = ch.Close()
+			return nil, nil, err
+		}
+	}
+	if c.opts.Prefetch > 0 {
+		if err := ch.Qos(c.opts.Prefetch, 0, false); err != nil {
+			_ = ch.Close()
+			return nil, nil, fmt.Errorf("failed to set QoS: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isStopped() {
+		_ = ch.Close()
+		return nil, nil, ErrClosed
+	}
+
+	msgs, err := ch.Consume(c.opts.Queue, c.opts.Tag, false, false, false, false, nil)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, fmt.Errorf("failed to consume from %s: %w", c.opts.Queue, err)
+	}
+	c.channel = ch
+	return ch, msgs, nil
+}
+
+// wait pauses before resubscribing. It returns false if the consumer was
+// stopped in the meantime.
+func (c *Consumer) wait(ctx context.Context) bool {
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stopped:
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	if err := c.conn.WaitConnected(waitCtx); err != nil {
+		return false
+	}
+	// The connection may be up while the channel keeps failing (for example
+	// on a topology mismatch), so never spin.
+	select {
+	case <-time.After(c.conn.minBackoff):
+		return !c.isStopped()
+	case <-waitCtx.Done():
+		return false
+	}
+}
+
+func (c *Consumer) isStopped() bool {
+	select {
+	case <-c.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop cancels the subscription. The broker stops sending new deliveries,
+// and Run returns once handle has processed those already received.
+func (c *Consumer) Stop() error {
+	var err error
+	c.once.Do(func() {
+		c.mu.Lock()
+		close(c.stopped)
+		ch := c.channel
+		c.mu.Unlock()
+
+		if ch != nil && !ch.IsClosed() {
+			err = ch.Cancel(c.opts.Tag, false)
+		}
+	})
+	return err
+}
@@ -0,0 +1,250 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrNacked is returned when the broker negatively acknowledges a message.
+	ErrNacked = errors.New("rabbitmq: message nacked by broker")
+	// ErrUnroutable is returned when a mandatory message matched no queue.
+	ErrUnroutable = errors.New("rabbitmq: message returned as unroutable")
+	// ErrConfirmTimeout is returned when no confirm arrives within the wait bound.
+	ErrConfirmTimeout = errors.New("rabbitmq: timed out waiting for publisher confirm")
+)
+
+const defaultConfirmTimeout = 5 * time.Second
+
+// returnBuffer is how many returned messages can wait to be matched with
+// their publish. The broker blocks the channel while it is full.
+const returnBuffer = 128
+
+// PublisherOption customises a Publisher.
+type PublisherOption func(*Publisher)
+
+// WithConfirmTimeout bounds how long Publish waits for the broker ack.
+func WithConfirmTimeout(d time.Duration) PublisherOption {
+	return func(p *Publisher) {
+		if d > 0 {
+			p.confirmTimeout = d
+		}
+	}
+}
+
+// WithReturnHandler registers a callback invoked for every returned message.
+func WithReturnHandler(fn func(amqp.Return)) PublisherOption {
+	return func(p *Publisher) {
+		p.onReturn = fn
+	}
+}
+
+// Publisher publishes to a single exchange on a channel in confirm mode.
+// Every message is sent mandatory and persistent, and Publish only reports
+// success once the broker has acked it. Publishes from several goroutines
+// share the channel and wait for their confirms concurrently; returned
+// messages are matched to their publish by message ID. The channel is
+// reopened on demand after the connection recovers.
+type Publisher struct {
+	conn           *Connection
+	exchange       string
+	confirmTimeout time.Duration
+	onReturn       func(amqp.Return)
+
+	// mu is held while opening the channel and sending, not while waiting
+	mu      sync.Mutex
+	channel *amqp.Channel
+	returns chan amqp.Return
+
+	// returned holds the returns of publishes still waiting for their confirm
+	retMu    sync.Mutex
+	waiting  map[string]int
+	returned map[string]amqp.Return
+}
+
+// NewPublisher declares the topic exchange and opens a confirm-mode channel.
+// An empty exchange publishes through the default exchange, addressing
+// queues directly by name.
+func NewPublisher(conn *Connection, exchange string, opts ...PublisherOption) (*Publisher, error) {
+	p := &Publisher{
+		conn:           conn,
+		exchange:       exchange,
+		confirmTimeout: defaultConfirmTimeout,
+		waiting:        map[string]int{},
+		returned:       map[string]amqp.Return{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Publisher) open() error {
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	// The default exchange ("") always exists and cannot be declared.
+	if p.exchange != "" {
+		if err := DeclareExchange(ch, p.exchange); err != nil {
+			_ = ch.Close()
+			return err
+		}
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("failed to enable confirm mode: %w", err)
+	}
+
+	// The broker sends basic.return before the ack of the same message, so
+	// once a publish is acked its return, if any, is already in this buffer.
+	p.returns = ch.NotifyReturn(make(chan amqp.Return, returnBuffer))
+	p.channel = ch
+	return nil
+}
+
+// DeclareExchange declares a durable topic exchange.
+func DeclareExchange(ch *amqp.Channel, exchange string) error {
+	if err := ch.ExchangeDeclare(exchange, "topic", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange: %w", err)
+	}
+	return nil
+}
+
+// Publish sends msg with the given routing key and waits for the broker to
+// confirm it. A nil error means the broker acked the message and routed it to
+// at least one queue. The trace context and request ID of ctx travel in the
+// message headers.
+func (p *Publisher) Publish(ctx context.Context, routingKey string, msg amqp.Publishing) error {
+	ctx, span := startPublishSpan(ctx, p.exchange, routingKey, &msg)
+	// startPublishSpan copied the headers, so the caller's table is untouched.
+	if id := requestid.FromContext(ctx); id != "" {
+		msg.Headers[HeaderRequestID] = id
+	}
+	err := p.publish(ctx, routingKey, msg)
+	EndSpan(span, err)
+	return err
+}
+
+func (p *Publisher) publish(ctx context.Context, routingKey string, msg amqp.Publishing) error {
+	if msg.DeliveryMode == 0 {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	// Returns are matched by message ID, so every message needs one
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+
+	p.expectReturn(msg.MessageId)
+	defer p.forgetReturn(msg.MessageId)
+
+	dc, returns, err := p.send(ctx, routingKey, msg)
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, p.confirmTimeout)
+	defer cancel()
+	acked, err := dc.WaitContext(waitCtx)
+	if err != nil {
+		// Free the buffer in case a backlog of returns is what holds the
+		// confirms up
+		p.takeReturn(returns, msg.MessageId)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%s: %w", routingKey, ErrConfirmTimeout)
+		}
+		return fmt.Errorf("failed to confirm %s: %w", routingKey, err)
+	}
+	if !acked {
+		return fmt.Errorf("%s: %w", routingKey, ErrNacked)
+	}
+
+	if ret, ok := p.takeReturn(returns, msg.MessageId); ok {
+		if p.onReturn != nil {
+			p.onReturn(ret)
+		}
+		return fmt.Errorf("%s: %w (%d %s)", routingKey, ErrUnroutable, ret.ReplyCode, ret.ReplyText)
+	}
+	return nil
+}
+
+// send publishes msg, reopening the channel if needed, and returns its
+// pending confirmation with the returns channel it was published under.
+func (p *Publisher) send(ctx context.Context, routingKey string, msg amqp.Publishing) (*amqp.DeferredConfirmation, <-chan amqp.Return, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channel == nil || p.channel.IsClosed() {
+		if err := p.open(); err != nil {
+			return nil, nil, err
+		}
+	}
+	dc, err := p.channel.PublishWithDeferredConfirmWithContext(ctx, p.exchange, routingKey, true, false, msg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to publish %s: %w", routingKey, err)
+	}
+	return dc, p.returns, nil
+}
+
+// expectReturn registers a publish of message id waiting for its confirm.
+func (p *Publisher) expectReturn(id string) {
+	p.retMu.Lock()
+	defer p.retMu.Unlock()
+	p.waiting[id]++
+}
+
+// forgetReturn unregisters a publish of message id, dropping its return
+// once no other publish of the same ID waits for it.
+func (p *Publisher) forgetReturn(id string) {
+	p.retMu.Lock()
+	defer p.retMu.Unlock()
+	if p.waiting[id]--; p.waiting[id] <= 0 {
+		delete(p.waiting, id)
+		delete(p.returned, id)
+	}
+}
+
+// takeReturn moves the returns received so far to the publishes waiting
+// for them, dropping those of publishes that gave up, and reports whether
+// message id was returned.
+func (p *Publisher) takeReturn(returns <-chan amqp.Return, id string) (amqp.Return, bool) {
+	p.retMu.Lock()
+	defer p.retMu.Unlock()
+	for drained := false; !drained; {
+		select {
+		case ret := <-returns:
+			if p.waiting[ret.MessageId] > 0 {
+				p.returned[ret.MessageId] = ret
+			}
+		default:
+			drained = true
+		}
+	}
+	ret, ok := p.returned[id]
+	delete(p.returned, id)
+	return ret, ok
+}
+
+// Close closes the underlying channel.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.channel == nil || p.channel.IsClosed() {
+		return nil
+	}
+	return p.channel.Close()
+}
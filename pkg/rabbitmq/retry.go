@@ -0,0 +1,242 @@
+package rabbitmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers carried by retried and dead-lettered messages.
+const (
+	HeaderRetryCount         = "x-retry-count"
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	HeaderLastError          = "x-last-error"
+	HeaderDeadLetterID       = "x-dead-letter-id"
+	HeaderDeadLetteredAt     = "x-dead-lettered-at"
+)
+
+// RetryPolicy controls how often and how late a failed message is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of deliveries, including the first,
+	// before the message is dead-lettered.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy retries four times with 1s, 2s, 4s and 8s delays.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+}
+
+func (p RetryPolicy) normalize() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	return p
+}
+
+// Delay returns the wait before the given retry (1-based).
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	p = p.normalize()
+	d := p.BaseDelay
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return d
+}
+
+// DeadLetterQueueName returns the name of queue's dead-letter queue.
+func DeadLetterQueueName(queue string) string {
+	return queue + ".dlq"
+}
+
+// RetryQueueName returns the name of the delay queue used for delay d. The
+// delay is part of the name so that changing the policy never conflicts with
+// an existing queue's x-message-ttl.
+func RetryQueueName(queue string, d time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, d.Milliseconds())
+}
+
+// DeclareRetryTopology declares the dead-letter queue and one TTL'd retry
+// queue per retry level for queue. Expired retry messages are dead-lettered
+// back to queue through the default exchange.
+func DeclareRetryTopology(ch *amqp.Channel, queue string, policy RetryPolicy) error {
+	policy = policy.normalize()
+
+	if _, err := ch.QueueDeclare(DeadLetterQueueName(queue), true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+
+	for retry := 1; retry < policy.MaxAttempts; retry++ {
+		delay := policy.Delay(retry)
+		_, err := ch.QueueDeclare(RetryQueueName(queue, delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue: %w", err)
+		}
+	}
+	return nil
+}
+
+// Attempts returns how many times the delivery has already failed.
+func Attempts(d amqp.Delivery) int {
+	return headerInt(d.Headers, HeaderRetryCount)
+}
+
+// RoutingKey returns the routing key the message was originally published
+// with, which differs from d.RoutingKey once it went through a retry queue.
+func RoutingKey(d amqp.Delivery) string {
+	if key, ok := d.Headers[HeaderOriginalRoutingKey].(string); ok && key != "" {
+		return key
+	}
+	return d.RoutingKey
+}
+
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// Retrier moves failed deliveries of one queue to its retry or dead-letter
+// queues. The original delivery is acked only after the copy is confirmed.
+type Retrier struct {
+	queue     string
+	policy    RetryPolicy
+	publisher *Publisher
+}
+
+// NewRetrier creates a Retrier for queue. The topology must have been
+// declared with DeclareRetryTopology using the same policy.
+func NewRetrier(conn *Connection, queue string, policy RetryPolicy) (*Retrier, error) {
+	publisher, err := NewPublisher(conn, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Retrier{
+		queue:     queue,
+		policy:    policy.normalize(),
+		publisher: publisher,
+	}, nil
+}
+
+// Policy returns the retry policy in use.
+func (r *Retrier) Policy() RetryPolicy {
+	return r.policy
+}
+
+// Retry schedules d for another attempt after the policy's delay, or
+// dead-letters it once MaxAttempts is reached.
+func (r *Retrier) Retry(ctx context.Context, d amqp.Delivery, cause error) error {
+	attempt := Attempts(d) + 1
+	if attempt >= r.policy.MaxAttempts {
+		return r.DeadLetter(ctx, d, cause)
+	}
+
+	msg := Republish(d)
+	msg.Headers[HeaderRetryCount] = int32(attempt)
+	msg.Headers[HeaderLastError] = errorText(cause)
+	return r.forward(ctx, d, RetryQueueName(r.queue, r.policy.Delay(attempt)), msg)
+}
+
+// DeadLetter moves d straight to the dead-letter queue, for messages that
+// can never succeed such as undecodable payloads.
+func (r *Retrier) DeadLetter(ctx context.Context, d amqp.Delivery, cause error) error {
+	msg := Republish(d)
+	msg.Headers[HeaderRetryCount] = int32(Attempts(d) + 1)
+	msg.Headers[HeaderLastError] = errorText(cause)
+	msg.Headers[HeaderDeadLetterID] = newID()
+	msg.Headers[HeaderDeadLetteredAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	return r.forward(ctx, d, DeadLetterQueueName(r.queue), msg)
+}
+
+func (r *Retrier) forward(ctx context.Context, d amqp.Delivery, queue string, msg amqp.Publishing) error {
+	if err := r.publisher.Publish(ctx, queue, msg); err != nil {
+		// Keep the message rather than lose it; it will be redelivered.
+		_ = d.Nack(false, true)
+		return err
+	}
+	return d.Ack(false)
+}
+
+// Close closes the retry publisher's channel.
+func (r *Retrier) Close() error {
+	return r.publisher.Close()
+}
+
+// Republish copies a delivery into a publishing, recording the original
+// routing key so consumers can still dispatch on it.
+func Republish(d amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	if _, ok := headers[HeaderOriginalRoutingKey]; !ok {
+		headers[HeaderOriginalRoutingKey] = d.RoutingKey
+	}
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
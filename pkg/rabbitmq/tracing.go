@@ -0,0 +1,148 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
+
+// HeaderRequestID carries the ID of the HTTP request that caused a message.
+const HeaderRequestID = "x-request-id"
+
+// RequestID returns the ID of the HTTP request that caused d, or "" when
+// the publisher did not record one.
+func RequestID(d amqp.Delivery) string {
+	id, _ := d.Headers[HeaderRequestID].(string)
+	return id
+}
+
+// headerCarrier lets the OpenTelemetry propagator read and write trace
+// context in AMQP message headers.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// ExtractContext returns ctx carrying the trace context found in headers.
+func ExtractContext(ctx context.Context, headers amqp.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(headers))
+}
+
+// StartConsumeSpan starts a consumer span for d as a child of the span that
+// published it, and restores the request ID it was published under. Handlers
+// should pass the returned context to everything they call and end the span
+// once the delivery is settled.
+func StartConsumeSpan(ctx context.Context, queue string, d amqp.Delivery) (context.Context, trace.Span) {
+	ctx = ExtractContext(ctx, d.Headers)
+	if id := RequestID(d); id != "" {
+		ctx = requestid.NewContext(ctx, id)
+	}
+	return otel.Tracer(tracerName).Start(ctx, queue+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(deliveryAttributes(queue, d)...),
+	)
+}
+
+// StartBatchSpan starts a consumer span for a batch of deliveries processed
+// together. The span links to every message's trace; a batch of one simply
+// continues that message's trace.
+func StartBatchSpan(ctx context.Context, queue string, ds []amqp.Delivery) (context.Context, trace.Span) {
+	if len(ds) == 1 {
+		return StartConsumeSpan(ctx, queue, ds[0])
+	}
+
+	links := make([]trace.Link, 0, len(ds))
+	for _, d := range ds {
+		if sc := trace.SpanContextFromContext(ExtractContext(context.Background(), d.Headers)); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	return otel.Tracer(tracerName).Start(ctx, queue+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", queue),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.Int("messaging.batch.message_count", len(ds)),
+		),
+	)
+}
+
+// EndSpan records err on span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startPublishSpan starts a producer span and writes its context into a copy
+// of msg's headers. Without a span in ctx the publish continues the trace
+// already in the headers, so retried and replayed messages stay in the trace
+// of their original publish.
+func startPublishSpan(ctx context.Context, exchange, routingKey string, msg *amqp.Publishing) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = ExtractContext(ctx, msg.Headers)
+	}
+
+	destination := exchange
+	if destination == "" {
+		destination = routingKey
+	}
+	ctx, span := otel.Tracer(tracerName).Start(ctx, destination+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", destination),
+			attribute.String("messaging.operation.type", "send"),
+			attribute.String("messaging.rabbitmq.destination.routing_key", routingKey),
+			attribute.String("messaging.message.id", msg.MessageId),
+		),
+	)
+
+	headers := make(amqp.Table, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+	msg.Headers = headers
+	return ctx, span
+}
+
+func deliveryAttributes(queue string, d amqp.Delivery) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", queue),
+		attribute.String("messaging.operation.type", "process"),
+		attribute.String("messaging.rabbitmq.destination.routing_key", RoutingKey(d)),
+		attribute.String("messaging.message.id", d.MessageId),
+		attribute.Int("messaging.rabbitmq.retry_count", Attempts(d)),
+		attribute.String("request.id", RequestID(d)),
+	}
+}
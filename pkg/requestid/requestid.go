@@ -0,0 +1,63 @@
+// Package requestid carries a correlation ID from the HTTP request that
+// started an operation through every event it publishes, so one ID can be
+// followed across services in the logs.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP header carrying the request ID in both directions.
+const Header = "X-Request-ID"
+
+// maxLength bounds IDs accepted from callers so they stay log-friendly.
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// New returns a fresh request ID.
+func New() string {
+	return uuid.NewString()
+}
+
+// Middleware takes the request ID from the X-Request-ID header, or generates
+// one when it is missing or malformed, stores it in the request context and
+// echoes it in the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// valid accepts IDs made of printable ASCII without spaces, so a caller
+// cannot forge log lines through the header.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
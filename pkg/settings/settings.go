@@ -0,0 +1,394 @@
+// Package settings loads a service's configuration into a tagged struct from,
+// in increasing order of precedence:
+//
+//  1. the default tag of each field,
+//  2. a YAML file named by CONFIG_FILE, keyed by the environment variable names,
+//  3. environment variables,
+//  4. files named by <NAME>_FILE, the way Docker and Kubernetes mount secrets.
+//
+// Empty environment variables count as unset, so a copied .env.template
+// does not override the defaults.
+//
+// Every value is parsed and validated at startup, and all problems are
+// reported together instead of being replaced by a default.
+//
+//	type Config struct {
+//		Port     string        `env:"PORT" default:"8080" validate:"port"`
+//		MySQLDSN string        `env:"MYSQL_DSN" secret:"true" validate:"required"`
+//		Timeout  time.Duration `env:"TIMEOUT" default:"5s" validate:"min=1s"`
+//		LogLevel string        `env:"LOG_LEVEL" default:"info" reload:"true"`
+//	}
+//
+// Fields tagged secret are redacted by Redact, and fields tagged reload are
+// the ones a Store applies without a restart.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable naming the optional YAML file.
+const FileEnv = "CONFIG_FILE"
+
+// Options overrides where Load reads from; the zero value reads the process
+// environment and the file named by CONFIG_FILE.
+type Options struct {
+	// File is the YAML file to read; when empty, CONFIG_FILE is used.
+	File string
+	// LookupEnv replaces os.LookupEnv, mainly for tests.
+	LookupEnv func(key string) (string, bool)
+}
+
+// ValidationError lists every invalid setting found by Load.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validator is implemented by configs with rules spanning several fields.
+// It runs after every field has been parsed and validated.
+type Validator interface {
+	Validate() error
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load fills dst, a pointer to a struct with env tags, from every source.
+func Load(dst any, opts Options) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("settings: Load needs a pointer to a struct, got %T", dst)
+	}
+	lookup := opts.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	file := opts.File
+	if file == "" {
+		file, _ = lookup(FileEnv)
+	}
+	fileValues, err := readFile(file)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, f := range fields(v.Elem()) {
+		raw, source, err := resolve(f, fileValues, lookup)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if err := set(f.value, raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid value %q from %s: %v", f.env, display(f, raw), source, err))
+			continue
+		}
+		for _, err := range validate(f, raw) {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.env, err))
+		}
+	}
+	if len(problems) == 0 {
+		if val, ok := dst.(Validator); ok {
+			if err := val.Validate(); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// field is one tagged struct field.
+type field struct {
+	env    string
+	value  reflect.Value
+	tag    reflect.StructTag
+	secret bool
+	reload bool
+}
+
+func fields(v reflect.Value) []field {
+	var out []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		env := sf.Tag.Get("env")
+		if env == "" || !sf.IsExported() {
+			continue
+		}
+		out = append(out, field{
+			env:    env,
+			value:  v.Field(i),
+			tag:    sf.Tag,
+			secret: sf.Tag.Get("secret") == "true",
+			reload: sf.Tag.Get("reload") == "true",
+		})
+	}
+	return out
+}
+
+// resolve returns the raw value of f from the highest-precedence source
+// that sets it, and the name of that source for error messages.
+func resolve(f field, fileValues map[string]string, lookup func(string) (string, bool)) (string, string, error) {
+	raw, source := f.tag.Get("default"), "default"
+	if v, ok := fileValues[f.env]; ok {
+		raw, source = v, "config file"
+	}
+	envValue, _ := lookup(f.env)
+	inEnv := envValue != ""
+	if inEnv {
+		raw, source = envValue, "environment"
+	}
+	if path, _ := lookup(f.env + "_FILE"); path != "" {
+		if inEnv {
+			return "", "", fmt.Errorf("%s: both %s and %s_FILE are set", f.env, f.env, f.env)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: failed to read %s_FILE: %v", f.env, f.env, err)
+		}
+		raw, source = strings.TrimRight(string(b), "\r\n"), f.env+"_FILE"
+	}
+	return raw, source, nil
+}
+
+// readFile reads a flat YAML mapping of variable names to scalar values.
+// Keys are matched case-insensitively.
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	values := make(map[string]string, len(doc))
+	for k, v := range doc {
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("config file %s: %s must be a scalar", path, k)
+		case nil:
+			values[strings.ToUpper(k)] = ""
+		default:
+			values[strings.ToUpper(k)] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		if raw == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		if raw == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// validate applies the comma-separated rules of the validate tag:
+// required, oneof=a b c, min=N, max=N, port and url. Rules other than
+// required are skipped for empty values.
+func validate(f field, raw string) []error {
+	rules := f.tag.Get("validate")
+	if rules == "" {
+		return nil
+	}
+	var errs []error
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if raw == "" {
+				errs = append(errs, errors.New("is required"))
+			}
+			continue
+		}
+		if raw == "" {
+			continue
+		}
+		if err := check(f, name, arg, raw); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func check(f field, rule, arg, raw string) error {
+	switch rule {
+	case "oneof":
+		for _, allowed := range strings.Fields(arg) {
+			if raw == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s, got %q", strings.Join(strings.Fields(arg), ", "), raw)
+	case "min", "max":
+		cmp, err := compare(f.value, arg)
+		if err != nil {
+			return fmt.Errorf("bad %s rule: %v", rule, err)
+		}
+		if rule == "min" && cmp < 0 {
+			return fmt.Errorf("must be at least %s", arg)
+		}
+		if rule == "max" && cmp > 0 {
+			return fmt.Errorf("must be at most %s", arg)
+		}
+		return nil
+	case "port":
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("must be a port number, got %q", raw)
+		}
+		return nil
+	case "url":
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("must be an absolute URL")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown validation rule %q", rule)
+	}
+}
+
+// compare returns the sign of v minus the limit written as arg.
+func compare(v reflect.Value, arg string) (int, error) {
+	if v.Type() == durationType {
+		limit, err := time.ParseDuration(arg)
+		if err != nil {
+			return 0, err
+		}
+		return sign(float64(v.Int()) - float64(limit)), nil
+	}
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64:
+		return sign(float64(v.Int()) - limit), nil
+	case reflect.Float64:
+		return sign(v.Float() - limit), nil
+	default:
+		return 0, fmt.Errorf("not numeric: %s", v.Type())
+	}
+}
+
+func sign(f float64) int {
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
+
+// Redacted replaces credentials in secret values.
+const Redacted = "xxxxx"
+
+// dsnCredentials matches the user:password@ prefix of a MySQL DSN.
+var dsnCredentials = regexp.MustCompile(`^([^:@/]*):[^@]*@`)
+
+// Redact returns the settings of cfg keyed by variable name, with the
+// password of secret URLs and DSNs and any other secret value hidden.
+func Redact(cfg any) map[string]any {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	out := make(map[string]any)
+	for _, f := range fields(v) {
+		if f.secret {
+			out[f.env] = redact(f.value.String())
+			continue
+		}
+		if f.value.Type() == durationType {
+			out[f.env] = time.Duration(f.value.Int()).String()
+			continue
+		}
+		out[f.env] = f.value.Interface()
+	}
+	return out
+}
+
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Redacted()
+	}
+	if dsnCredentials.MatchString(s) {
+		return dsnCredentials.ReplaceAllString(s, "${1}:"+Redacted+"@")
+	}
+	return Redacted
+}
+
+// display is the form of raw safe to put in an error message.
+func display(f field, raw string) string {
+	if f.secret {
+		return redact(raw)
+	}
+	return raw
+}
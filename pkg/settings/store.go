@@ -0,0 +1,157 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"go.uber.org/zap"
+)
+
+// Store holds the live configuration of a service and reloads the fields
+// tagged reload:"true" on SIGHUP or through its admin endpoint. Changes to
+// any other field are reported as needing a restart and are not applied.
+type Store[T any] struct {
+	load func() (*T, error)
+
+	mu        sync.Mutex
+	current   atomic.Pointer[T]
+	listeners []func(old, cur *T)
+}
+
+// ReloadResult lists the settings a reload changed.
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// NewStore returns a store holding cfg; load reads a fresh copy on reload.
+func NewStore[T any](cfg *T, load func() (*T, error)) *Store[T] {
+	s := &Store[T]{load: load}
+	s.current.Store(cfg)
+	return s
+}
+
+// Current returns the configuration in effect. The returned value must not
+// be modified.
+func (s *Store[T]) Current() *T {
+	return s.current.Load()
+}
+
+// OnReload registers fn to run after every reload that applied a change.
+func (s *Store[T]) OnReload(fn func(old, cur *T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Reload loads and validates the configuration again and applies the
+// reloadable fields that changed. Nothing is applied if loading fails.
+func (s *Store[T]) Reload() (ReloadResult, error) {
+	fresh, err := s.load()
+	if err != nil {
+		return ReloadResult{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.current.Load()
+	next := new(T)
+	*next = *old
+	res := ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+	nextFields := fields(reflect.ValueOf(next).Elem())
+	for i, f := range fields(reflect.ValueOf(fresh).Elem()) {
+		target := nextFields[i]
+		if reflect.DeepEqual(f.value.Interface(), target.value.Interface()) {
+			continue
+		}
+		if !f.reload {
+			res.RestartRequired = append(res.RestartRequired, f.env)
+			continue
+		}
+		target.value.Set(f.value)
+		res.Applied = append(res.Applied, f.env)
+	}
+	if len(res.Applied) == 0 {
+		return res, nil
+	}
+
+	s.current.Store(next)
+	for _, fn := range s.listeners {
+		fn(old, next)
+	}
+	return res, nil
+}
+
+// WatchSignals reloads on every SIGHUP until ctx is done.
+func (s *Store[T]) WatchSignals(ctx context.Context, logger *zap.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			res, err := s.Reload()
+			if err != nil {
+				logger.Error("Failed to reload configuration", zap.Error(err))
+				continue
+			}
+			logger.Info("Reloaded configuration", zap.Strings("applied", res.Applied),
+				zap.Strings("restartRequired", res.RestartRequired))
+		}
+	}
+}
+
+// Reloadable returns the names of the settings applied without a restart.
+func (s *Store[T]) Reloadable() []string {
+	var names []string
+	for _, f := range fields(reflect.ValueOf(s.Current()).Elem()) {
+		if f.reload {
+			names = append(names, f.env)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handler serves GET with the redacted configuration in effect.
+func (s *Store[T]) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"settings":   Redact(s.Current()),
+			"reloadable": s.Reloadable(),
+		})
+	}
+}
+
+// ReloadHandler serves POST by reloading the configuration.
+func (s *Store[T]) ReloadHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := s.Reload()
+		if err != nil {
+			var invalid *ValidationError
+			if errors.As(err, &invalid) {
+				apierror.Write(w, http.StatusUnprocessableEntity, "Invalid configuration", invalid.Problems...)
+				return
+			}
+			apierror.Write(w, http.StatusInternalServerError, "Failed to reload configuration", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
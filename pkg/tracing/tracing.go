@@ -0,0 +1,123 @@
+// Package tracing sets up OpenTelemetry for the services and instruments
+// their HTTP routers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted in Config.Exporter.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config selects where spans are exported.
+type Config struct {
+	ServiceName string
+	// Exporter is one of ExporterNone, ExporterOTLP or ExporterStdout. An
+	// empty value disables tracing.
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://otel-collector:4318.
+	// When empty the exporter falls back to OTEL_EXPORTER_OTLP_ENDPOINT.
+	Endpoint string
+	// SampleRatio is the fraction of new traces that are recorded. Spans
+	// continuing a remote trace follow the caller's decision.
+	SampleRatio float64
+}
+
+// Init installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes buffered spans and must be called
+// before the process exits. With tracing disabled the propagator is still
+// installed, so trace context passes through the service untouched.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// untraced paths are scraped or probed constantly and would drown out real
+// traffic.
+var untraced = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// Middleware starts a server span for every request, continuing any trace
+// context sent by the caller. It must be installed on a chi router: spans
+// are named after the matched route pattern once routing is done, so
+// /api/pastes/{url} groups all pastes under one name.
+func Middleware(service string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			rctx := chi.RouteContext(r.Context())
+			if rctx == nil {
+				return
+			}
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + pattern)
+				span.SetAttributes(attribute.String("http.route", pattern))
+			}
+		})
+		return otelhttp.NewHandler(named, service,
+			otelhttp.WithFilter(func(r *http.Request) bool { return !untraced[r.URL.Path] }),
+		)
+	}
+}
@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"github.com/go-redis/redis/v8"
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/ArsiHien/pastebin-ms/events"
+	"github.com/ArsiHien/pastebin-ms/pkg/auth"
+	"github.com/ArsiHien/pastebin-ms/pkg/dedup"
+	"github.com/ArsiHien/pastebin-ms/pkg/dlq"
+	"github.com/ArsiHien/pastebin-ms/pkg/health"
+	"github.com/ArsiHien/pastebin-ms/pkg/lifecycle"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
+	"github.com/ArsiHien/pastebin-ms/pkg/requestid"
+	"github.com/ArsiHien/pastebin-ms/pkg/settings"
+	"github.com/ArsiHien/pastebin-ms/pkg/tracing"
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
-	"retrieval-service/shared"
-	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -18,10 +26,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.uber.org/zap"
 	"retrieval-service/config"
 	"retrieval-service/internal/cache"
 	"retrieval-service/internal/eventbus"
 	"retrieval-service/internal/handlers"
+	"retrieval-service/internal/rebuild"
 	"retrieval-service/internal/repository"
 	"retrieval-service/internal/service/paste"
 )
@@ -34,92 +45,215 @@ func main() {
 	}
 
 	// Initialize logger
-	logger := shared.NewLogger()
+	logger, logLevel, err := logging.New(logging.Config{
+		Service: "retrieval-service",
+		Level:   cfg.LogLevel,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
 	defer logger.Sync()
 
+	// LOG_LEVEL can be changed by editing CONFIG_FILE and sending SIGHUP
+	cfgStore := settings.NewStore(cfg, config.Load)
+	cfgStore.OnReload(func(old, cur *config.Config) {
+		if cur.LogLevel != old.LogLevel {
+			_ = logLevel.UnmarshalText([]byte(cur.LogLevel))
+		}
+	})
+	go cfgStore.WatchSignals(context.Background(), logger)
+
+	// Admin API credentials can be rotated by reloading the configuration
+	tokens, keys := cfg.AdminCredentials()
+	authenticator := auth.NewAuthenticator(tokens, keys, cfg.AdminHMACMaxSkew)
+	if authenticator.Empty() {
+		logger.Warn("Neither ADMIN_TOKENS nor ADMIN_HMAC_KEYS is set; every admin request will be rejected")
+	}
+	cfgStore.OnReload(func(old, cur *config.Config) {
+		if cur.AdminTokens != old.AdminTokens || cur.AdminHMACKeys != old.AdminHMACKeys {
+			authenticator.SetCredentials(cur.AdminCredentials())
+			logger.Info("Reloaded admin credentials")
+		}
+	})
+	auditLogger, closeAuditLog, err := auth.NewAuditLogger(logger, cfg.AuditLogFile)
+	if err != nil {
+		logger.Fatal("Failed to open audit log", zap.Error(err))
+	}
+	// Per-request logs of the read path are sampled; everything else is not
+	requestLogger := logging.Sampled(logger, logging.Sampling{
+		First:      cfg.LogSampleFirst,
+		Thereafter: cfg.LogSampleThereafter,
+	})
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "retrieval-service",
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", zap.Error(err))
+		}
+	}()
+
 	// Connect to MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	log.Println(cfg.MongoURI)
-	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI).
+		SetMonitor(otelmongo.NewMonitor()))
 	if err != nil {
-		logger.Fatalf("Failed to connect to MongoDB", "error", err)
+		logger.Fatal("Failed to connect to MongoDB", zap.Error(err))
 	}
-	defer func(mongoClient *mongo.Client, ctx context.Context) {
-		if err := mongoClient.Disconnect(ctx); err != nil {
-			logger.Errorf("Failed to disconnect from MongoDB", "error", err)
-		} else {
-			logger.Infof("Disconnected from MongoDB")
-		}
-	}(mongoClient, ctx)
 
 	// Connect to Redis
 	redisClient, err := cache.NewRedisClient(cfg.RedisURI)
 	if err != nil {
-		logger.Fatalf("Failed to connect to Redis", "error", err)
+		logger.Fatal("Failed to connect to Redis", zap.Error(err))
 	}
-	defer func(redisClient *redis.Client) {
-		if err := redisClient.Close(); err != nil {
-			logger.Errorf("Failed to close Redis connection", "error", err)
-		} else {
-			logger.Infof("Disconnected from Redis")
+	// Cache hai tầng: LRU trong tiến trình trước Redis
+	pasteCache := cache.NewTieredPasteCache(
+		cache.NewLocalPasteCache(cfg.LocalCacheMaxBytes, cfg.LocalCacheTTL),
+		cache.NewRedisPasteCache(redisClient), redisClient, logger)
+	negativeCache := cache.NewRedisNegativeCache(redisClient, cfg.NegativeCacheTTL)
+
+	// Rebuild job đọc lại toàn bộ paste từ MySQL của create-service
+	var rebuildJob *rebuild.Job
+	var mysqlDB *sql.DB
+	if cfg.MySQLDSN != "" {
+		mysqlDB, err = openMySQL(cfg.MySQLDSN)
+		if err != nil {
+			logger.Fatal("Failed to connect to MySQL", zap.Error(err))
 		}
-	}(redisClient)
+		rebuildJob = rebuild.NewJob(mysqlDB,
+			repository.NewMongoPasteRepository(mongoClient.Database(cfg.MongoDBName)),
+			pasteCache, mongoClient.Database(cfg.MongoDBName), logger)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rebuild" {
+		if rebuildJob == nil {
+			logger.Fatal("CREATE_MYSQL_DSN is required to rebuild the read model")
+		}
+		err := runRebuild(rebuildJob, os.Args[2:], logger)
+		_ = mysqlDB.Close()
+		_ = redisClient.Close()
+		_ = mongoClient.Disconnect(context.Background())
+		if err != nil {
+			logger.Fatal("Rebuild failed", zap.Error(err))
+		}
+		return
+	}
 
 	// Connect to RabbitMQ
-	rabbitConn, err := eventbus.NewRabbitMQConn(cfg.RabbitMQURI)
+	rabbitConn, err := eventbus.NewRabbitMQConn(cfg.RabbitMQURI, logger)
 	if err != nil {
-		logger.Fatalf("Failed to connect to RabbitMQ", "error", err)
+		logger.Fatal("Failed to connect to RabbitMQ", zap.Error(err))
 	}
-	defer func(rabbitConn *amqp.Connection) {
-		if err := rabbitConn.Close(); err != nil {
-			logger.Errorf("Failed to close RabbitMQ connection", "error", err)
-		} else {
-			logger.Infof("Disconnected from RabbitMQ")
-		}
-	}(rabbitConn)
 	// Initialize dependencies
 	pasteRepo := repository.NewMongoPasteRepository(mongoClient.Database(cfg.MongoDBName))
-	pasteCache := cache.NewRedisPasteCache(redisClient)
-	publisher, err := eventbus.NewRabbitMQPublisher(rabbitConn)
+	publisher, err := eventbus.NewRabbitMQPublisher(rabbitConn, cfg.PublishConfirmTimeout,
+		cfg.EventsContentType, logger)
 	if err != nil {
-		logger.Fatalf("Failed to create RabbitMQ publisher", "error", err)
+		logger.Fatal("Failed to create RabbitMQ publisher", zap.Error(err))
+	}
+
+	dedupCtx, cancelDedup := context.WithTimeout(context.Background(), 10*time.Second)
+	dedupStore, err := dedup.NewStore(dedupCtx, mongoClient.Database(cfg.MongoDBName),
+		"paste-creation-consumer", cfg.DedupTTL)
+	cancelDedup()
+	if err != nil {
+		logger.Fatal("Failed to create dedup store", zap.Error(err))
 	}
-	defer func(publisher *eventbus.RabbitMQPublisher) {
-		if err := publisher.Close(); err != nil {
-			logger.Errorf("Failed to close RabbitMQ publisher", "error", err)
-		} else {
-			logger.Infof("Disconnected from RabbitMQ")
-		}
-	}(publisher)
 
 	pasteConsumer, err := eventbus.NewRabbitMQConsumer(rabbitConn,
-		mongoClient.Database(cfg.MongoDBName), pasteCache, logger)
+		pasteRepo, pasteCache, negativeCache, rabbitmq.RetryPolicy{
+			MaxAttempts: cfg.RetryMaxAttempts,
+			BaseDelay:   cfg.RetryBaseDelay,
+			MaxDelay:    cfg.RetryMaxDelay,
+		}, events.Decoder{AcceptBareJSON: cfg.EventsAcceptBareJSON}, dedupStore, logger)
 	if err != nil {
-		logger.Fatalf("Failed to create RabbitMQ consumer", "error", err)
+		logger.Fatal("Failed to create RabbitMQ consumer", zap.Error(err))
 	}
 
 	// Start consuming messages
 	if err := pasteConsumer.Start(); err != nil {
-		logger.Fatalf("Failed to start RabbitMQ consumer", "error", err)
+		logger.Fatal("Failed to start RabbitMQ consumer", zap.Error(err))
+	}
+
+	// Nhận invalidation từ các replica khác cho cache trong tiến trình
+	listenCtx, stopListening := context.WithCancel(context.Background())
+	listening := make(chan struct{})
+	go func() {
+		defer close(listening)
+		pasteCache.Listen(listenCtx)
+	}()
+
+	dlqAdmin, err := dlq.NewAdmin(rabbitConn, pasteConsumer.QueueName())
+	if err != nil {
+		logger.Fatal("Failed to create dead-letter admin", zap.Error(err))
 	}
-	defer func(pasteConsumer *eventbus.RabbitMQConsumer) {
-		if err := pasteConsumer.Stop(); err != nil {
-			logger.Errorf("Failed to stop RabbitMQ consumer", "error", err)
-		}
-	}(pasteConsumer)
 
 	// Initialize service and handler
-	retrieveService := paste.NewRetrieveService(pasteRepo, pasteCache, publisher, logger)
-	handler := handlers.NewPasteHandler(retrieveService, logger)
+	retrieveService := paste.NewRetrieveService(pasteRepo, pasteCache, negativeCache,
+		cache.NewRedisRevealTokens(redisClient, cfg.RevealTokenTTL), publisher, requestLogger)
+	handler := handlers.NewPasteHandler(retrieveService, requestLogger)
+
+	spec, err := openapi.ForService(openapi.ServiceRetrieval)
+	if err != nil {
+		logger.Fatal("Failed to load OpenAPI spec", zap.Error(err))
+	}
+	validate, err := openapi.Middleware(spec)
+	if err != nil {
+		logger.Fatal("Failed to create request validator", zap.Error(err))
+	}
+
+	readyChecks := map[string]health.Check{
+		"mongodb": health.Mongo(mongoClient),
+		"redis": func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		},
+		"rabbitmq": rabbitConn.Check,
+	}
+	if mysqlDB != nil {
+		readyChecks["mysql"] = mysqlDB.PingContext
+	}
+	probe := health.NewProbe(readyChecks)
 
 	// Set up router
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware("retrieval-service"))
+	r.Use(requestid.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Get("/api/pastes/{url}/content", handler.GetPasteContent)
-	r.Get("/api/pastes/{url}/policy", handler.GetPastePolicy)
-	r.Handle("/metrics", promhttp.Handler())
+	r.Group(func(r chi.Router) {
+		r.Use(validate)
+		r.Get("/openapi.json", openapi.Handler(spec))
+		r.Get("/api/pastes/{url}/content", handler.GetPasteContent)
+		r.Get("/api/pastes/{url}/policy", handler.GetPastePolicy)
+		r.With(handlers.Compress).Get("/api/pastes/{url}/raw", handler.GetPasteRaw)
+		r.With(handlers.Compress).Get("/api/pastes/{url}/html", handler.GetPasteHTML)
+		r.With(handlers.Compress).Post("/api/pastes/{url}/html", handler.RevealPasteHTML)
+		r.Post("/api/pastes/{url}/reveal", handler.RevealPaste)
+		r.Handle("/metrics", promhttp.Handler())
+		r.Get("/healthz", health.LiveHandler())
+		r.Get("/readyz", probe.ReadyHandler())
+	})
+	// The admin API; callers are authenticated before their request is
+	// validated so anonymous callers learn nothing about it
+	r.Group(func(r chi.Router) {
+		r.Use(authenticator.Middleware("retrieval-service", auditLogger))
+		r.Use(validate)
+		r.Handle("/admin/log-level", logging.LevelHandler(logLevel))
+		r.Get("/admin/config", cfgStore.Handler())
+		r.Post("/admin/config/reload", cfgStore.ReloadHandler())
+		r.Mount("/admin/dlq", dlq.NewRouter(dlqAdmin))
+		if rebuildJob != nil {
+			r.Mount("/admin/rebuild", rebuild.NewRouter(rebuildJob))
+		}
+	})
 
 	// Start server
 	server := &http.Server{
@@ -128,22 +262,40 @@ func main() {
 	}
 
 	go func() {
-		logger.Infof("Starting server on :%s", cfg.Port)
+		logger.Info("Starting server", zap.String("port", cfg.Port))
 		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Fatalf("Server failed", "error", err)
+			logger.Fatal("Server failed", zap.Error(err))
 		}
 	}()
 
-	// Graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
-
-	logger.Infof("Shutting down server...")
-	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	// Graceful shutdown: leave the load balancer, finish the events and
+	// requests in flight, then disconnect
+	sig := lifecycle.WaitForSignal()
+	logger.Info("Shutting down", zap.Stringer("signal", sig))
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Errorf("Server shutdown failed", "error", err)
+	steps := []lifecycle.Step{
+		lifecycle.Drain(probe, cfg.ShutdownDelay),
+		lifecycle.Close("consumer", pasteConsumer.Stop),
+		{Name: "http", Stop: server.Shutdown},
+		lifecycle.Close("dead-letter admin", dlqAdmin.Close),
+		lifecycle.Close("publisher", publisher.Close),
+		lifecycle.Close("cache invalidations", func() error {
+			stopListening()
+			<-listening
+			return nil
+		}),
+		{Name: "mongodb", Stop: mongoClient.Disconnect},
+		lifecycle.Close("redis", redisClient.Close),
+		lifecycle.Close("rabbitmq", rabbitConn.Close),
+	}
+	if mysqlDB != nil {
+		steps = append(steps, lifecycle.Close("mysql", mysqlDB.Close))
+	}
+	steps = append(steps, lifecycle.Close("audit log", closeAuditLog))
+	if err := lifecycle.Shutdown(ctx, logger, steps...); err != nil {
+		logger.Error("Shutdown did not complete", zap.Error(err))
+		return
 	}
-	logger.Infof("Server stopped")
+	logger.Info("Server stopped")
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+	"retrieval-service/internal/rebuild"
+)
+
+// runRebuild handles `retrieval-service rebuild [flags]`: it rebuilds the
+// read model from MySQL in the foreground and exits. SIGINT/SIGTERM stop it
+// after the current page; run again with -resume to continue.
+func runRebuild(job *rebuild.Job, args []string, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	pageSize := fs.Int("page-size", rebuild.DefaultPageSize, "pastes read from MySQL per page")
+	warmCache := fs.Bool("warm-cache", false, "also write every paste to Redis")
+	resume := fs.Bool("resume", false, "continue from the last checkpoint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := job.Run(ctx, rebuild.Options{PageSize: *pageSize, WarmCache: *warmCache, Resume: *resume})
+	if errors.Is(err, context.Canceled) {
+		logger.Info("Rebuild interrupted, rerun with -resume to continue")
+		return nil
+	}
+	return err
+}
+
+func openMySQL(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
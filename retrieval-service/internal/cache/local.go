@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"retrieval-service/internal/domain/paste"
+	"retrieval-service/internal/metrics"
+	"retrieval-service/shared"
+)
+
+// entryOverhead approximates the memory an entry takes besides its strings.
+const entryOverhead = 256
+
+// LocalPasteCache is an in-process LRU cache of pastes bounded by the
+// approximate memory its entries take. Entries also expire after a fixed
+// TTL, which bounds how stale a copy can get when an invalidation is missed.
+type LocalPasteCache struct {
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	bytes int64
+}
+
+type localEntry struct {
+	paste   paste.Paste
+	size    int64
+	expires time.Time
+}
+
+// NewLocalPasteCache creates a LocalPasteCache holding up to maxBytes of
+// pastes for at most ttl each. A zero maxBytes caches nothing.
+func NewLocalPasteCache(maxBytes int64, ttl time.Duration) *LocalPasteCache {
+	return &LocalPasteCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		lru:      list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (c *LocalPasteCache) Get(ctx context.Context, url string) (*paste.Paste, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[url]
+	if !ok {
+		return nil, nil
+	}
+	e := el.Value.(*localEntry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		c.report()
+		return nil, nil
+	}
+	c.lru.MoveToFront(el)
+	p := e.paste
+	return &p, nil
+}
+
+// Set caches a copy of p, evicting the least recently used pastes to make
+// room. Like RedisPasteCache it never caches burn-after-read pastes.
+func (c *LocalPasteCache) Set(ctx context.Context, p *paste.Paste) error {
+	if p.ExpirationPolicy.Type == paste.BurnAfterReadExpiration {
+		return nil
+	}
+	size := int64(len(p.URL)+len(p.Content)+len(p.ExpirationPolicy.Duration)) + entryOverhead
+	if size > c.maxBytes {
+		return nil
+	}
+	expires := c.now().Add(c.ttl)
+	if p.ExpirationPolicy.Type == paste.TimedExpiration {
+		if duration, ok := shared.DurationMap[p.ExpirationPolicy.Duration]; ok {
+			if at := p.CreatedAt.Add(duration); at.Before(expires) {
+				expires = at
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[p.URL]; ok {
+		c.remove(el)
+	}
+	c.items[p.URL] = c.lru.PushFront(&localEntry{paste: *p, size: size, expires: expires})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+	c.report()
+	return nil
+}
+
+func (c *LocalPasteCache) Delete(ctx context.Context, url string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[url]; ok {
+		c.remove(el)
+		c.report()
+	}
+	return nil
+}
+
+// Clear drops every entry.
+func (c *LocalPasteCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = map[string]*list.Element{}
+	c.bytes = 0
+	c.report()
+}
+
+func (c *LocalPasteCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*localEntry)
+	delete(c.items, e.paste.URL)
+	c.bytes -= e.size
+}
+
+func (c *LocalPasteCache) report() {
+	metrics.LocalCacheBytes.Set(float64(c.bytes))
+	metrics.LocalCacheEntries.Set(float64(len(c.items)))
+}
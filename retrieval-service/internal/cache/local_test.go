@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"retrieval-service/internal/domain/paste"
+)
+
+func TestLocalPasteCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("x", 1000)
+	c := NewLocalPasteCache(3*(1000+entryOverhead+1), time.Minute)
+	for _, url := range []string{"a", "b", "c"} {
+		_ = c.Set(ctx, &paste.Paste{URL: url, Content: content, ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpiration}})
+	}
+	if p, _ := c.Get(ctx, "a"); p == nil {
+		t.Fatal("a was not cached")
+	}
+	_ = c.Set(ctx, &paste.Paste{URL: "d", Content: content, ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpiration}})
+
+	for url, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if p, _ := c.Get(ctx, url); (p != nil) != want {
+			t.Errorf("%s cached = %v, want %v", url, p != nil, want)
+		}
+	}
+	if c.bytes > c.maxBytes {
+		t.Errorf("holds %d bytes, limit %d", c.bytes, c.maxBytes)
+	}
+}
+
+func TestLocalPasteCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLocalPasteCache(1<<20, time.Hour)
+	c.now = func() time.Time { return now }
+
+	_ = c.Set(ctx, &paste.Paste{URL: "timed", Content: "x", CreatedAt: now.Add(-5 * time.Minute),
+		ExpirationPolicy: paste.ExpirationPolicy{Type: paste.TimedExpiration, Duration: "10minutes"}})
+	_ = c.Set(ctx, &paste.Paste{URL: "never", Content: "x", ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpiration}})
+	_ = c.Set(ctx, &paste.Paste{URL: "burn", Content: "x", ExpirationPolicy: paste.ExpirationPolicy{Type: paste.BurnAfterReadExpiration}})
+
+	if p, _ := c.Get(ctx, "burn"); p != nil {
+		t.Error("burn-after-read paste was cached")
+	}
+	now = now.Add(6 * time.Minute)
+	if p, _ := c.Get(ctx, "timed"); p != nil {
+		t.Error("timed paste served after it expired")
+	}
+	if p, _ := c.Get(ctx, "never"); p == nil {
+		t.Error("paste evicted before the cache TTL")
+	}
+	now = now.Add(time.Hour)
+	if p, _ := c.Get(ctx, "never"); p != nil {
+		t.Error("paste served after the cache TTL")
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NegativeCache remembers URLs that have no paste, so that repeated lookups
+// of unknown URLs, such as enumeration scans, do not reach MongoDB.
+type NegativeCache interface {
+	Missing(ctx context.Context, url string) (bool, error)
+	SetMissing(ctx context.Context, url string) error
+	// Clear forgets url, once a paste has been created under it
+	Clear(ctx context.Context, url string) error
+}
+
+// RedisNegativeCache implements NegativeCache with short-lived Redis keys,
+// shared by all replicas.
+type RedisNegativeCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisNegativeCache creates a RedisNegativeCache whose entries expire
+// after ttl. A zero ttl disables it.
+func NewRedisNegativeCache(client *redis.Client, ttl time.Duration) *RedisNegativeCache {
+	return &RedisNegativeCache{client: client, ttl: ttl}
+}
+
+func (c *RedisNegativeCache) Missing(ctx context.Context, url string) (bool, error) {
+	if c.ttl <= 0 {
+		return false, nil
+	}
+	n, err := c.client.Exists(ctx, "paste-missing:"+url).Result()
+	return n > 0, err
+}
+
+func (c *RedisNegativeCache) SetMissing(ctx context.Context, url string) error {
+	if c.ttl <= 0 {
+		return nil
+	}
+	return c.client.Set(ctx, "paste-missing:"+url, 1, c.ttl).Err()
+}
+
+func (c *RedisNegativeCache) Clear(ctx context.Context, url string) error {
+	return c.client.Del(ctx, "paste-missing:"+url).Err()
+}
@@ -6,15 +6,16 @@ import (
 	"errors"
 	"time"
 
+	"github.com/go-redis/redis/extra/redisotel/v8"
 	"github.com/go-redis/redis/v8"
 	"retrieval-service/internal/domain/paste"
 	"retrieval-service/shared"
 )
 
 type PasteCache interface {
-	Get(url string) (*paste.Paste, error)
-	Set(p *paste.Paste) error
-	Delete(url string) error
+	Get(ctx context.Context, url string) (*paste.Paste, error)
+	Set(ctx context.Context, p *paste.Paste) error
+	Delete(ctx context.Context, url string) error
 }
 
 // RedisPasteCache implements PasteCache with Redis
@@ -34,12 +35,12 @@ func NewRedisClient(uri string) (*redis.Client, error) {
 		return nil, err
 	}
 	client := redis.NewClient(opt)
+	client.AddHook(redisotel.NewTracingHook())
 	_, err = client.Ping(context.Background()).Result()
 	return client, err
 }
 
-func (c *RedisPasteCache) Get(url string) (*paste.Paste, error) {
-	ctx := context.Background()
+func (c *RedisPasteCache) Get(ctx context.Context, url string) (*paste.Paste, error) {
 	val, err := c.client.Get(ctx, "paste:"+url).Result()
 	if errors.Is(err, redis.Nil) {
 		return nil, nil // Cache miss
@@ -52,11 +53,20 @@ func (c *RedisPasteCache) Get(url string) (*paste.Paste, error) {
 	if err := json.Unmarshal([]byte(val), &p); err != nil {
 		return nil, err
 	}
+	if p.ExpirationPolicy.Type == paste.BurnAfterReadExpiration {
+		// Written before burn pastes were kept out of the cache
+		return nil, c.Delete(ctx, url)
+	}
 	return &p, nil
 }
 
-func (c *RedisPasteCache) Set(p *paste.Paste) error {
-	ctx := context.Background()
+// Set caches p. Burn-after-read pastes are never cached: a cached copy
+// would outlive the one read they allow. Neither are timed pastes that
+// have already expired.
+func (c *RedisPasteCache) Set(ctx context.Context, p *paste.Paste) error {
+	if p.ExpirationPolicy.Type == paste.BurnAfterReadExpiration {
+		return nil
+	}
 	data, err := json.Marshal(p)
 	if err != nil {
 		return err
@@ -66,16 +76,16 @@ func (c *RedisPasteCache) Set(p *paste.Paste) error {
 	if p.ExpirationPolicy.Type == paste.TimedExpiration {
 		if duration, ok := shared.DurationMap[p.ExpirationPolicy.Duration]; ok {
 			remaining := duration - time.Since(p.CreatedAt)
-			if remaining > 0 {
-				ttl = remaining
+			if remaining <= 0 {
+				return nil
 			}
+			ttl = remaining
 		}
 	}
 
 	return c.client.Set(ctx, "paste:"+p.URL, data, ttl).Err()
 }
 
-func (c *RedisPasteCache) Delete(url string) error {
-	ctx := context.Background()
+func (c *RedisPasteCache) Delete(ctx context.Context, url string) error {
 	return c.client.Del(ctx, "paste:"+url).Err()
 }
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RevealTokens issues and redeems the one-time tokens that reveal a
+// burn-after-read paste.
+type RevealTokens interface {
+	// Issue returns a new token for url
+	Issue(ctx context.Context, url string) (string, error)
+	// Redeem reports whether token was issued for url and not yet redeemed.
+	// A token can only be redeemed once, whatever the result.
+	Redeem(ctx context.Context, url, token string) (bool, error)
+}
+
+// RedisRevealTokens keeps reveal tokens in Redis, so that any replica can
+// redeem a token another one issued.
+type RedisRevealTokens struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisRevealTokens creates a RedisRevealTokens whose tokens expire
+// after ttl.
+func NewRedisRevealTokens(client *redis.Client, ttl time.Duration) *RedisRevealTokens {
+	return &RedisRevealTokens{client: client, ttl: ttl}
+}
+
+func (t *RedisRevealTokens) Issue(ctx context.Context, url string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := t.client.Set(ctx, "reveal:"+token, url, t.ttl).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (t *RedisRevealTokens) Redeem(ctx context.Context, url, token string) (bool, error) {
+	issuedFor, err := t.client.GetDel(ctx, "reveal:"+token).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return issuedFor == url, nil
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"retrieval-service/internal/domain/paste"
+	"retrieval-service/internal/metrics"
+)
+
+// InvalidationChannel is the Redis pub/sub channel on which every change to
+// a cached paste is announced, so that each replica drops its local copy.
+// Messages are "<origin> <url>"; pastebinctl publishes with origin "ctl".
+const InvalidationChannel = "paste:invalidate"
+
+// TieredPasteCache puts a LocalPasteCache in front of another PasteCache,
+// normally Redis. Writes and deletes go to both tiers and are announced on
+// InvalidationChannel; Listen applies the announcements of other replicas.
+type TieredPasteCache struct {
+	local  *LocalPasteCache
+	remote PasteCache
+	client *redis.Client
+	origin string
+	logger *zap.Logger
+}
+
+// NewTieredPasteCache creates a TieredPasteCache publishing invalidations
+// through client.
+func NewTieredPasteCache(local *LocalPasteCache, remote PasteCache, client *redis.Client, logger *zap.Logger) *TieredPasteCache {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &TieredPasteCache{
+		local:  local,
+		remote: remote,
+		client: client,
+		origin: hex.EncodeToString(b),
+		logger: logger,
+	}
+}
+
+func (c *TieredPasteCache) Get(ctx context.Context, url string) (*paste.Paste, error) {
+	if p, _ := c.local.Get(ctx, url); p != nil {
+		metrics.CacheRequests.WithLabelValues("local", "hit").Inc()
+		return p, nil
+	}
+	metrics.CacheRequests.WithLabelValues("local", "miss").Inc()
+
+	p, err := c.remote.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		metrics.CacheRequests.WithLabelValues("redis", "miss").Inc()
+		return nil, nil
+	}
+	metrics.CacheRequests.WithLabelValues("redis", "hit").Inc()
+	_ = c.local.Set(ctx, p)
+	return p, nil
+}
+
+// Set writes p to both tiers. Other replicas drop their copy, since p may
+// be an update of it.
+func (c *TieredPasteCache) Set(ctx context.Context, p *paste.Paste) error {
+	if err := c.remote.Set(ctx, p); err != nil {
+		return err
+	}
+	_ = c.local.Set(ctx, p)
+	c.publish(ctx, p.URL)
+	return nil
+}
+
+func (c *TieredPasteCache) Delete(ctx context.Context, url string) error {
+	_ = c.local.Delete(ctx, url)
+	err := c.remote.Delete(ctx, url)
+	c.publish(ctx, url)
+	return err
+}
+
+func (c *TieredPasteCache) publish(ctx context.Context, url string) {
+	if err := c.client.Publish(ctx, InvalidationChannel, c.origin+" "+url).Err(); err != nil {
+		c.logger.Error("Failed to publish cache invalidation", logging.URL(url), zap.Error(err))
+	}
+}
+
+// Listen applies invalidations published by other replicas until ctx is
+// done. The local tier is cleared every time the subscription is
+// (re)established, as invalidations sent while it was down are lost.
+func (c *TieredPasteCache) Listen(ctx context.Context) {
+	sub := c.client.Subscribe(ctx, InvalidationChannel)
+	defer sub.Close()
+
+	ch := sub.ChannelWithSubscriptions(ctx, 100)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch msg := msg.(type) {
+			case *redis.Subscription:
+				if msg.Kind == "subscribe" {
+					c.local.Clear()
+					c.logger.Info("Subscribed to cache invalidations")
+				}
+			case *redis.Message:
+				origin, url, _ := strings.Cut(msg.Payload, " ")
+				if origin == c.origin {
+					continue
+				}
+				_ = c.local.Delete(ctx, url)
+				metrics.CacheInvalidations.Inc()
+			}
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package paste
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type ViewedEvent struct {
 	URL      string    `json:"url"`
@@ -12,7 +15,7 @@ type BurnAfterReadPasteViewedEvent struct {
 }
 
 type EventPublisher interface {
-	PublishPasteViewedEvent(event ViewedEvent) error
-	PublishBurnAfterReadPasteViewedEvent(event BurnAfterReadPasteViewedEvent) error
+	PublishPasteViewedEvent(ctx context.Context, event ViewedEvent) error
+	PublishBurnAfterReadPasteViewedEvent(ctx context.Context, event BurnAfterReadPasteViewedEvent) error
 	Close() error
 }
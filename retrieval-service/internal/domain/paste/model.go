@@ -23,10 +23,33 @@ type ExpirationPolicy struct {
 	IsRead   bool                 `json:"is_read,omitempty" bson:"is_read,omitempty"`
 }
 
+// RetrievePasteResponse is a paste as returned by the JSON API. An unread
+// burn-after-read paste has no content until it is revealed with
+// RevealToken.
 type RetrievePasteResponse struct {
 	URL           string `json:"url"`
-	Content       string `json:"content"`
+	Content       string `json:"content,omitempty"`
 	RemainingTime string `json:"remaining_time"`
+	BurnAfterRead bool   `json:"burn_after_read,omitempty"`
+	RevealToken   string `json:"reveal_token,omitempty"`
+}
+
+// RawPaste is a paste as served in plain text by the raw endpoint. Content
+// is empty for burn-after-read pastes, which have to be revealed.
+type RawPaste struct {
+	Content       string
+	CreatedAt     time.Time
+	BurnAfterRead bool
+	// Expires is false for pastes without a deadline; TTL is only set when
+	// it is true
+	Expires bool
+	TTL     time.Duration
+}
+
+// RevealRequest is the body of a reveal: the token returned with the
+// paste's metadata.
+type RevealRequest struct {
+	Token string `json:"token"`
 }
 
 type RetrievePolicyResponse struct {
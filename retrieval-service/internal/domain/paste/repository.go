@@ -1,6 +1,11 @@
 package paste
 
+import "context"
+
 type Repository interface {
-	FindByURL(url string) (*Paste, error)
-	MarkAsRead(url string) error
+	FindByURL(ctx context.Context, url string) (*Paste, error)
+	// ClaimBurnAfterRead atomically marks an unread burn-after-read paste as
+	// read and returns it; nil means another reader got there first
+	ClaimBurnAfterRead(ctx context.Context, url string) (*Paste, error)
+	Upsert(ctx context.Context, p *Paste) error
 }
@@ -2,72 +2,84 @@ package eventbus
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"retrieval-service/internal/cache"
 	"retrieval-service/internal/domain/paste"
 	"retrieval-service/internal/metrics"
-	"retrieval-service/shared"
 	"time"
 
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/ArsiHien/pastebin-ms/pkg/dedup"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
 )
 
-type PasteMessage struct {
-	ID         string    `json:"id"`
-	URL        string    `json:"url"`
-	Content    string    `json:"content"`
-	CreatedAt  time.Time `json:"created_at"`
-	PolicyType string    `json:"policy_type"`
-	Duration   string    `json:"duration"`
-}
+const pasteCreationQueue = "paste_creation_queue"
 
 type RabbitMQConsumer struct {
-	channel     *amqp.Channel
-	collection  *mongo.Collection
-	cache       cache.PasteCache
-	logger      *shared.Logger
-	consumerTag string
+	consumer *rabbitmq.Consumer
+	retrier  *rabbitmq.Retrier
+	retry    rabbitmq.RetryPolicy
+	decoder  events.Decoder
+	dedup    *dedup.Store
+	repo     paste.Repository
+	cache    cache.PasteCache
+	negative cache.NegativeCache
+	logger   *zap.Logger
+	done     chan struct{}
 }
 
-func NewRabbitMQConsumer(conn *amqp.Connection, db *mongo.Database, cache cache.PasteCache, logger *shared.Logger) (*RabbitMQConsumer, error) {
-	ch, err := conn.Channel()
+func NewRabbitMQConsumer(conn *rabbitmq.Connection, repo paste.Repository, cache cache.PasteCache,
+	negative cache.NegativeCache, retry rabbitmq.RetryPolicy, decoder events.Decoder, dedup *dedup.Store,
+	logger *zap.Logger) (*RabbitMQConsumer, error) {
+	retrier, err := rabbitmq.NewRetrier(conn, pasteCreationQueue, retry)
 	if err != nil {
-		logger.Errorf("Failed to open RabbitMQ channel", "error", err.Error())
+		logger.Error("Failed to create retrier", zap.Error(err))
 		return nil, err
 	}
 
-	err = ch.ExchangeDeclare(
-		"pastebin_events",
-		"topic",
-		true,  // Durable
-		false, // Auto-deleted
-		false, // Internal
-		false, // No-wait
-		nil,   // Arguments
-	)
-	if err != nil {
-		if closeErr := ch.Close(); closeErr != nil {
-			logger.Errorf("Failed to close channel after exchange declare error", "error", closeErr.Error())
-		}
-		logger.Errorf("Failed to declare exchange", "error", err.Error())
-		return nil, err
+	c := &RabbitMQConsumer{
+		retrier:  retrier,
+		retry:    retry,
+		decoder:  decoder,
+		dedup:    dedup,
+		repo:     repo,
+		cache:    cache,
+		negative: negative,
+		logger:   logger,
+		done:     make(chan struct{}),
 	}
+	c.consumer = conn.NewConsumer(rabbitmq.ConsumerOptions{
+		Queue: pasteCreationQueue,
+		Tag:   "paste-creation-consumer",
+		Setup: c.declare,
+		OnError: func(err error) {
+			logger.Error("Failed to subscribe to queue", zap.String("queue", pasteCreationQueue), zap.Error(err))
+		},
+	})
+	return c, nil
+}
 
-	collection := db.Collection("pastes")
-
-	return &RabbitMQConsumer{
-		channel:     ch,
-		collection:  collection,
-		cache:       cache,
-		logger:      logger,
-		consumerTag: "paste-creation-consumer",
-	}, nil
+// QueueName returns the queue this consumer reads from.
+func (c *RabbitMQConsumer) QueueName() string {
+	return pasteCreationQueue
 }
 
-func (c *RabbitMQConsumer) Start() error {
-	q, err := c.channel.QueueDeclare(
-		"paste_creation_queue",
+// declare sets up the exchange, queue, binding and the retry and dead-letter
+// queues. It runs again every time the channel is reopened after a reconnect.
+func (c *RabbitMQConsumer) declare(ch *amqp.Channel) error {
+	if err := events.DeclareExchange(ch); err != nil {
+		return err
+	}
+	if err := rabbitmq.DeclareRetryTopology(ch, pasteCreationQueue, c.retry); err != nil {
+		return err
+	}
+
+	q, err := ch.QueueDeclare(
+		pasteCreationQueue,
 		true,  // Durable
 		false, // Auto-deleted
 		false, // Exclusive
@@ -75,139 +87,173 @@ func (c *RabbitMQConsumer) Start() error {
 		nil,   // Arguments
 	)
 	if err != nil {
-		c.logger.Errorf("Failed to declare queue", "error", err.Error())
 		return err
 	}
 
-	err = c.channel.QueueBind(
+	return ch.QueueBind(
 		q.Name,
-		"paste.created",
-		"pastebin_events",
+		events.RoutingKeyPasteCreated,
+		events.Exchange,
 		false,
 		nil,
 	)
-	if err != nil {
-		c.logger.Errorf("Failed to bind queue", "error", err.Error())
-		return err
-	}
-
-	msgs, err := c.channel.Consume(
-		q.Name,
-		c.consumerTag,
-		false, // Auto-ack
-		false, // Exclusive
-		false, // No-local
-		false, // No-wait
-		nil,   // Args
-	)
-	if err != nil {
-		c.logger.Errorf("Failed to start consuming messages", "error", err.Error())
-		return err
-	}
+}
 
+func (c *RabbitMQConsumer) Start() error {
 	go func() {
-		for d := range msgs {
-			c.handleMessage(d)
+		defer close(c.done)
+		err := c.consumer.Run(context.Background(), func(msgs <-chan amqp.Delivery) {
+			c.logger.Info("Started consuming messages from queue", zap.String("queue", pasteCreationQueue))
+			for d := range msgs {
+				c.handleMessage(d)
+			}
+			c.logger.Info("Stopped consuming messages due to channel close")
+		})
+		if err != nil {
+			c.logger.Error("RabbitMQ consumer exited", zap.Error(err))
 		}
-		c.logger.Infof("Stopped consuming messages due to channel close")
 	}()
 
-	c.logger.Infof("Started consuming messages from queue", "queue", q.Name)
 	return nil
 }
 
 func (c *RabbitMQConsumer) handleMessage(delivery amqp.Delivery) {
-	logger := c.logger.With("messageID", delivery.MessageId)
+	logger := c.logger.With(zap.String("messageID", delivery.MessageId),
+		logging.RequestID(rabbitmq.RequestID(delivery)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Span nối tiếp trace của request tạo paste bên create-service
+	ctx, span := rabbitmq.StartConsumeSpan(ctx, pasteCreationQueue, delivery)
+	defer span.End()
 
 	// Giai đoạn 1: Xử lý message
-	logger.Infof("Received message", "body", string(delivery.Body))
+	logger.Debug("Received message", zap.ByteString("body", delivery.Body))
 
-	var message PasteMessage
-	if err := json.Unmarshal(delivery.Body, &message); err != nil {
-		logger.Errorf("Failed to unmarshal paste message", "error", err.Error(), "body", string(delivery.Body))
-		if nackErr := delivery.Nack(false, false); nackErr != nil {
-			logger.Errorf("Failed to nack message", "error", nackErr.Error())
+	var message v1.PasteCreated
+	env, err := c.decoder.Decode(delivery, &message)
+	if err != nil {
+		logger.Error("Failed to unmarshal paste message", zap.Error(err),
+			zap.ByteString("body", delivery.Body))
+		if dlErr := c.retrier.DeadLetter(ctx, delivery, err); dlErr != nil {
+			logger.Error("Failed to dead-letter message", zap.Error(dlErr))
 		}
 		return
 	}
-	logger.Infof("Parsed paste created event", "url", message.URL)
-
-	// Convert message to paste domain model
-	expPolicy := paste.ExpirationPolicy{
-		Type: paste.ExpirationPolicyType(message.PolicyType),
-	}
+	logger.Info("Parsed paste created event", logging.URL(message.URL))
 
-	if message.PolicyType == string(paste.TimedExpiration) {
-		expPolicy.Duration = message.Duration
-	} else if message.PolicyType == string(paste.BurnAfterReadExpiration) {
-		expPolicy.IsRead = false
+	// Bỏ qua message đã xử lý (giao lại do at-least-once)
+	if env.ID != "" {
+		seen, err := c.dedup.Seen(ctx, env.ID)
+		if err != nil {
+			logger.Error("Failed to check processed messages", zap.Error(err))
+			if retryErr := c.retrier.Retry(ctx, delivery, err); retryErr != nil {
+				logger.Error("Failed to schedule retry", zap.Error(retryErr))
+			}
+			return
+		}
+		if seen {
+			logger.Info("Skipping duplicate message", zap.String("eventID", env.ID))
+			metrics.DuplicateMessages.WithLabelValues(pasteCreationQueue).Inc()
+			if err := delivery.Ack(false); err != nil {
+				logger.Error("Failed to acknowledge message", zap.Error(err))
+			}
+			return
+		}
 	}
 
-	newPaste := paste.Paste{
-		URL:              message.URL,
-		Content:          message.Content,
-		CreatedAt:        message.CreatedAt,
-		ExpirationPolicy: expPolicy,
-	}
+	// Convert message to paste domain model
+	newPaste := PasteFromEvent(message)
 
 	// Giai đoạn 2: Lưu paste vào MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	// Kiểm tra dữ liệu trước khi lưu
 	if newPaste.URL == "" || newPaste.Content == "" {
-		logger.Errorf("Invalid paste data", "paste", newPaste)
-		if nackErr := delivery.Nack(false, false); nackErr != nil {
-			logger.Errorf("Failed to nack message", "error", nackErr.Error())
+		logger.Error("Invalid paste data", zap.Any("paste", newPaste))
+		if dlErr := c.retrier.DeadLetter(ctx, delivery, errors.New("paste url and content are required")); dlErr != nil {
+			logger.Error("Failed to dead-letter message", zap.Error(dlErr))
 		}
 		return
 	}
 
 	phaseStart := time.Now()
-	_, err := c.collection.InsertOne(ctx, newPaste)
-	if err != nil {
-		logger.Errorf("Failed to save paste to database", "error", err.Error(), "paste", newPaste)
-		if nackErr := delivery.Nack(false, true); nackErr != nil {
-			logger.Errorf("Failed to nack message", "error", nackErr.Error())
+	// Upsert theo URL để message giao lại không gây lỗi duplicate key
+	if err := c.repo.Upsert(ctx, &newPaste); err != nil {
+		logger.Error("Failed to save paste to database", zap.Error(err), logging.URL(newPaste.URL))
+		if retryErr := c.retrier.Retry(ctx, delivery, err); retryErr != nil {
+			logger.Error("Failed to schedule retry", zap.Error(retryErr))
 		}
 		return
 	}
-	logger.Infof("Successfully saved paste to database", "url", newPaste.URL)
+	logger.Info("Successfully saved paste to database", logging.URL(newPaste.URL))
 	metrics.PasteProcessingDuration.WithLabelValues("mongo_save").Observe(time.Since(phaseStart).Seconds())
 
+	// URL có thể đã bị đánh dấu không tồn tại khi được đọc trước lúc paste tới
+	if err := c.negative.Clear(ctx, newPaste.URL); err != nil {
+		// Mục negative cache tự hết hạn sau NEGATIVE_CACHE_TTL
+		logger.Error("Failed to clear negative cache entry", zap.Error(err), logging.URL(newPaste.URL))
+	}
+
 	// Giai đoạn 3: Lưu paste vào Redis cache
+	// Paste burn-after-read không bao giờ được cache, chỉ đọc từ MongoDB
 	phaseStart = time.Now()
-	if err := c.cache.Set(&newPaste); err != nil {
-		logger.Errorf("Failed to save paste to Redis cache", "error", err.Error(), "url", newPaste.URL)
-		// Không nack vì MongoDB đã lưu thành công
-	} else {
-		logger.Infof("Successfully saved paste to Redis cache", "url", newPaste.URL)
+	if newPaste.ExpirationPolicy.Type != paste.BurnAfterReadExpiration {
+		if err := c.cache.Set(ctx, &newPaste); err != nil {
+			logger.Error("Failed to save paste to Redis cache", zap.Error(err), logging.URL(newPaste.URL))
+			// Không nack vì MongoDB đã lưu thành công
+		} else {
+			logger.Info("Successfully saved paste to Redis cache", logging.URL(newPaste.URL))
+		}
 	}
 	metrics.PasteProcessingDuration.WithLabelValues("cache_save").Observe(time.Since(phaseStart).Seconds())
 
 	if !newPaste.CreatedAt.IsZero() {
 		duration := time.Since(newPaste.CreatedAt).Seconds()
 		metrics.PasteProcessingDuration.WithLabelValues("total").Observe(duration)
-		logger.Infof("Latency from CreatedAt to processing complete", "durationSeconds", duration)
+		logger.Info("Latency from CreatedAt to processing complete", zap.Float64("durationSeconds", duration))
+	}
+
+	if env.ID != "" {
+		if err := c.dedup.MarkProcessed(ctx, env.ID); err != nil {
+			logger.Error("Failed to record processed message", zap.Error(err))
+		}
 	}
 
 	// Ack message
 	if err := delivery.Ack(false); err != nil {
-		logger.Errorf("Failed to acknowledge message", "error", err.Error())
+		logger.Error("Failed to acknowledge message", zap.Error(err))
+	}
+}
+
+// PasteFromEvent maps a paste.created event onto the read model. The rebuild
+// job uses it too, so both paths store pastes identically.
+func PasteFromEvent(message v1.PasteCreated) paste.Paste {
+	expPolicy := paste.ExpirationPolicy{
+		Type: paste.ExpirationPolicyType(message.PolicyType),
+	}
+
+	if message.PolicyType == v1.PolicyTimed {
+		expPolicy.Duration = message.Duration
+	} else if message.PolicyType == v1.PolicyBurnAfterRead {
+		expPolicy.IsRead = false
+	}
+
+	return paste.Paste{
+		URL:              message.URL,
+		Content:          message.Content,
+		CreatedAt:        message.CreatedAt,
+		ExpirationPolicy: expPolicy,
 	}
 }
 
 func (c *RabbitMQConsumer) Stop() error {
-	if c.channel != nil {
-		if err := c.channel.Cancel(c.consumerTag, false); err != nil {
-			c.logger.Errorf("Failed to cancel consumer", "error", err.Error())
-			return err
-		}
-		if err := c.channel.Close(); err != nil {
-			c.logger.Errorf("Failed to close RabbitMQ channel", "error", err.Error())
-			return err
-		}
+	if err := c.consumer.Stop(); err != nil {
+		c.logger.Error("Failed to cancel consumer", zap.Error(err))
+		return err
+	}
+	<-c.done
+	if err := c.retrier.Close(); err != nil {
+		c.logger.Error("Failed to close retry publisher", zap.Error(err))
 	}
-	c.logger.Infof("Stopped RabbitMQ consumer")
+	c.logger.Info("Stopped RabbitMQ consumer")
 	return nil
 }
@@ -1,76 +1,68 @@
 package eventbus
 
 import (
-	"encoding/json"
+	"context"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
 	"retrieval-service/internal/domain/paste"
 )
 
+// eventSource is the CloudEvents source of events published by this service.
+const eventSource = "/retrieval-service"
+
 type RabbitMQPublisher struct {
-	channel *amqp.Channel
+	publisher *rabbitmq.Publisher
+	encoder   events.Encoder
 }
 
-func NewRabbitMQPublisher(conn *amqp.Connection) (*RabbitMQPublisher, error) {
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, err
-	}
-
-	err = ch.ExchangeDeclare(
-		"pastebin_events",
-		"topic",
-		true,
-		false,
-		false,
-		false,
-		nil,
+// NewRabbitMQPublisher creates a publisher encoding events with contentType,
+// either application/json or application/protobuf.
+func NewRabbitMQPublisher(conn *rabbitmq.Connection, confirmTimeout time.Duration,
+	contentType string, logger *zap.Logger) (*RabbitMQPublisher, error) {
+	publisher, err := rabbitmq.NewPublisher(conn, events.Exchange,
+		rabbitmq.WithConfirmTimeout(confirmTimeout),
+		rabbitmq.WithReturnHandler(func(ret amqp.Return) {
+			logger.Error("Message returned by broker", logging.RoutingKey(ret.RoutingKey),
+				zap.Uint16("replyCode", ret.ReplyCode), zap.String("replyText", ret.ReplyText))
+		}),
 	)
 	if err != nil {
-		err := ch.Close()
-		if err != nil {
-			return nil, err
-		}
 		return nil, err
 	}
-
-	return &RabbitMQPublisher{channel: ch}, nil
+	return &RabbitMQPublisher{
+		publisher: publisher,
+		encoder:   events.Encoder{Source: eventSource, ContentType: contentType},
+	}, nil
 }
 
-func (p *RabbitMQPublisher) PublishPasteViewedEvent(event paste.ViewedEvent) error {
-	body, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
-	return p.channel.Publish(
-		"pastebin_events",
-		"paste.viewed",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+func (p *RabbitMQPublisher) PublishPasteViewedEvent(ctx context.Context, event paste.ViewedEvent) error {
+	return p.publish(ctx, v1.PasteViewed{URL: event.URL, ViewedAt: event.ViewedAt})
 }
 
-func (p *RabbitMQPublisher) PublishBurnAfterReadPasteViewedEvent(
+func (p *RabbitMQPublisher) PublishBurnAfterReadPasteViewedEvent(ctx context.Context,
 	event paste.BurnAfterReadPasteViewedEvent) error {
-	body, err := json.Marshal(event)
+	return p.publish(ctx, v1.BurnAfterReadPasteViewed{URL: event.URL})
+}
+
+func (p *RabbitMQPublisher) publish(ctx context.Context, event events.Event) error {
+	msg, err := p.encode(event)
 	if err != nil {
 		return err
 	}
-	return p.channel.Publish(
-		"pastebin_events",
-		"paste.burn_after_read_paste_viewed",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	return p.publisher.Publish(ctx, event.RoutingKey(), msg)
+}
+
+// encode wraps event in a CloudEvent using the configured content type.
+func (p *RabbitMQPublisher) encode(event events.Event) (amqp.Publishing, error) {
+	return p.encoder.Encode(event)
 }
 
 func (p *RabbitMQPublisher) Close() error {
-	return p.channel.Close()
+	return p.publisher.Close()
 }
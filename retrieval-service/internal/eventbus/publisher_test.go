@@ -0,0 +1,36 @@
+package eventbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/events"
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+)
+
+// BenchmarkEncodePasteViewed measures the publisher-side cost of each
+// encoding for the event sent on every read. Run with:
+// go test -run=^$ -bench=. ./internal/eventbus
+func BenchmarkEncodePasteViewed(b *testing.B) {
+	event := v1.PasteViewed{URL: "aB3dE5gH", ViewedAt: time.Now()}
+
+	for name, contentType := range map[string]string{
+		"json":     events.ContentTypeJSON,
+		"protobuf": events.ContentTypeProtobuf,
+	} {
+		p := &RabbitMQPublisher{encoder: events.Encoder{Source: eventSource, ContentType: contentType}}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				msg, err := p.encode(event)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(msg.Body)
+			}
+			b.ReportMetric(float64(size), "bytes/msg")
+		})
+	}
+}
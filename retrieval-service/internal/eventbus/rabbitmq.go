@@ -1,7 +1,34 @@
 package eventbus
 
-import amqp "github.com/rabbitmq/amqp091-go"
+import (
+	"github.com/ArsiHien/pastebin-ms/events"
+	"github.com/ArsiHien/pastebin-ms/pkg/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"retrieval-service/internal/metrics"
+)
 
-func NewRabbitMQConn(uri string) (*amqp.Connection, error) {
-	return amqp.Dial(uri)
+// NewRabbitMQConn dials RabbitMQ and keeps the connection alive, re-declaring
+// the pastebin_events exchange after every reconnect.
+func NewRabbitMQConn(uri string, logger *zap.Logger) (*rabbitmq.Connection, error) {
+	reconnecting := false
+	return rabbitmq.Dial(uri,
+		rabbitmq.WithTopology(func(ch *amqp.Channel) error {
+			return events.DeclareExchange(ch)
+		}),
+		rabbitmq.WithStateHandler(func(connected bool, err error) {
+			if connected {
+				metrics.RabbitMQConnected.Set(1)
+				if reconnecting {
+					metrics.RabbitMQReconnects.Inc()
+					logger.Info("Reconnected to RabbitMQ")
+				}
+				reconnecting = false
+				return
+			}
+			metrics.RabbitMQConnected.Set(0)
+			reconnecting = true
+			logger.Error("RabbitMQ connection unavailable", zap.Error(err))
+		}),
+	)
 }
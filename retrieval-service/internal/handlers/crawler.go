@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// crawlerAgents are User-Agent substrings, lower case, of link unfurlers in
+// chat apps and of search engine crawlers. They fetch links on their own, so
+// they are never given a burn-after-read paste or a token to reveal one.
+// "bot" covers Slackbot, Discordbot, TelegramBot, Twitterbot, LinkedInBot,
+// Googlebot, bingbot and Applebot among others.
+var crawlerAgents = []string{
+	"bot", "crawler", "spider", "preview",
+	"facebookexternalhit", "facebookcatalog", "whatsapp", "slack-imgproxy",
+	"embedly", "iframely", "vkshare", "mattermost", "google-pagerenderer",
+}
+
+// isCrawler reports whether r comes from a known crawler or link unfurler.
+func isCrawler(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	for _, agent := range crawlerAgents {
+		if strings.Contains(ua, agent) {
+			return true
+		}
+	}
+	return false
+}
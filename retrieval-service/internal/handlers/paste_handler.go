@@ -1,24 +1,37 @@
 package handlers
 
 import (
-	"context"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
+	"go.uber.org/zap"
 	"net/http"
+	"retrieval-service/internal/domain/paste"
 	"retrieval-service/internal/metrics"
-	"retrieval-service/internal/service/paste"
+	"retrieval-service/internal/render"
+	pasteservice "retrieval-service/internal/service/paste"
 	"retrieval-service/shared"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// rawMaxAge caps how long clients and proxies may cache a raw paste, even
+// one that never expires, so that pastes removed by cleanup-service stop
+// being served within a day.
+const rawMaxAge = 24 * time.Hour
+
 type PasteHandler struct {
-	service *paste.RetrieveService
-	logger  *shared.Logger
+	service *pasteservice.RetrieveService
+	logger  *zap.Logger
 }
 
-func NewPasteHandler(service *paste.RetrieveService, logger *shared.Logger) *PasteHandler {
+func NewPasteHandler(service *pasteservice.RetrieveService, logger *zap.Logger) *PasteHandler {
 	return &PasteHandler{
 		service: service,
 		logger:  logger,
@@ -27,17 +40,16 @@ func NewPasteHandler(service *paste.RetrieveService, logger *shared.Logger) *Pas
 
 func (h *PasteHandler) GetPasteContent(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
-	requestID := uuid.New().String()
-	ctx := context.WithValue(r.Context(), "requestID", requestID)
+	ctx := r.Context()
 	url := chi.URLParam(r, "url")
-	logger := h.logger.With("requestID", requestID, "url", url)
+	logger := logging.FromContext(ctx, h.logger).With(logging.URL(url))
 
 	// Giai đoạn 1: Nhận yêu cầu
-	logger.Infof("Received get paste content request")
+	logger.Info("Received get paste content request")
 	metrics.RetrievalRequestDuration.WithLabelValues("receive_request").Observe(time.Since(startTime).Seconds())
 
 	if url == "" {
-		logger.Errorf("URL parameter is required")
+		logger.Warn("URL parameter is required")
 		h.writeError(w, http.StatusBadRequest, "URL parameter is required")
 		return
 	}
@@ -45,43 +57,45 @@ func (h *PasteHandler) GetPasteContent(w http.ResponseWriter, r *http.Request) {
 	// Giai đoạn 2-5: Thực thi service
 	resp, err := h.service.GetPasteContent(ctx, url)
 	if err != nil {
-		switch {
-		case errors.Is(err, shared.ErrPasteNotFound), errors.Is(err, shared.ErrPasteExpired):
-			logger.Errorf("Paste not found or expired", "error", err.Error())
-			h.writeError(w, http.StatusNotFound, err.Error())
-		default:
-			logger.Errorf("Internal error", "error", err.Error())
-			h.writeError(w, http.StatusInternalServerError, "Internal server error")
-		}
+		h.writeServiceError(w, logger, err)
 		return
 	}
+	if resp.BurnAfterRead {
+		// Crawlers see that the paste exists but get no way to reveal it
+		w.Header().Set("Cache-Control", "no-store")
+		if !isCrawler(r) {
+			if resp.RevealToken, err = h.service.IssueRevealToken(ctx, url); err != nil {
+				h.writeError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+	}
 
 	// Giai đoạn 6: Trả về phản hồi
 	phaseStart := time.Now()
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		logger.Errorf("Failed to encode response", "error", err.Error())
+		logger.Error("Failed to encode response", zap.Error(err))
 	}
-	logger.Infof("Sent response")
+	logger.Info("Sent response")
 	metrics.RetrievalRequestDuration.WithLabelValues("send_response").Observe(time.Since(phaseStart).Seconds())
 
 	totalDuration := time.Since(startTime).Seconds()
-	logger.Infof("Request completed", "totalDurationSeconds", totalDuration)
+	logger.Info("Request completed", zap.Float64("totalDurationSeconds", totalDuration))
 }
 
 func (h *PasteHandler) GetPastePolicy(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
-	requestID := uuid.New().String()
-	ctx := context.WithValue(r.Context(), "requestID", requestID)
+	ctx := r.Context()
 	url := chi.URLParam(r, "url")
-	logger := h.logger.With("requestID", requestID, "url", url)
+	logger := logging.FromContext(ctx, h.logger).With(logging.URL(url))
 
 	// Giai đoạn 1: Nhận yêu cầu
-	logger.Infof("Received get paste policy request")
+	logger.Info("Received get paste policy request")
 	metrics.RetrievalRequestDuration.WithLabelValues("receive_request").Observe(time.Since(startTime).Seconds())
 
 	if url == "" {
-		logger.Errorf("URL parameter is required")
+		logger.Warn("URL parameter is required")
 		h.writeError(w, http.StatusBadRequest, "URL parameter is required")
 		return
 	}
@@ -89,33 +103,311 @@ func (h *PasteHandler) GetPastePolicy(w http.ResponseWriter, r *http.Request) {
 	// Giai đoạn 2-5: Thực thi service
 	resp, err := h.service.GetPastePolicy(ctx, url)
 	if err != nil {
-		switch {
-		case errors.Is(err, shared.ErrPasteNotFound), errors.Is(err, shared.ErrPasteExpired):
-			logger.Errorf("Paste not found or expired", "error", err.Error())
-			h.writeError(w, http.StatusNotFound, err.Error())
-		default:
-			logger.Errorf("Internal error", "error", err.Error())
-			h.writeError(w, http.StatusInternalServerError, "Internal server error")
-		}
+		h.writeServiceError(w, logger, err)
 		return
 	}
 
 	// Giai đoạn 6: Trả về phản hồi
 	phaseStart := time.Now()
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{"policy": resp}); err != nil {
-		logger.Errorf("Failed to encode response", "error", err.Error())
+	if err := json.NewEncoder(w).Encode(paste.RetrievePolicyResponse{Policy: resp}); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+	logger.Info("Sent response")
+	metrics.RetrievalRequestDuration.WithLabelValues("send_response").Observe(time.Since(phaseStart).Seconds())
+
+	totalDuration := time.Since(startTime).Seconds()
+	logger.Info("Request completed", zap.Float64("totalDurationSeconds", totalDuration))
+}
+
+// RevealPaste reads a burn-after-read paste with the reveal token returned
+// by GetPasteContent. It is the only way to read such a paste, and burns it.
+func (h *PasteHandler) RevealPaste(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	ctx := r.Context()
+	url := chi.URLParam(r, "url")
+	logger := logging.FromContext(ctx, h.logger).With(logging.URL(url))
+
+	// Giai đoạn 1: Nhận yêu cầu
+	logger.Info("Received reveal paste request")
+	metrics.RetrievalRequestDuration.WithLabelValues("receive_request").Observe(time.Since(startTime).Seconds())
+
+	if url == "" {
+		logger.Warn("URL parameter is required")
+		h.writeError(w, http.StatusBadRequest, "URL parameter is required")
+		return
+	}
+	if h.refuseCrawler(w, r, logger) {
+		return
+	}
+	var req paste.RevealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		logger.Warn("Invalid reveal request", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, "Invalid request body", "token is required")
+		return
+	}
+
+	// Giai đoạn 2-5: Thực thi service
+	resp, err := h.service.RevealPaste(ctx, url, req.Token)
+	if err != nil {
+		h.writeServiceError(w, logger, err)
+		return
+	}
+
+	// Giai đoạn 6: Trả về phản hồi
+	phaseStart := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
 	}
-	logger.Infof("Sent response")
+	logger.Info("Sent response")
 	metrics.RetrievalRequestDuration.WithLabelValues("send_response").Observe(time.Since(phaseStart).Seconds())
 
 	totalDuration := time.Since(startTime).Seconds()
-	logger.Infof("Request completed", "totalDurationSeconds", totalDuration)
+	logger.Info("Request completed", zap.Float64("totalDurationSeconds", totalDuration))
+}
+
+// GetPasteRaw serves a paste's content as plain text. Conditional and Range
+// requests are answered by http.ServeContent. Burn-after-read pastes are
+// refused: they are read through RevealPaste.
+func (h *PasteHandler) GetPasteRaw(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	ctx := r.Context()
+	url := chi.URLParam(r, "url")
+	logger := logging.FromContext(ctx, h.logger).With(logging.URL(url))
+
+	// Giai đoạn 1: Nhận yêu cầu
+	logger.Info("Received get raw paste request")
+	metrics.RetrievalRequestDuration.WithLabelValues("receive_request").Observe(time.Since(startTime).Seconds())
+
+	if url == "" {
+		logger.Warn("URL parameter is required")
+		h.writeError(w, http.StatusBadRequest, "URL parameter is required")
+		return
+	}
+
+	// Giai đoạn 2-5: Thực thi service
+	resp, err := h.service.GetPasteRaw(ctx, url)
+	if err != nil {
+		h.writeServiceError(w, logger, err)
+		return
+	}
+	if resp.BurnAfterRead {
+		logger.Info("Refused raw read of burn-after-read paste")
+		w.Header().Set("Cache-Control", "no-store")
+		h.writeError(w, http.StatusForbidden, "Burn-after-read pastes must be revealed",
+			"POST /api/pastes/"+url+"/reveal with the token from /api/pastes/"+url+"/content")
+		return
+	}
+
+	// Giai đoạn 6: Trả về phản hồi
+	phaseStart := time.Now()
+	header := w.Header()
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("X-Content-Type-Options", "nosniff")
+	sum := sha256.Sum256([]byte(resp.Content))
+	header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	header.Set("Cache-Control", "public, max-age="+strconv.Itoa(rawCacheAge(resp)))
+	http.ServeContent(w, r, "", resp.CreatedAt, strings.NewReader(resp.Content))
+	logger.Info("Sent response")
+	metrics.RetrievalRequestDuration.WithLabelValues("send_response").Observe(time.Since(phaseStart).Seconds())
+
+	totalDuration := time.Since(startTime).Seconds()
+	logger.Info("Request completed", zap.Float64("totalDurationSeconds", totalDuration))
+}
+
+// GetPasteHTML serves a paste as an HTML page, highlighted in the language
+// given by the lang query parameter or detected from the content. Markdown
+// pastes are rendered and sanitized instead. A burn-after-read paste gets a
+// page asking the reader to confirm, which posts to RevealPasteHTML.
+func (h *PasteHandler) GetPasteHTML(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	ctx := r.Context()
+	url := chi.URLParam(r, "url")
+	logger := logging.FromContext(ctx, h.logger).With(logging.URL(url))
+
+	// Giai đoạn 1: Nhận yêu cầu
+	logger.Info("Received get paste HTML request")
+	metrics.RetrievalRequestDuration.WithLabelValues("receive_request").Observe(time.Since(startTime).Seconds())
+
+	if url == "" {
+		logger.Warn("URL parameter is required")
+		h.writeError(w, http.StatusBadRequest, "URL parameter is required")
+		return
+	}
+	renderer, ok := h.renderer(w, r, logger)
+	if !ok {
+		return
+	}
+
+	// Giai đoạn 2-5: Thực thi service
+	resp, err := h.service.GetPasteRaw(ctx, url)
+	if err != nil {
+		h.writeServiceError(w, logger, err)
+		return
+	}
+
+	// Giai đoạn 6: Render và trả về phản hồi
+	phaseStart := time.Now()
+	var page bytes.Buffer
+	cacheControl := "public, max-age=" + strconv.Itoa(rawCacheAge(resp))
+	if resp.BurnAfterRead {
+		cacheControl = "no-store"
+		var token string
+		if !isCrawler(r) {
+			if token, err = h.service.IssueRevealToken(ctx, url); err != nil {
+				h.writeError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+		err = renderer.ConfirmPage(&page, url, token)
+	} else {
+		err = renderer.Page(&page, url, resp.Content)
+	}
+	if err != nil {
+		logger.Error("Failed to render paste", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	metrics.RetrievalRequestDuration.WithLabelValues("render_html").Observe(time.Since(phaseStart).Seconds())
+
+	h.writeHTML(w, logger, &page, cacheControl)
+
+	totalDuration := time.Since(startTime).Seconds()
+	logger.Info("Request completed", zap.Float64("totalDurationSeconds", totalDuration))
+}
+
+// RevealPasteHTML renders a burn-after-read paste once the reader has
+// confirmed on the page from GetPasteHTML, burning it.
+func (h *PasteHandler) RevealPasteHTML(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	ctx := r.Context()
+	url := chi.URLParam(r, "url")
+	logger := logging.FromContext(ctx, h.logger).With(logging.URL(url))
+
+	// Giai đoạn 1: Nhận yêu cầu
+	logger.Info("Received reveal paste HTML request")
+	metrics.RetrievalRequestDuration.WithLabelValues("receive_request").Observe(time.Since(startTime).Seconds())
+
+	if url == "" {
+		logger.Warn("URL parameter is required")
+		h.writeError(w, http.StatusBadRequest, "URL parameter is required")
+		return
+	}
+	if h.refuseCrawler(w, r, logger) {
+		return
+	}
+	renderer, ok := h.renderer(w, r, logger)
+	if !ok {
+		return
+	}
+	token := r.PostFormValue("token")
+	if token == "" {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body", "token is required")
+		return
+	}
+
+	// Giai đoạn 2-5: Thực thi service
+	resp, err := h.service.RevealPaste(ctx, url, token)
+	if err != nil {
+		h.writeServiceError(w, logger, err)
+		return
+	}
+
+	// Giai đoạn 6: Render và trả về phản hồi
+	phaseStart := time.Now()
+	var page bytes.Buffer
+	if err = renderer.Page(&page, url, resp.Content); err != nil {
+		logger.Error("Failed to render paste", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	metrics.RetrievalRequestDuration.WithLabelValues("render_html").Observe(time.Since(phaseStart).Seconds())
+
+	h.writeHTML(w, logger, &page, "no-store")
+
+	totalDuration := time.Since(startTime).Seconds()
+	logger.Info("Request completed", zap.Float64("totalDurationSeconds", totalDuration))
+}
+
+// renderer reads the render options from the query. They are checked
+// before the paste is read so that a bad request does not burn a
+// burn-after-read paste.
+func (h *PasteHandler) renderer(w http.ResponseWriter, r *http.Request, logger *zap.Logger) (*render.Renderer, bool) {
+	query := r.URL.Query()
+	opts := render.Options{Language: query.Get("lang"), Theme: query.Get("theme"), LineNumbers: true}
+	if v := query.Get("lines"); v != "" {
+		lines, err := strconv.ParseBool(v)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid lines parameter")
+			return nil, false
+		}
+		opts.LineNumbers = lines
+	}
+	renderer, err := render.New(opts)
+	if err != nil {
+		logger.Info("Invalid render options", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return renderer, true
+}
+
+func (h *PasteHandler) writeHTML(w http.ResponseWriter, logger *zap.Logger, page *bytes.Buffer, cacheControl string) {
+	phaseStart := time.Now()
+	header := w.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("X-Content-Type-Options", "nosniff")
+	// Markdown is already sanitized; the policy is a second line of defence
+	header.Set("Content-Security-Policy",
+		"default-src 'none'; style-src 'unsafe-inline'; img-src https: data:; form-action 'self'")
+	header.Set("Cache-Control", cacheControl)
+	if _, err := page.WriteTo(w); err != nil {
+		logger.Error("Failed to write response", zap.Error(err))
+	}
+	logger.Info("Sent response")
+	metrics.RetrievalRequestDuration.WithLabelValues("send_response").Observe(time.Since(phaseStart).Seconds())
+}
+
+// refuseCrawler answers 403 to known crawlers, which must never read a
+// burn-after-read paste.
+func (h *PasteHandler) refuseCrawler(w http.ResponseWriter, r *http.Request, logger *zap.Logger) bool {
+	if !isCrawler(r) {
+		return false
+	}
+	logger.Info("Refused reveal by crawler", zap.String("userAgent", r.UserAgent()))
+	h.writeError(w, http.StatusForbidden, "Crawlers cannot reveal burn-after-read pastes")
+	return true
+}
+
+// rawCacheAge is the max-age in seconds of a raw paste: its remaining time,
+// capped at rawMaxAge.
+func rawCacheAge(p *paste.RawPaste) int {
+	age := rawMaxAge
+	if p.Expires && p.TTL < age {
+		age = max(p.TTL, 0)
+	}
+	return int(age / time.Second)
+}
+
+func (h *PasteHandler) writeError(w http.ResponseWriter, code int, message string, details ...string) {
+	apierror.Write(w, code, message, details...)
 }
 
-func (h *PasteHandler) writeError(w http.ResponseWriter, code int, message string) {
-	w.WriteHeader(code)
-	if err := json.NewEncoder(w).Encode(map[string]string{"message": message}); err != nil {
-		h.logger.Errorf("Failed to encode error response", "error", err.Error())
+func (h *PasteHandler) writeServiceError(w http.ResponseWriter, logger *zap.Logger, err error) {
+	switch {
+	case errors.Is(err, shared.ErrPasteNotFound):
+		logger.Info("Paste not found", zap.Error(err))
+		apierror.WriteReason(w, http.StatusNotFound, apierror.ReasonPasteNotFound, err.Error())
+	case errors.Is(err, shared.ErrPasteExpired):
+		logger.Info("Paste expired", zap.Error(err))
+		apierror.WriteReason(w, http.StatusNotFound, apierror.ReasonPasteExpired, err.Error())
+	case errors.Is(err, shared.ErrInvalidRevealToken):
+		logger.Info("Invalid reveal token", zap.Error(err))
+		h.writeError(w, http.StatusForbidden, err.Error())
+	default:
+		logger.Error("Internal error", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Internal server error")
 	}
 }
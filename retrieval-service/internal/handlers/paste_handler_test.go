@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi"
+	"github.com/ArsiHien/pastebin-ms/pkg/openapi/openapitest"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"retrieval-service/internal/domain/paste"
+	pasteservice "retrieval-service/internal/service/paste"
+)
+
+type memoryRepo map[string]*paste.Paste
+
+func (r memoryRepo) FindByURL(ctx context.Context, url string) (*paste.Paste, error) {
+	return r[url], nil
+}
+func (r memoryRepo) ClaimBurnAfterRead(ctx context.Context, url string) (*paste.Paste, error) {
+	p := r[url]
+	if p == nil || p.ExpirationPolicy.Type != paste.BurnAfterReadExpiration || p.ExpirationPolicy.IsRead {
+		return nil, nil
+	}
+	p.ExpirationPolicy.IsRead = true
+	claimed := *p
+	return &claimed, nil
+}
+func (r memoryRepo) Upsert(ctx context.Context, p *paste.Paste) error {
+	r[p.URL] = p
+	return nil
+}
+
+type noCache struct{}
+
+func (noCache) Get(ctx context.Context, url string) (*paste.Paste, error) { return nil, nil }
+func (noCache) Set(ctx context.Context, p *paste.Paste) error             { return nil }
+func (noCache) Delete(ctx context.Context, url string) error              { return nil }
+
+type noNegative struct{}
+
+func (noNegative) Missing(ctx context.Context, url string) (bool, error) { return false, nil }
+func (noNegative) SetMissing(ctx context.Context, url string) error      { return nil }
+func (noNegative) Clear(ctx context.Context, url string) error           { return nil }
+
+type memoryTokens struct {
+	mu     sync.Mutex
+	issued map[string]string
+}
+
+func (t *memoryTokens) Issue(ctx context.Context, url string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.issued == nil {
+		t.issued = map[string]string{}
+	}
+	token := fmt.Sprintf("token-%d", len(t.issued))
+	t.issued[token] = url
+	return token, nil
+}
+
+func (t *memoryTokens) Redeem(ctx context.Context, url, token string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	issuedFor, ok := t.issued[token]
+	delete(t.issued, token)
+	return ok && issuedFor == url, nil
+}
+
+type noPublisher struct{}
+
+func (noPublisher) PublishPasteViewedEvent(context.Context, paste.ViewedEvent) error { return nil }
+func (noPublisher) PublishBurnAfterReadPasteViewedEvent(context.Context, paste.BurnAfterReadPasteViewedEvent) error {
+	return nil
+}
+func (noPublisher) Close() error { return nil }
+
+func TestResponsesMatchSpec(t *testing.T) {
+	repo := memoryRepo{
+		"timed": {URL: "timed", Content: "hello", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.TimedExpiration, Duration: "1day"}},
+		"old": {URL: "old", Content: "bye", CreatedAt: time.Now().Add(-2 * time.Hour),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.TimedExpiration, Duration: "1hour"}},
+		"never": {URL: "never", Content: "forever", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpiration}},
+		"burn": {URL: "burn", Content: "secret", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.BurnAfterReadExpiration}},
+	}
+	logger := zap.NewNop()
+	handler := NewPasteHandler(pasteservice.NewRetrieveService(repo, noCache{}, noNegative{}, &memoryTokens{}, noPublisher{}, logger), logger)
+
+	r := chi.NewRouter()
+	r.Get("/api/pastes/{url}/content", handler.GetPasteContent)
+	r.Get("/api/pastes/{url}/policy", handler.GetPastePolicy)
+	r.With(Compress).Get("/api/pastes/{url}/raw", handler.GetPasteRaw)
+	r.With(Compress).Get("/api/pastes/{url}/html", handler.GetPasteHTML)
+	check := openapitest.New(t, openapi.ServiceRetrieval, r)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/pastes/timed/content", http.StatusOK},
+		{"/api/pastes/never/content", http.StatusOK},
+		{"/api/pastes/missing/content", http.StatusNotFound},
+		{"/api/pastes/old/content", http.StatusNotFound},
+		{"/api/pastes/timed/policy", http.StatusOK},
+		{"/api/pastes/missing/policy", http.StatusNotFound},
+		{"/api/pastes/timed/raw", http.StatusOK},
+		{"/api/pastes/old/raw", http.StatusNotFound},
+		{"/api/pastes/timed/html?lang=go&theme=monokai&lines=false", http.StatusOK},
+		{"/api/pastes/never/html", http.StatusOK},
+		{"/api/pastes/timed/html?theme=nope", http.StatusBadRequest},
+		{"/api/pastes/missing/html", http.StatusNotFound},
+		{"/api/pastes/burn/content", http.StatusOK},
+		{"/api/pastes/burn/raw", http.StatusForbidden},
+		{"/api/pastes/burn/html", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := check.Do(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	for path, want := range map[string]string{
+		"/api/pastes/missing/content": apierror.ReasonPasteNotFound,
+		"/api/pastes/old/content":     apierror.ReasonPasteExpired,
+	} {
+		var body apierror.Body
+		rec := check.Do(httptest.NewRequest(http.MethodGet, path, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Reason != want {
+			t.Errorf("%s: reason = %q (%v), want %q", path, body.Reason, err, want)
+		}
+	}
+}
+
+func TestGetPasteRaw(t *testing.T) {
+	repo := memoryRepo{
+		"timed": {URL: "timed", Content: "hello, world", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.TimedExpiration, Duration: "1hour"}},
+		"burn": {URL: "burn", Content: "secret", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.BurnAfterReadExpiration}},
+	}
+	logger := zap.NewNop()
+	handler := NewPasteHandler(pasteservice.NewRetrieveService(repo, noCache{}, noNegative{}, &memoryTokens{}, noPublisher{}, logger), logger)
+	r := chi.NewRouter()
+	r.With(Compress).Get("/api/pastes/{url}/raw", handler.GetPasteRaw)
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/pastes/timed/raw")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello, world" {
+		t.Fatalf("GET = %d %q", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=3599" && cc != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q, want the remaining hour", cc)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") == "" {
+		t.Fatalf("missing validators: %v", rec.Header())
+	}
+
+	if rec := get("/api/pastes/timed/raw", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match = %d, want 304", rec.Code)
+	}
+	if rec := get("/api/pastes/timed/raw", "Range", "bytes=7-11", "Accept-Encoding", "gzip"); rec.Code != http.StatusPartialContent || rec.Body.String() != "world" {
+		t.Errorf("Range = %d %q, want 206 \"world\"", rec.Code, rec.Body)
+	}
+
+	rec = get("/api/pastes/timed/raw", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("ETag") != "W/"+etag {
+		t.Fatalf("gzip headers = %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != "hello, world" {
+		t.Errorf("gzip body = %q", body)
+	}
+	if rec := get("/api/pastes/timed/raw", "Accept-Encoding", "gzip, br"); rec.Header().Get("Content-Encoding") != "br" {
+		t.Errorf("Content-Encoding = %q, want br", rec.Header().Get("Content-Encoding"))
+	}
+
+	rec = get("/api/pastes/burn/raw")
+	if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("burn-after-read = %d %q, want 403 without the content", rec.Code, rec.Body)
+	}
+}
+
+func TestBurnAfterReadReveal(t *testing.T) {
+	repo := memoryRepo{
+		"burn": {URL: "burn", Content: "secret", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.BurnAfterReadExpiration}},
+		"page": {URL: "page", Content: "package main", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.BurnAfterReadExpiration}},
+	}
+	logger := zap.NewNop()
+	handler := NewPasteHandler(pasteservice.NewRetrieveService(repo, noCache{}, noNegative{}, &memoryTokens{}, noPublisher{}, logger), logger)
+	r := chi.NewRouter()
+	r.Get("/api/pastes/{url}/content", handler.GetPasteContent)
+	r.Post("/api/pastes/{url}/reveal", handler.RevealPaste)
+	r.Get("/api/pastes/{url}/html", handler.GetPasteHTML)
+	r.Post("/api/pastes/{url}/html", handler.RevealPasteHTML)
+	check := openapitest.New(t, openapi.ServiceRetrieval, r)
+
+	const slackbot = "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"
+	open := func(userAgent string) paste.RetrievePasteResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/pastes/burn/content", nil)
+		req.Header.Set("User-Agent", userAgent)
+		rec := check.Do(req)
+		var resp paste.RetrievePasteResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Content != "" || !resp.BurnAfterRead || rec.Header().Get("Cache-Control") != "no-store" {
+			t.Fatalf("GET content = %+v, %v; want metadata only", resp, rec.Header())
+		}
+		return resp
+	}
+	reveal := func(token, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/pastes/burn/reveal", strings.NewReader(`{"token":"`+token+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		return check.Do(req)
+	}
+
+	if bot := open(slackbot); bot.RevealToken != "" {
+		t.Errorf("crawler was given a reveal token")
+	}
+	token := open("Mozilla/5.0").RevealToken
+	if token == "" {
+		t.Fatal("no reveal token")
+	}
+	if rec := reveal(token, slackbot); rec.Code != http.StatusForbidden {
+		t.Errorf("crawler reveal = %d, want 403", rec.Code)
+	}
+	if rec := reveal("guess", "Mozilla/5.0"); rec.Code != http.StatusForbidden {
+		t.Errorf("reveal with an unknown token = %d, want 403", rec.Code)
+	}
+	second := open("Mozilla/5.0").RevealToken
+	if rec := reveal(token, "Mozilla/5.0"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"content":"secret"`) {
+		t.Errorf("reveal = %d %s", rec.Code, rec.Body)
+	}
+	if rec := reveal(second, "Mozilla/5.0"); rec.Code != http.StatusNotFound {
+		t.Errorf("second reveal = %d, want 404", rec.Code)
+	}
+
+	rec := check.Do(httptest.NewRequest(http.MethodGet, "/api/pastes/page/html", nil))
+	if strings.Contains(rec.Body.String(), "package main") || !strings.Contains(rec.Body.String(), `name="token"`) {
+		t.Fatalf("confirmation page = %s", rec.Body)
+	}
+	token = rec.Body.String()[strings.Index(rec.Body.String(), `name="token" value="`)+len(`name="token" value="`):]
+	token = token[:strings.Index(token, `"`)]
+	req := httptest.NewRequest(http.MethodPost, "/api/pastes/page/html", strings.NewReader("token="+token))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if rec = check.Do(req); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "package") {
+		t.Errorf("revealed page = %d %s", rec.Code, rec.Body)
+	}
+}
@@ -14,6 +14,66 @@ var (
 		},
 		[]string{"phase"}, // mongo_save, cache_save, total
 	)
+
+	RabbitMQConnected = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "retrieval_service_rabbitmq_connected",
+			Help: "Whether the RabbitMQ connection is currently up (1) or reconnecting (0)",
+		},
+	)
+
+	RabbitMQReconnects = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "retrieval_service_rabbitmq_reconnects_total",
+			Help: "Number of successful RabbitMQ reconnects",
+		},
+	)
+
+	// CacheRequests counts paste cache lookups per tier; the hit ratio of a
+	// tier is hit / (hit + miss). Redis is only asked on a local miss.
+	CacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "retrieval_service_cache_requests_total",
+			Help: "Paste cache lookups by tier (local, redis, negative) and result (hit, miss)",
+		},
+		[]string{"tier", "result"},
+	)
+
+	CoalescedLoads = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "retrieval_service_coalesced_loads_total",
+			Help: "Number of paste lookups that shared a concurrent MongoDB query instead of making their own",
+		},
+	)
+
+	CacheInvalidations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "retrieval_service_cache_invalidations_total",
+			Help: "Number of local cache invalidations received from other replicas",
+		},
+	)
+
+	LocalCacheBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "retrieval_service_local_cache_bytes",
+			Help: "Approximate memory held by the in-process paste cache",
+		},
+	)
+
+	LocalCacheEntries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "retrieval_service_local_cache_entries",
+			Help: "Number of pastes in the in-process paste cache",
+		},
+	)
+
+	DuplicateMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "retrieval_service_duplicate_messages_total",
+			Help: "Number of redelivered messages skipped because they were already processed",
+		},
+		[]string{"queue"},
+	)
 )
 
 // RetrievalRequestDuration đo thời gian từng giai đoạn trong Retrieval Service
@@ -0,0 +1,57 @@
+package rebuild
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ArsiHien/pastebin-ms/pkg/apierror"
+	"github.com/go-chi/chi/v5"
+)
+
+// NewRouter exposes the Job over HTTP:
+//
+//	GET    /   progress of the current or last run
+//	POST   /   start a run with {"page_size": n, "warm_cache": bool, "resume": bool}
+//	DELETE /   cancel the running rebuild
+func NewRouter(job *Job) http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, job.Progress())
+	})
+
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		var opts Options
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && !errors.Is(err, io.EOF) {
+			apierror.Write(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := job.Start(opts); err != nil {
+			if errors.Is(err, ErrRunning) {
+				apierror.Write(w, http.StatusConflict, err.Error())
+				return
+			}
+			apierror.Write(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job.Progress())
+	})
+
+	r.Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		if !job.Cancel() {
+			apierror.Write(w, http.StatusConflict, "rebuild: not running")
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job.Progress())
+	})
+
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
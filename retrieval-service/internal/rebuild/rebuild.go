@@ -0,0 +1,322 @@
+// Package rebuild repopulates the retrieval read model from MySQL, the only
+// durable copy of every paste.
+package rebuild
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "github.com/ArsiHien/pastebin-ms/events/v1"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"retrieval-service/internal/cache"
+	"retrieval-service/internal/domain/paste"
+	"retrieval-service/internal/eventbus"
+	"retrieval-service/shared"
+)
+
+// ErrRunning is returned when a rebuild is started while one is in progress.
+var ErrRunning = errors.New("rebuild: already running")
+
+// DefaultPageSize is the number of pastes read from MySQL per query.
+const DefaultPageSize = 500
+
+const checkpointID = "pastes"
+
+// Status values reported in Progress.
+const (
+	StatusIdle      = "idle"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Options controls a rebuild run.
+type Options struct {
+	// PageSize is the number of pastes read per MySQL query.
+	PageSize int `json:"page_size"`
+	// WarmCache also writes every paste to Redis.
+	WarmCache bool `json:"warm_cache"`
+	// Resume continues after the last checkpoint instead of starting over.
+	Resume bool `json:"resume"`
+}
+
+// Progress describes the current or last run.
+type Progress struct {
+	Status     string    `json:"status"`
+	Total      int64     `json:"total"`
+	Processed  int64     `json:"processed"`
+	Failed     int64     `json:"failed"`
+	LastID     string    `json:"last_id,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// checkpoint is persisted after every page so an interrupted run can resume.
+type checkpoint struct {
+	ID        string    `bson:"_id"`
+	LastID    string    `bson:"last_id"`
+	Processed int64     `bson:"processed"`
+	Failed    int64     `bson:"failed"`
+	Completed bool      `bson:"completed"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// Job streams MySQL pastes joined with their expiration policies in
+// keyset-paginated pages and upserts them into the read model.
+type Job struct {
+	mysql       *sql.DB
+	repo        paste.Repository
+	cache       cache.PasteCache
+	checkpoints *mongo.Collection
+	logger      *zap.Logger
+
+	mu       sync.Mutex
+	progress Progress
+	cancel   context.CancelFunc
+}
+
+// NewJob creates a Job. Checkpoints are kept in the rebuild_checkpoints
+// collection of db.
+func NewJob(mysql *sql.DB, repo paste.Repository, cache cache.PasteCache, db *mongo.Database,
+	logger *zap.Logger) *Job {
+	return &Job{
+		mysql:       mysql,
+		repo:        repo,
+		cache:       cache,
+		checkpoints: db.Collection("rebuild_checkpoints"),
+		logger:      logger,
+		progress:    Progress{Status: StatusIdle},
+	}
+}
+
+// Progress returns a snapshot of the current or last run.
+func (j *Job) Progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// Start runs a rebuild in the background.
+func (j *Job) Start(opts Options) error {
+	ctx, err := j.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	go func() {
+		_ = j.run(ctx, opts)
+	}()
+	return nil
+}
+
+// Run rebuilds synchronously and returns once every page is processed or
+// ctx is cancelled.
+func (j *Job) Run(ctx context.Context, opts Options) error {
+	ctx, err := j.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return j.run(ctx, opts)
+}
+
+// Cancel stops a running rebuild after its current page. The checkpoint is
+// kept, so it can be resumed later.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancel == nil {
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+func (j *Job) begin(parent context.Context) (context.Context, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancel != nil {
+		return nil, ErrRunning
+	}
+	ctx, cancel := context.WithCancel(parent)
+	j.cancel = cancel
+	now := time.Now()
+	j.progress = Progress{Status: StatusRunning, StartedAt: now, UpdatedAt: now}
+	return ctx, nil
+}
+
+func (j *Job) run(ctx context.Context, opts Options) (err error) {
+	defer func() { j.finish(ctx, err) }()
+
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultPageSize
+	}
+
+	cp := checkpoint{ID: checkpointID}
+	if opts.Resume {
+		if cp, err = j.loadCheckpoint(ctx); err != nil {
+			return err
+		}
+		if cp.Completed {
+			cp = checkpoint{ID: checkpointID}
+		}
+	}
+
+	var total int64
+	if err := j.mysql.QueryRowContext(ctx, "SELECT COUNT(*) FROM pastes").Scan(&total); err != nil {
+		return fmt.Errorf("failed to count pastes: %w", err)
+	}
+	j.update(func(p *Progress) {
+		p.Total = total
+		p.Processed = cp.Processed
+		p.Failed = cp.Failed
+		p.LastID = cp.LastID
+	})
+	j.logger.Info("Starting read model rebuild", zap.Int64("total", total),
+		zap.String("resumeAfter", cp.LastID), zap.Int("pageSize", opts.PageSize),
+		zap.Bool("warmCache", opts.WarmCache))
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		events, err := j.page(ctx, cp.LastID, opts.PageSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			cp.Completed = true
+			return j.saveCheckpoint(ctx, cp)
+		}
+
+		for _, e := range events {
+			if err := j.store(ctx, e, opts.WarmCache); err != nil {
+				cp.Failed++
+				j.logger.Error("Failed to rebuild paste", logging.URL(e.URL), zap.Error(err))
+			} else {
+				cp.Processed++
+			}
+			cp.LastID = e.ID
+		}
+
+		if err := j.saveCheckpoint(ctx, cp); err != nil {
+			return err
+		}
+		j.update(func(p *Progress) {
+			p.Processed = cp.Processed
+			p.Failed = cp.Failed
+			p.LastID = cp.LastID
+		})
+		j.logger.Info("Rebuild progress", zap.Int64("processed", cp.Processed),
+			zap.Int64("failed", cp.Failed), zap.Int64("total", total))
+	}
+}
+
+// page reads up to limit pastes with an ID greater than after.
+func (j *Job) page(ctx context.Context, after string, limit int) ([]v1.PasteCreated, error) {
+	rows, err := j.mysql.QueryContext(ctx, `
+		SELECT p.id, p.url, p.content, p.created_at, e.policy_type, COALESCE(e.duration, '')
+		FROM pastes p
+		JOIN expiration_policies e ON e.id = p.expiration_policy_id
+		WHERE p.id > ?
+		ORDER BY p.id
+		LIMIT ?`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pastes: %w", err)
+	}
+	defer rows.Close()
+
+	var out []v1.PasteCreated
+	for rows.Next() {
+		var e v1.PasteCreated
+		if err := rows.Scan(&e.ID, &e.URL, &e.Content, &e.CreatedAt, &e.PolicyType, &e.Duration); err != nil {
+			return nil, fmt.Errorf("failed to scan paste: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (j *Job) store(ctx context.Context, e v1.PasteCreated, warmCache bool) error {
+	p := eventbus.PasteFromEvent(e)
+	if err := j.repo.Upsert(ctx, &p); err != nil {
+		return err
+	}
+	// Only pastes that can still be read are cached, as on the read path
+	if warmCache && j.cache != nil && !expired(&p, time.Now()) {
+		if err := j.cache.Set(ctx, &p); err != nil {
+			j.logger.Error("Failed to warm cache", logging.URL(p.URL), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// expired reports whether p is a timed paste whose time is up at now.
+func expired(p *paste.Paste, now time.Time) bool {
+	if p.ExpirationPolicy.Type != paste.TimedExpiration {
+		return false
+	}
+	duration, ok := shared.DurationMap[p.ExpirationPolicy.Duration]
+	return ok && !now.Before(p.CreatedAt.Add(duration))
+}
+
+func (j *Job) loadCheckpoint(ctx context.Context) (checkpoint, error) {
+	var cp checkpoint
+	err := j.checkpoints.FindOne(ctx, bson.M{"_id": checkpointID}).Decode(&cp)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return checkpoint{ID: checkpointID}, nil
+	}
+	if err != nil {
+		return cp, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+func (j *Job) saveCheckpoint(ctx context.Context, cp checkpoint) error {
+	cp.UpdatedAt = time.Now()
+	_, err := j.checkpoints.ReplaceOne(ctx, bson.M{"_id": checkpointID}, cp, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (j *Job) update(fn func(*Progress)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.progress)
+	j.progress.UpdatedAt = time.Now()
+}
+
+func (j *Job) finish(ctx context.Context, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.cancel = nil
+	now := time.Now()
+	j.progress.UpdatedAt = now
+	j.progress.FinishedAt = now
+	switch {
+	case err == nil:
+		j.progress.Status = StatusCompleted
+		j.logger.Info("Read model rebuild completed", zap.Int64("processed", j.progress.Processed),
+			zap.Int64("failed", j.progress.Failed))
+	case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+		j.progress.Status = StatusCancelled
+		j.logger.Info("Read model rebuild cancelled", zap.String("lastID", j.progress.LastID))
+	default:
+		j.progress.Status = StatusFailed
+		j.progress.Error = err.Error()
+		j.logger.Error("Read model rebuild failed", zap.Error(err), zap.String("lastID", j.progress.LastID))
+	}
+}
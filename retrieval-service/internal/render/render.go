@@ -0,0 +1,200 @@
+// Package render turns paste content into a standalone HTML page: source
+// code highlighted with chroma, or Markdown rendered and sanitized.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// DefaultTheme is the chroma style used when none is asked for.
+const DefaultTheme = "github"
+
+// LineAnchorPrefix prefixes the id of every line number, so line 12 of a
+// page can be linked as #L12.
+const LineAnchorPrefix = "L"
+
+// Errors returned by New for options that name nothing chroma knows.
+var (
+	ErrUnknownLanguage = errors.New("unknown language")
+	ErrUnknownTheme    = errors.New("unknown theme")
+)
+
+// Options select how a paste is rendered.
+type Options struct {
+	// Language is a lexer name, alias or file extension such as "go",
+	// "python" or "md". Empty means detect it from the content.
+	Language string
+	// Theme is a chroma style name; empty means DefaultTheme.
+	Theme       string
+	LineNumbers bool
+}
+
+// Renderer renders pastes with fixed options.
+type Renderer struct {
+	lexer     chroma.Lexer
+	style     *chroma.Style
+	formatter *html.Formatter
+}
+
+// New checks opts and returns a renderer for them, so that bad options can
+// be rejected before a paste is read.
+func New(opts Options) (*Renderer, error) {
+	theme := opts.Theme
+	if theme == "" {
+		theme = DefaultTheme
+	}
+	style, ok := styles.Registry[theme]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTheme, theme)
+	}
+
+	var lexer chroma.Lexer
+	if opts.Language != "" {
+		if lexer = lexers.Get(opts.Language); lexer == nil {
+			return nil, fmt.Errorf("%w %q", ErrUnknownLanguage, opts.Language)
+		}
+	}
+
+	return &Renderer{
+		lexer: lexer,
+		style: style,
+		formatter: html.New(
+			html.WithClasses(true),
+			html.WithLineNumbers(opts.LineNumbers),
+			html.WithLinkableLineNumbers(opts.LineNumbers, LineAnchorPrefix),
+			html.TabWidth(4),
+		),
+	}, nil
+}
+
+// Page writes content as a complete HTML document titled title.
+func (r *Renderer) Page(w io.Writer, title, content string) error {
+	var css, body bytes.Buffer
+	css.WriteString(baseCSS)
+	if err := r.formatter.WriteCSS(&css, r.style); err != nil {
+		return fmt.Errorf("failed to write style: %w", err)
+	}
+
+	lexer := r.lexerFor(content)
+	if strings.EqualFold(lexer.Config().Name, "markdown") {
+		if err := markdown(&body, content); err != nil {
+			return err
+		}
+	} else {
+		tokens, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+		if err != nil {
+			return fmt.Errorf("failed to tokenise: %w", err)
+		}
+		if err = r.formatter.Format(&body, r.style, tokens); err != nil {
+			return fmt.Errorf("failed to highlight: %w", err)
+		}
+	}
+
+	return page.Execute(w, struct {
+		Title string
+		CSS   template.CSS
+		Body  template.HTML
+	}{title, template.CSS(css.String()), template.HTML(body.String())})
+}
+
+// ConfirmPage writes the page shown in place of a burn-after-read paste. It
+// warns that the paste can be read only once and, when token is set, has a
+// button that posts it back to the same URL to reveal the paste.
+func (r *Renderer) ConfirmPage(w io.Writer, title, token string) error {
+	var css bytes.Buffer
+	css.WriteString(baseCSS)
+	if err := r.formatter.WriteCSS(&css, r.style); err != nil {
+		return fmt.Errorf("failed to write style: %w", err)
+	}
+	return confirm.Execute(w, struct {
+		Title string
+		CSS   template.CSS
+		Token string
+	}{title, template.CSS(css.String()), token})
+}
+
+func (r *Renderer) lexerFor(content string) chroma.Lexer {
+	if r.lexer != nil {
+		return r.lexer
+	}
+	if lexer := lexers.Analyse(content); lexer != nil {
+		return lexer
+	}
+	return lexers.Fallback
+}
+
+var (
+	md = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	// Pastes are written by anyone, so only markup that cannot run script
+	// or restyle the page survives
+	sanitizer = bluemonday.UGCPolicy()
+)
+
+func markdown(w io.Writer, content string) error {
+	var out bytes.Buffer
+	if err := md.Convert([]byte(content), &out); err != nil {
+		return fmt.Errorf("failed to render markdown: %w", err)
+	}
+	_, err := io.WriteString(w, `<article class="markdown">`+strings.TrimSpace(sanitizer.Sanitize(out.String()))+`</article>`)
+	return err
+}
+
+const baseCSS = `body { margin: 0; }
+.chroma { margin: 0; padding: 1em; min-height: 100vh; box-sizing: border-box; overflow-x: auto; }
+.chroma a { color: inherit; text-decoration: none; }
+.markdown { max-width: 50em; margin: 2em auto; padding: 0 1em; font-family: sans-serif; line-height: 1.5; }
+.markdown pre { overflow-x: auto; }
+.confirm { max-width: 30em; margin: 4em auto; padding: 0 1em; font-family: sans-serif; text-align: center; }
+.confirm button { font-size: 1em; padding: 0.5em 1.5em; cursor: pointer; }
+`
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+{{.CSS}}</style>
+</head>
+<body class="bg">
+{{.Body}}
+</body>
+</html>
+`))
+
+var confirm = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+{{.CSS}}</style>
+</head>
+<body class="bg">
+<main class="confirm">
+<p>This paste can be read only once. It is deleted as soon as it is revealed.</p>
+{{if .Token}}<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Reveal paste</button>
+</form>{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,54 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPageHighlightsCodeWithLineAnchors(t *testing.T) {
+	r, err := New(Options{Language: "go", LineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err = r.Page(&out, "abc", "package main\n\nfunc main() {}\n"); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	for _, want := range []string{"<title>abc</title>", `id="L3"`, `href="#L3"`, `class="kd"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not contain %s:\n%s", want, page)
+		}
+	}
+}
+
+func TestPageSanitizesMarkdown(t *testing.T) {
+	r, err := New(Options{Language: "md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	content := "# Title\n\n<script>alert(1)</script>\n\n[x](javascript:alert(1)) <img src=x onerror=alert(1)>\n"
+	if err = r.Page(&out, "abc", content); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	if !strings.Contains(page, "<h1") {
+		t.Errorf("markdown was not rendered:\n%s", page)
+	}
+	for _, bad := range []string{"<script>alert", "javascript:", "onerror"} {
+		if strings.Contains(page, bad) {
+			t.Errorf("page contains %s:\n%s", bad, page)
+		}
+	}
+}
+
+func TestNewRejectsUnknownOptions(t *testing.T) {
+	if _, err := New(Options{Theme: "nope"}); !errors.Is(err, ErrUnknownTheme) {
+		t.Errorf("theme: err = %v", err)
+	}
+	if _, err := New(Options{Language: "nope"}); !errors.Is(err, ErrUnknownLanguage) {
+		t.Errorf("language: err = %v", err)
+	}
+}
@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"retrieval-service/internal/domain/paste"
 	"time"
 )
@@ -17,8 +19,8 @@ func NewMongoPasteRepository(db *mongo.Database) *MongoPasteRepository {
 	return &MongoPasteRepository{collection: collection}
 }
 
-func (r *MongoPasteRepository) FindByURL(url string) (*paste.Paste, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *MongoPasteRepository) FindByURL(ctx context.Context, url string) (*paste.Paste, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var p paste.Paste
@@ -32,17 +34,49 @@ func (r *MongoPasteRepository) FindByURL(url string) (*paste.Paste, error) {
 	return &p, nil
 }
 
-func (r *MongoPasteRepository) MarkAsRead(url string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// ClaimBurnAfterRead marks an unread burn-after-read paste as read and
+// returns it, in one conditional update so that concurrent readers cannot
+// both get it. It returns nil if the paste does not exist, is not
+// burn-after-read or was already read.
+func (r *MongoPasteRepository) ClaimBurnAfterRead(ctx context.Context, url string) (*paste.Paste, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	_, err := r.collection.UpdateOne(ctx, map[string]interface{}{"url": url}, map[string]interface{}{
-		"$set": map[string]interface{}{
-			"expiration_policy.is_read": true,
-		},
-	})
+	// is_read is omitted until set, so "not true" rather than "false"
+	filter := bson.M{
+		"url":                       url,
+		"expiration_policy.type":    paste.BurnAfterReadExpiration,
+		"expiration_policy.is_read": bson.M{"$ne": true},
+	}
+	update := bson.M{"$set": bson.M{"expiration_policy.is_read": true}}
+
+	var p paste.Paste
+	err := r.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&p)
 	if err != nil {
-		return err
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	return nil
+	return &p, nil
+}
+
+// Upsert writes p keyed by URL. The burn-after-read is_read flag is only
+// set on insert, so replaying a paste never revives one that was already read.
+func (r *MongoPasteRepository) Upsert(ctx context.Context, p *paste.Paste) error {
+	set := bson.M{
+		"content":                p.Content,
+		"created_at":             p.CreatedAt,
+		"expiration_policy.type": p.ExpirationPolicy.Type,
+	}
+	update := bson.M{"$set": set}
+	if p.ExpirationPolicy.Duration != "" {
+		set["expiration_policy.duration"] = p.ExpirationPolicy.Duration
+	} else {
+		update["$unset"] = bson.M{"expiration_policy.duration": ""}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"url": p.URL}, update, options.Update().SetUpsert(true))
+	return err
 }
@@ -3,6 +3,9 @@ package paste
 import (
 	"context"
 	"fmt"
+	"github.com/ArsiHien/pastebin-ms/pkg/logging"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 	"retrieval-service/internal/cache"
 	"retrieval-service/internal/domain/paste"
 	"retrieval-service/internal/metrics"
@@ -12,30 +15,152 @@ import (
 
 // RetrieveService handles paste retrieval operations
 type RetrieveService struct {
-	repo   paste.Repository
-	cache  cache.PasteCache
-	pub    paste.EventPublisher
-	logger *shared.Logger
+	repo     paste.Repository
+	cache    cache.PasteCache
+	negative cache.NegativeCache
+	tokens   cache.RevealTokens
+	pub      paste.EventPublisher
+	logger   *zap.Logger
+
+	// loads coalesces concurrent MongoDB lookups of the same URL
+	loads loadGroup
+}
+
+// loadGroup is the part of singleflight.Group the service uses
+type loadGroup interface {
+	Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool)
 }
 
 // NewRetrieveService creates a new paste retrieval service
 func NewRetrieveService(
 	repo paste.Repository,
 	cache cache.PasteCache,
+	negative cache.NegativeCache,
+	tokens cache.RevealTokens,
 	pub paste.EventPublisher,
-	logger *shared.Logger,
+	logger *zap.Logger,
 ) *RetrieveService {
 	return &RetrieveService{
-		repo:   repo,
-		cache:  cache,
-		pub:    pub,
-		logger: logger,
+		repo:     repo,
+		cache:    cache,
+		negative: negative,
+		tokens:   tokens,
+		pub:      pub,
+		logger:   logger,
+		loads:    &singleflight.Group{},
 	}
 }
 
-// GetPasteContent retrieves a paste's content by URL
+// GetPasteContent retrieves a paste's content by URL. A burn-after-read
+// paste is returned without its content and is not consumed; see RevealPaste.
 func (s *RetrieveService) GetPasteContent(ctx context.Context, url string) (*paste.RetrievePasteResponse, error) {
-	logger := s.logger.With("requestID", ctx.Value("requestID"), "url", url)
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
+
+	// Giai đoạn 2-4: Lấy paste, kiểm tra hết hạn và xử lý view
+	p, err := s.readPaste(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Giai đoạn 5: Tạo response
+	phaseStart := time.Now()
+	resp := &paste.RetrievePasteResponse{
+		URL:           p.URL,
+		Content:       p.Content,
+		RemainingTime: s.calculateTimeUntilExpiration(p),
+		BurnAfterRead: p.ExpirationPolicy.Type == paste.BurnAfterReadExpiration,
+	}
+	logger.Info("Prepared response")
+	metrics.RetrievalRequestDuration.WithLabelValues("prepare_response").Observe(time.Since(phaseStart).Seconds())
+
+	return resp, nil
+}
+
+// IssueRevealToken returns a one-time token that reveals a burn-after-read
+// paste through RevealPaste.
+func (s *RetrieveService) IssueRevealToken(ctx context.Context, url string) (string, error) {
+	token, err := s.tokens.Issue(ctx, url)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Error("Failed to issue reveal token", logging.URL(url), zap.Error(err))
+		return "", fmt.Errorf("failed to issue reveal token: %w", err)
+	}
+	return token, nil
+}
+
+// RevealPaste redeems a reveal token and reads the burn-after-read paste it
+// was issued for. Only one reveal of a paste succeeds; the others get
+// ErrPasteExpired.
+func (s *RetrieveService) RevealPaste(ctx context.Context, url, token string) (*paste.RetrievePasteResponse, error) {
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
+
+	// Giai đoạn 2: Kiểm tra token
+	phaseStart := time.Now()
+	ok, err := s.tokens.Redeem(ctx, url, token)
+	if err != nil {
+		logger.Error("Failed to redeem reveal token", zap.Error(err))
+		return nil, fmt.Errorf("failed to redeem reveal token: %w", err)
+	}
+	if !ok {
+		logger.Info("Invalid reveal token")
+		return nil, shared.ErrInvalidRevealToken
+	}
+	metrics.RetrievalRequestDuration.WithLabelValues("redeem_token").Observe(time.Since(phaseStart).Seconds())
+
+	// Giai đoạn 3-4: Đọc và đánh dấu đã đọc
+	phaseStart = time.Now()
+	p, err := s.burn(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	metrics.RetrievalRequestDuration.WithLabelValues("process_view").Observe(time.Since(phaseStart).Seconds())
+
+	// Giai đoạn 5: Tạo response
+	phaseStart = time.Now()
+	resp := &paste.RetrievePasteResponse{
+		URL:           p.URL,
+		Content:       p.Content,
+		RemainingTime: s.calculateTimeUntilExpiration(p),
+		BurnAfterRead: true,
+	}
+	logger.Info("Prepared response")
+	metrics.RetrievalRequestDuration.WithLabelValues("prepare_response").Observe(time.Since(phaseStart).Seconds())
+
+	return resp, nil
+}
+
+// GetPasteRaw retrieves a paste's content by URL for the plain text and HTML
+// views. Reading it counts as a view exactly like GetPasteContent, and
+// burn-after-read pastes are likewise returned without content.
+func (s *RetrieveService) GetPasteRaw(ctx context.Context, url string) (*paste.RawPaste, error) {
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
+
+	// Giai đoạn 2-4: Lấy paste, kiểm tra hết hạn và xử lý view
+	p, err := s.readPaste(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Giai đoạn 5: Tạo response
+	phaseStart := time.Now()
+	ttl, expires := s.timeUntilExpiration(p)
+	resp := &paste.RawPaste{
+		Content:       p.Content,
+		CreatedAt:     p.CreatedAt,
+		BurnAfterRead: p.ExpirationPolicy.Type == paste.BurnAfterReadExpiration,
+		Expires:       expires,
+		TTL:           ttl,
+	}
+	logger.Info("Prepared response")
+	metrics.RetrievalRequestDuration.WithLabelValues("prepare_response").Observe(time.Since(phaseStart).Seconds())
+
+	return resp, nil
+}
+
+// readPaste fetches a paste that has not expired and records the view. The
+// content of a burn-after-read paste is removed instead: it is only read by
+// RevealPaste, so that link previews and crawlers cannot burn it.
+func (s *RetrieveService) readPaste(ctx context.Context, url string) (*paste.Paste, error) {
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
 
 	// Giai đoạn 2: Lấy paste
 	phaseStart := time.Now()
@@ -48,38 +173,32 @@ func (s *RetrieveService) GetPasteContent(ctx context.Context, url string) (*pas
 	// Giai đoạn 3: Kiểm tra trạng thái hết hạn
 	phaseStart = time.Now()
 	if s.isExpired(p) {
-		if err = s.cache.Delete(url); err != nil {
-			logger.Errorf("Failed to delete expired paste from cache", "error", err.Error())
+		if err = s.cache.Delete(ctx, url); err != nil {
+			logger.Error("Failed to delete expired paste from cache", zap.Error(err))
 		}
-		logger.Errorf("Paste expired")
+		logger.Info("Paste expired")
 		return nil, shared.ErrPasteExpired
 	}
 	metrics.RetrievalRequestDuration.WithLabelValues("check_expiration").Observe(time.Since(phaseStart).Seconds())
 
 	// Giai đoạn 4: Xử lý view
 	phaseStart = time.Now()
-	if err = s.processView(ctx, p); err != nil {
-		logger.Errorf("Failed to process view", "error", err.Error())
+	if p.ExpirationPolicy.Type == paste.BurnAfterReadExpiration {
+		withheld := *p
+		withheld.Content = ""
+		p = &withheld
+	} else if err = s.publishView(ctx, p); err != nil {
+		logger.Error("Failed to process view", zap.Error(err))
 		// Continue to return paste even if view processing fails
 	}
 	metrics.RetrievalRequestDuration.WithLabelValues("process_view").Observe(time.Since(phaseStart).Seconds())
 
-	// Giai đoạn 5: Tạo response
-	phaseStart = time.Now()
-	resp := &paste.RetrievePasteResponse{
-		URL:           p.URL,
-		Content:       p.Content,
-		RemainingTime: s.calculateTimeUntilExpiration(p),
-	}
-	logger.Infof("Prepared response")
-	metrics.RetrievalRequestDuration.WithLabelValues("prepare_response").Observe(time.Since(phaseStart).Seconds())
-
-	return resp, nil
+	return p, nil
 }
 
 // GetPastePolicy retrieves a paste's expiration policy
 func (s *RetrieveService) GetPastePolicy(ctx context.Context, url string) (string, error) {
-	logger := s.logger.With("requestID", ctx.Value("requestID"), "url", url)
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
 
 	// Giai đoạn 2: Lấy paste
 	phaseStart := time.Now()
@@ -92,10 +211,10 @@ func (s *RetrieveService) GetPastePolicy(ctx context.Context, url string) (strin
 	// Giai đoạn 3: Kiểm tra trạng thái hết hạn
 	phaseStart = time.Now()
 	if s.isExpired(p) {
-		if err = s.cache.Delete(url); err != nil {
-			logger.Errorf("Failed to delete expired paste from cache", "error", err.Error())
+		if err = s.cache.Delete(ctx, url); err != nil {
+			logger.Error("Failed to delete expired paste from cache", zap.Error(err))
 		}
-		logger.Errorf("Paste expired")
+		logger.Info("Paste expired")
 		return "", shared.ErrPasteExpired
 	}
 	metrics.RetrievalRequestDuration.WithLabelValues("check_expiration").Observe(time.Since(phaseStart).Seconds())
@@ -103,7 +222,7 @@ func (s *RetrieveService) GetPastePolicy(ctx context.Context, url string) (strin
 	// Giai đoạn 4: Tạo response
 	phaseStart = time.Now()
 	resp := s.calculateTimeUntilExpiration(p)
-	logger.Infof("Prepared response")
+	logger.Info("Prepared response")
 	metrics.RetrievalRequestDuration.WithLabelValues("prepare_response").Observe(time.Since(phaseStart).Seconds())
 
 	return resp, nil
@@ -111,44 +230,81 @@ func (s *RetrieveService) GetPastePolicy(ctx context.Context, url string) (strin
 
 // fetchPaste retrieves a paste from cache or repository
 func (s *RetrieveService) fetchPaste(ctx context.Context, url string) (*paste.Paste, error) {
-	logger := s.logger.With("requestID", ctx.Value("requestID"), "url", url)
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
 
 	// Giai đoạn 2.1: Kiểm tra cache
 	phaseStart := time.Now()
-	p, err := s.cache.Get(url)
+	p, err := s.cache.Get(ctx, url)
 	if err != nil {
-		logger.Errorf("Cache error", "error", err.Error())
+		logger.Error("Cache error", zap.Error(err))
 	}
 	if p != nil {
-		logger.Infof("Cache hit")
+		logger.Info("Cache hit")
 		metrics.RetrievalRequestDuration.WithLabelValues("redis_check").Observe(time.Since(phaseStart).Seconds())
 		return p, nil
 	}
-	logger.Infof("Cache miss")
+	logger.Info("Cache miss")
 	metrics.RetrievalRequestDuration.WithLabelValues("redis_check").Observe(time.Since(phaseStart).Seconds())
 
-	// Giai đoạn 2.2: Truy vấn MongoDB
+	// Giai đoạn 2.2: Kiểm tra negative cache
 	phaseStart = time.Now()
-	p, err = s.repo.FindByURL(url)
+	missing, err := s.negative.Missing(ctx, url)
 	if err != nil {
-		logger.Errorf("Failed to find paste in MongoDB", "error", err.Error())
-		return nil, fmt.Errorf("failed to find paste: %w", err)
+		logger.Error("Negative cache error", zap.Error(err))
 	}
-	if p == nil {
-		logger.Errorf("Paste not found in MongoDB")
+	metrics.RetrievalRequestDuration.WithLabelValues("negative_check").Observe(time.Since(phaseStart).Seconds())
+	if missing {
+		logger.Info("Negative cache hit")
+		metrics.CacheRequests.WithLabelValues("negative", "hit").Inc()
 		return nil, shared.ErrPasteNotFound
 	}
-	logger.Infof("Retrieved paste from MongoDB")
+	metrics.CacheRequests.WithLabelValues("negative", "miss").Inc()
+
+	// Giai đoạn 2.3: Truy vấn MongoDB, gộp các yêu cầu đồng thời cho cùng URL.
+	// Kết quả dùng chung nên không phụ thuộc vào việc yêu cầu đầu tiên bị hủy
+	loadCtx := context.WithoutCancel(ctx)
+	v, err, coalesced := s.loads.Do(url, func() (interface{}, error) {
+		return s.loadPaste(loadCtx, url)
+	})
+	if coalesced {
+		metrics.CoalescedLoads.Inc()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Each caller gets its own copy of the shared result
+	loaded := *v.(*paste.Paste)
+	return &loaded, nil
+}
+
+// loadPaste reads a paste from MongoDB and caches the result, including
+// its absence
+func (s *RetrieveService) loadPaste(ctx context.Context, url string) (*paste.Paste, error) {
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
+
+	phaseStart := time.Now()
+	p, err := s.repo.FindByURL(ctx, url)
+	if err != nil {
+		logger.Error("Failed to find paste in MongoDB", zap.Error(err))
+		return nil, fmt.Errorf("failed to find paste: %w", err)
+	}
 	metrics.RetrievalRequestDuration.WithLabelValues("mongodb_query").Observe(time.Since(phaseStart).Seconds())
+	if p == nil {
+		logger.Info("Paste not found in MongoDB")
+		if p = s.rememberMissing(ctx, url); p == nil {
+			return nil, shared.ErrPasteNotFound
+		}
+	}
+	logger.Info("Retrieved paste from MongoDB")
 
-	// Giai đoạn 2.3: Lưu vào cache
+	// Giai đoạn 2.4: Lưu vào cache
 	phaseStart = time.Now()
 	if p.ExpirationPolicy.Type == paste.TimedExpiration {
-		if err = s.cache.Set(p); err != nil {
-			logger.Errorf("Failed to cache paste", "error", err.Error())
+		if err = s.cache.Set(ctx, p); err != nil {
+			logger.Error("Failed to cache paste", zap.Error(err))
 			// Continue even if caching fails
 		} else {
-			logger.Infof("Cached paste")
+			logger.Info("Cached paste")
 		}
 	}
 	metrics.RetrievalRequestDuration.WithLabelValues("redis_set").Observe(time.Since(phaseStart).Seconds())
@@ -156,6 +312,34 @@ func (s *RetrieveService) fetchPaste(ctx context.Context, url string) (*paste.Pa
 	return p, nil
 }
 
+// rememberMissing caches that url has no paste. paste.created may have
+// stored the paste and cleared the negative cache between the lookup and
+// SetMissing, so MongoDB is read again; a paste found then is returned and
+// the entry is dropped instead of hiding it for NEGATIVE_CACHE_TTL.
+func (s *RetrieveService) rememberMissing(ctx context.Context, url string) *paste.Paste {
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
+
+	if err := s.negative.SetMissing(ctx, url); err != nil {
+		logger.Error("Failed to cache missing paste", zap.Error(err))
+		return nil
+	}
+	p, err := s.repo.FindByURL(ctx, url)
+	if err != nil {
+		logger.Error("Failed to recheck missing paste in MongoDB", zap.Error(err))
+	}
+	if p == nil && err == nil {
+		return nil
+	}
+	// When unsure, drop the entry rather than risk hiding a new paste
+	if err := s.negative.Clear(ctx, url); err != nil {
+		logger.Error("Failed to clear negative cache entry", zap.Error(err))
+	}
+	if p != nil {
+		logger.Info("Paste created while caching its absence")
+	}
+	return p
+}
+
 // isExpired checks if a paste has expired
 func (s *RetrieveService) isExpired(p *paste.Paste) bool {
 	switch p.ExpirationPolicy.Type {
@@ -174,56 +358,83 @@ func (s *RetrieveService) isExpired(p *paste.Paste) bool {
 	}
 }
 
-// processView handles the view event for a paste
-func (s *RetrieveService) processView(ctx context.Context, p *paste.Paste) error {
-	logger := s.logger.With("requestID", ctx.Value("requestID"), "url", p.URL)
+// burn claims a burn-after-read paste for this reader and announces that it
+// was read. It returns ErrPasteExpired if another reader claimed it first.
+func (s *RetrieveService) burn(ctx context.Context, url string) (*paste.Paste, error) {
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(url))
 
-	// Giai đoạn 4.1: Xử lý burn after read
+	// Giai đoạn 4.1: Đánh dấu đã đọc
 	phaseStart := time.Now()
-	if p.ExpirationPolicy.Type == paste.BurnAfterReadExpiration && !p.ExpirationPolicy.IsRead {
-		if err := s.repo.MarkAsRead(p.URL); err != nil {
-			logger.Errorf("Failed to mark paste as read", "error", err.Error())
-			return err
-		}
-		p.ExpirationPolicy.IsRead = true
-		if err := s.pub.PublishBurnAfterReadPasteViewedEvent(paste.BurnAfterReadPasteViewedEvent{
-			URL: p.URL,
-		}); err != nil {
-			logger.Errorf("Failed to publish burn_after_read event", "error", err.Error())
-			return err
-		}
-		logger.Infof("Published burn_after_read event")
-		metrics.RetrievalRequestDuration.WithLabelValues("rabbitmq_publish_burn").Observe(time.Since(phaseStart).Seconds())
-		return nil
+	p, err := s.repo.ClaimBurnAfterRead(ctx, url)
+	if err != nil {
+		logger.Error("Failed to mark paste as read", zap.Error(err))
+		return nil, fmt.Errorf("failed to mark paste as read: %w", err)
 	}
-	metrics.RetrievalRequestDuration.WithLabelValues("rabbitmq_publish_burn").Observe(time.Since(phaseStart).Seconds())
+	if p == nil {
+		logger.Info("Burn-after-read paste was already read")
+		return nil, shared.ErrPasteExpired
+	}
+	// Burn-after-read pastes are not cached, but a copy cached by an older
+	// version must not outlive the read
+	if err = s.cache.Delete(ctx, url); err != nil {
+		logger.Error("Failed to delete burned paste from cache", zap.Error(err))
+	}
+	metrics.RetrievalRequestDuration.WithLabelValues("mongodb_claim").Observe(time.Since(phaseStart).Seconds())
 
-	// Giai đoạn 4.2: Publish regular view event
+	// Giai đoạn 4.2: Publish burn_after_read event
 	phaseStart = time.Now()
-	if err := s.pub.PublishPasteViewedEvent(paste.ViewedEvent{
+	if err = s.pub.PublishBurnAfterReadPasteViewedEvent(ctx, paste.BurnAfterReadPasteViewedEvent{
+		URL: p.URL,
+	}); err != nil {
+		// The paste is claimed either way, so this reader still gets it
+		logger.Error("Failed to publish burn_after_read event", zap.Error(err))
+	} else {
+		logger.Info("Published burn_after_read event")
+	}
+	metrics.RetrievalRequestDuration.WithLabelValues("rabbitmq_publish_burn").Observe(time.Since(phaseStart).Seconds())
+
+	return p, nil
+}
+
+// publishView publishes the view event of a paste that can be read again
+func (s *RetrieveService) publishView(ctx context.Context, p *paste.Paste) error {
+	logger := logging.FromContext(ctx, s.logger).With(logging.URL(p.URL))
+
+	phaseStart := time.Now()
+	if err := s.pub.PublishPasteViewedEvent(ctx, paste.ViewedEvent{
 		URL:      p.URL,
 		ViewedAt: time.Now(),
 	}); err != nil {
-		logger.Errorf("Failed to publish paste_viewed event", "error", err.Error())
+		logger.Error("Failed to publish paste_viewed event", zap.Error(err))
 		return err
 	}
-	logger.Infof("Published paste_viewed event")
+	logger.Info("Published paste_viewed event")
 	metrics.RetrievalRequestDuration.WithLabelValues("rabbitmq_publish_viewed").Observe(time.Since(phaseStart).Seconds())
 
 	return nil
 }
 
+// timeUntilExpiration returns how long a timed paste stays readable. The
+// second result is false for pastes without a deadline.
+func (s *RetrieveService) timeUntilExpiration(p *paste.Paste) (time.Duration, bool) {
+	if p.ExpirationPolicy.Type != paste.TimedExpiration {
+		return 0, false
+	}
+	duration, ok := shared.DurationMap[p.ExpirationPolicy.Duration]
+	if !ok {
+		return 0, false
+	}
+	return time.Until(p.CreatedAt.Add(duration)), true
+}
+
 // calculateTimeUntilExpiration returns a human-readable string for remaining time
 func (s *RetrieveService) calculateTimeUntilExpiration(p *paste.Paste) string {
 	switch p.ExpirationPolicy.Type {
 	case paste.TimedExpiration:
-		duration, ok := shared.DurationMap[p.ExpirationPolicy.Duration]
+		remaining, ok := s.timeUntilExpiration(p)
 		if !ok {
 			return "unknown"
 		}
-
-		expirationTime := p.CreatedAt.Add(duration)
-		remaining := time.Until(expirationTime)
 		if remaining <= 0 {
 			return "expired"
 		}
@@ -0,0 +1,275 @@
+package paste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"retrieval-service/internal/domain/paste"
+	"retrieval-service/shared"
+)
+
+// lockedRepo behaves like the Mongo repository: reads return snapshots and
+// ClaimBurnAfterRead is a single conditional update.
+type lockedRepo struct {
+	mu     sync.Mutex
+	pastes map[string]paste.Paste
+	// finds counts FindByURL calls; when gate is set they wait for it to close
+	finds atomic.Int32
+	gate  chan struct{}
+}
+
+func (r *lockedRepo) FindByURL(ctx context.Context, url string) (*paste.Paste, error) {
+	r.finds.Add(1)
+	if r.gate != nil {
+		<-r.gate
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pastes[url]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (r *lockedRepo) ClaimBurnAfterRead(ctx context.Context, url string) (*paste.Paste, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pastes[url]
+	if !ok || p.ExpirationPolicy.Type != paste.BurnAfterReadExpiration || p.ExpirationPolicy.IsRead {
+		return nil, nil
+	}
+	p.ExpirationPolicy.IsRead = true
+	r.pastes[url] = p
+	return &p, nil
+}
+
+func (r *lockedRepo) Upsert(ctx context.Context, p *paste.Paste) error { return nil }
+
+type noCache struct{}
+
+func (noCache) Get(ctx context.Context, url string) (*paste.Paste, error) { return nil, nil }
+func (noCache) Set(ctx context.Context, p *paste.Paste) error             { return nil }
+func (noCache) Delete(ctx context.Context, url string) error              { return nil }
+
+type memoryNegative struct{ missing sync.Map }
+
+func (n *memoryNegative) Missing(ctx context.Context, url string) (bool, error) {
+	_, ok := n.missing.Load(url)
+	return ok, nil
+}
+func (n *memoryNegative) SetMissing(ctx context.Context, url string) error {
+	n.missing.Store(url, true)
+	return nil
+}
+func (n *memoryNegative) Clear(ctx context.Context, url string) error {
+	n.missing.Delete(url)
+	return nil
+}
+
+// racingNegative runs beforeSet when SetMissing is called, before the entry
+// is stored, to interleave another writer.
+type racingNegative struct {
+	memoryNegative
+	beforeSet func()
+}
+
+func (n *racingNegative) SetMissing(ctx context.Context, url string) error {
+	n.beforeSet()
+	return n.memoryNegative.SetMissing(ctx, url)
+}
+
+// countingGroup reports how many callers are waiting in Do. DoChan registers
+// the call before entered is incremented, so once it reaches n every caller
+// shares the same load.
+type countingGroup struct {
+	group   singleflight.Group
+	entered atomic.Int32
+}
+
+func (g *countingGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	ch := g.group.DoChan(key, fn)
+	g.entered.Add(1)
+	r := <-ch
+	return r.Val, r.Err, r.Shared
+}
+
+type memoryTokens struct {
+	mu     sync.Mutex
+	issued map[string]string
+}
+
+func (t *memoryTokens) Issue(ctx context.Context, url string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.issued == nil {
+		t.issued = map[string]string{}
+	}
+	token := fmt.Sprintf("token-%d", len(t.issued))
+	t.issued[token] = url
+	return token, nil
+}
+
+func (t *memoryTokens) Redeem(ctx context.Context, url, token string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	issuedFor, ok := t.issued[token]
+	delete(t.issued, token)
+	return ok && issuedFor == url, nil
+}
+
+type countingPublisher struct{ views, burns atomic.Int32 }
+
+func (p *countingPublisher) PublishPasteViewedEvent(context.Context, paste.ViewedEvent) error {
+	p.views.Add(1)
+	return nil
+}
+func (p *countingPublisher) PublishBurnAfterReadPasteViewedEvent(context.Context, paste.BurnAfterReadPasteViewedEvent) error {
+	p.burns.Add(1)
+	return nil
+}
+func (p *countingPublisher) Close() error { return nil }
+
+func TestBurnAfterReadIsDeliveredOnce(t *testing.T) {
+	repo := &lockedRepo{pastes: map[string]paste.Paste{
+		"secret": {URL: "secret", Content: "s3cr3t", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.BurnAfterReadExpiration}},
+	}}
+	pub := &countingPublisher{}
+	service := NewRetrieveService(repo, noCache{}, &memoryNegative{}, &memoryTokens{}, pub, zap.NewNop())
+	ctx := context.Background()
+
+	// Opening the paste hands out tokens but does not consume it
+	const readers = 50
+	tokens := make([]string, readers)
+	for i := range tokens {
+		resp, err := service.GetPasteContent(ctx, "secret")
+		if err != nil || resp.Content != "" || !resp.BurnAfterRead {
+			t.Fatalf("GetPasteContent = %+v, %v; want metadata only", resp, err)
+		}
+		if tokens[i], err = service.IssueRevealToken(ctx, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := pub.burns.Load() + pub.views.Load(); n != 0 {
+		t.Fatalf("opening the paste published %d events", n)
+	}
+
+	var (
+		start     = make(chan struct{})
+		wg        sync.WaitGroup
+		delivered atomic.Int32
+	)
+	for _, token := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			resp, err := service.RevealPaste(ctx, "secret", token)
+			switch {
+			case err == nil && resp.Content == "s3cr3t":
+				delivered.Add(1)
+			case !errors.Is(err, shared.ErrPasteExpired):
+				t.Errorf("RevealPaste = %v, %v", resp, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if n := delivered.Load(); n != 1 {
+		t.Errorf("paste delivered to %d readers, want exactly 1", n)
+	}
+	if n := pub.burns.Load(); n != 1 {
+		t.Errorf("published %d burn events, want 1", n)
+	}
+	if n := pub.views.Load(); n != 0 {
+		t.Errorf("published %d view events for a burn-after-read paste", n)
+	}
+}
+
+func TestConcurrentMissesShareOneQuery(t *testing.T) {
+	repo := &lockedRepo{gate: make(chan struct{}), pastes: map[string]paste.Paste{
+		"hot": {URL: "hot", Content: "x", CreatedAt: time.Now(),
+			ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpiration}},
+	}}
+	service := NewRetrieveService(repo, noCache{}, &memoryNegative{}, &memoryTokens{}, &countingPublisher{}, zap.NewNop())
+	group := &countingGroup{}
+	service.loads = group
+
+	const callers = 20
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.GetPastePolicy(context.Background(), "hot"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let every request join the in-flight query before it returns
+	for group.entered.Load() < callers {
+		runtime.Gosched()
+	}
+	close(repo.gate)
+	wg.Wait()
+
+	if n := repo.finds.Load(); n != 1 {
+		t.Errorf("FindByURL called %d times, want 1", n)
+	}
+}
+
+func TestPasteCreatedWhileCachingMissIsFound(t *testing.T) {
+	repo := &lockedRepo{pastes: map[string]paste.Paste{}}
+	negative := &racingNegative{}
+	// paste.created stores the paste and clears the entry after the lookup
+	// missed but before SetMissing
+	negative.beforeSet = func() {
+		repo.mu.Lock()
+		repo.pastes["new"] = paste.Paste{URL: "new", ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpiration}}
+		repo.mu.Unlock()
+		_ = negative.Clear(context.Background(), "new")
+	}
+	service := NewRetrieveService(repo, noCache{}, negative, &memoryTokens{}, &countingPublisher{}, zap.NewNop())
+	ctx := context.Background()
+
+	if _, err := service.GetPastePolicy(ctx, "new"); err != nil {
+		t.Fatalf("first read: %v", err)
+	}
+	if missing, _ := negative.Missing(ctx, "new"); missing {
+		t.Error("paste is still cached as missing")
+	}
+}
+
+func TestUnknownURLsAreCachedAsMissing(t *testing.T) {
+	repo := &lockedRepo{pastes: map[string]paste.Paste{}}
+	negative := &memoryNegative{}
+	service := NewRetrieveService(repo, noCache{}, negative, &memoryTokens{}, &countingPublisher{}, zap.NewNop())
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := service.GetPastePolicy(ctx, "nope"); !errors.Is(err, shared.ErrPasteNotFound) {
+			t.Fatalf("err = %v, want ErrPasteNotFound", err)
+		}
+	}
+	// The first miss reads twice, in case the paste was created meanwhile
+	if n := repo.finds.Load(); n != 2 {
+		t.Errorf("FindByURL called %d times, want 2", n)
+	}
+
+	// paste.created clears the entry
+	repo.pastes["nope"] = paste.Paste{URL: "nope", ExpirationPolicy: paste.ExpirationPolicy{Type: paste.NeverExpiration}}
+	_ = negative.Clear(ctx, "nope")
+	if _, err := service.GetPastePolicy(ctx, "nope"); err != nil {
+		t.Errorf("after clearing: %v", err)
+	}
+}
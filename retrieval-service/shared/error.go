@@ -14,4 +14,6 @@ func (err HTTPError) Error() string {
 var (
 	ErrPasteNotFound = HTTPError{Code: http.StatusNotFound, Message: "Paste not found"}
 	ErrPasteExpired  = HTTPError{Code: http.StatusNotFound, Message: "Paste has expired"}
+
+	ErrInvalidRevealToken = HTTPError{Code: http.StatusForbidden, Message: "Invalid or expired reveal token"}
 )